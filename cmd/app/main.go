@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/casparjones/go-dumper/internal/backup"
 	"github.com/casparjones/go-dumper/internal/config"
 	router "github.com/casparjones/go-dumper/internal/http"
 	"github.com/casparjones/go-dumper/internal/scheduler"
@@ -34,11 +35,19 @@ func main() {
 	}
 	defer db.Close()
 
-	sched := scheduler.New(db)
+	// One queue limits the backups of the scheduler and the API together
+	queue, err := backup.QueueFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure backup queue:", err)
+	}
+
+	sched := scheduler.New(db, queue)
+	// Fail what the last process left running before anything new starts
+	sched.Recover()
 	go sched.Start()
 	defer sched.Stop()
 
-	r := router.New(db)
+	r := router.New(db, queue)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -0,0 +1,122 @@
+// Command decrypt decrypts backup files written with BACKUP_ENCRYPTION
+// without the app, e.g. on the machine a backup is restored on.
+//
+//	decrypt [-identity key.txt] [-o out.sql.gz] [-gunzip] backup.sql.gz.enc
+//	decrypt -keygen
+//
+// Files are decrypted with the X25519 identity given, or else with the
+// master key in APP_ENC_KEY. -keygen prints a new identity and the recipient
+// to put in BACKUP_RECIPIENTS.
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/config"
+	"github.com/casparjones/go-dumper/internal/filecrypt"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("decrypt: ")
+
+	identityFile := flag.String("identity", "", "file with the X25519 identity; APP_ENC_KEY is used without it")
+	output := flag.String("o", "", "output file (default stdout)")
+	gunzip := flag.Bool("gunzip", false, "decompress the decrypted file")
+	keygen := flag.Bool("keygen", false, "generate a new identity and recipient")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: decrypt [-identity file] [-o output] [-gunzip] backup.enc")
+		fmt.Fprintln(flag.CommandLine.Output(), "       decrypt -keygen")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *keygen {
+		identity, err := filecrypt.GenerateIdentity()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("# recipient (BACKUP_RECIPIENTS): %s\n", identity.Recipient())
+		fmt.Println(identity)
+		return
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var key filecrypt.KeyUnwrapper = backup.MasterKey
+	if *identityFile != "" {
+		data, err := os.ReadFile(*identityFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		identity, err := filecrypt.ParseIdentity(identityLine(string(data)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		key = identity
+	} else if err := config.LoadEnvFiles(); err != nil {
+		log.Printf("Warning: Failed to load .env files: %v", err)
+	}
+
+	in, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	var reader io.Reader
+	reader, err = filecrypt.NewReader(in, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *gunzip {
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	// Output is written chunk by chunk as it is authenticated, so a corrupt
+	// file fails part way; the partial output file is removed
+	if _, err := io.Copy(out, reader); err != nil {
+		if *output != "" {
+			os.Remove(*output)
+		}
+		log.Fatal(err)
+	}
+}
+
+// identityLine returns the last line of s that is not empty or a comment,
+// as -keygen writes the recipient as a comment before the identity.
+func identityLine(s string) string {
+	var identity string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			identity = line
+		}
+	}
+	return identity
+}
@@ -0,0 +1,41 @@
+// Command rotatekey re-encrypts the secrets in the database under the
+// current APP_ENC_KEY, after the key was replaced:
+//
+//	APP_ENC_KEY=<new> APP_ENC_KEY_PREVIOUS=<old> rotatekey
+//
+// All target passwords and destination credentials are re-encrypted in one
+// transaction. Keep the old key in APP_ENC_KEY_PREVIOUS while backup files
+// encrypted with it are retained.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/config"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rotatekey: ")
+
+	if err := config.LoadEnvFiles(); err != nil {
+		log.Printf("Warning: Failed to load .env files: %v", err)
+	}
+	cfg := config.Load()
+
+	db, err := store.InitDB(cfg.SQLitePath)
+	if err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	defer db.Close()
+
+	rotation, err := backup.RotateEncryptionKey(store.NewRepository(db))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Re-encrypted under key %s: %d targets, %d jobs, %d backup copies\n",
+		rotation.KeyID, rotation.Targets, rotation.Jobs, rotation.Copies)
+}
@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// progressInterval limits how often progress is written to the backup record.
+const progressInterval = 5 * time.Second
+
+// TableProgress reports how far the dump of a table has come.
+type TableProgress struct {
+	Table         string
+	Rows          int64 // rows written so far
+	EstimatedRows int64 // server estimate of the table size, 0 if unknown
+	Done          bool
+}
+
+func (p TableProgress) String() string {
+	if p.Done {
+		return fmt.Sprintf("Dumped table `%s`: %d rows", p.Table, p.Rows)
+	}
+	if p.EstimatedRows > 0 {
+		return fmt.Sprintf("Dumping table `%s`: %d of ~%d rows", p.Table, p.Rows, p.EstimatedRows)
+	}
+	return fmt.Sprintf("Dumping table `%s`: %d rows", p.Table, p.Rows)
+}
+
+// progressReporter returns a Progress callback that keeps the notes of the
+// running backup up to date, at most once per progressInterval.
+func (d *Dumper) progressReporter(backup *store.Backup) func(TableProgress) {
+	var (
+		mu   sync.Mutex
+		last time.Time
+	)
+	return func(p TableProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+
+		backup.Notes = p.String()
+		d.repo.UpdateBackup(backup)
+	}
+}
+
+// tableDataWriter batches the rows of one table into INSERT statements. The
+// section header and LOCK TABLES are only written with the first row, so
+// empty tables produce no data section at all.
+type tableDataWriter struct {
+	d             *Dumper
+	w             io.Writer
+	table         string
+	columns       []string
+	masks         []*MaskRule // per column, nil if no column is masked
+	batchSize     int
+	estimatedRows int64
+	progress      func(TableProgress)
+
+	values []string
+	rows   int64
+}
+
+// add queues one formatted row, e.g. "(1, 'a')".
+func (t *tableDataWriter) add(row string) error {
+	if t.rows == 0 {
+		if _, err := t.w.Write([]byte(fmt.Sprintf("--\n-- Dumping data for table `%s`\n--\n\n", t.table))); err != nil {
+			return err
+		}
+		if _, err := t.w.Write([]byte(fmt.Sprintf("LOCK TABLES `%s` WRITE;\n", t.table))); err != nil {
+			return err
+		}
+	}
+
+	t.values = append(t.values, row)
+	t.rows++
+
+	if len(t.values) >= t.batchSize {
+		return t.flush()
+	}
+	return nil
+}
+
+// flush writes the queued rows as one INSERT statement.
+func (t *tableDataWriter) flush() error {
+	if len(t.values) == 0 {
+		return nil
+	}
+	if err := t.d.writeInsert(t.w, t.table, t.columns, t.values); err != nil {
+		return err
+	}
+	t.values = t.values[:0]
+	t.report(false)
+	return nil
+}
+
+// close flushes the remaining rows and ends the data section.
+func (t *tableDataWriter) close() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+	if t.rows > 0 {
+		if _, err := t.w.Write([]byte("UNLOCK TABLES;\n\n")); err != nil {
+			return err
+		}
+	}
+	t.report(true)
+	return nil
+}
+
+func (t *tableDataWriter) report(done bool) {
+	if t.progress == nil {
+		return
+	}
+	t.progress(TableProgress{
+		Table:         t.table,
+		Rows:          t.rows,
+		EstimatedRows: t.estimatedRows,
+		Done:          done,
+	})
+}
+
+// writeRows adds every row of rows. If keyIndexes is given, the values of
+// those columns in the last row are returned so a chunked scan can continue
+// after it.
+func (t *tableDataWriter) writeRows(rows *sql.Rows, keyIndexes []int) ([]interface{}, error) {
+	values := make([]interface{}, len(t.columns))
+	valuePtrs := make([]interface{}, len(t.columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	kinds, err := columnKinds(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastKey []interface{}
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+
+		rowData := make([]string, len(t.columns))
+		for i, val := range values {
+			if t.masks != nil && t.masks[i] != nil {
+				// Masked values replace the original, whatever its type
+				rowData[i] = t.d.formatValue(t.masks[i].apply(val))
+				continue
+			}
+			rowData[i] = t.d.formatColumnValue(kinds[i], val)
+		}
+
+		if err := t.add(fmt.Sprintf("(%s)", strings.Join(rowData, ", "))); err != nil {
+			return nil, err
+		}
+
+		if keyIndexes != nil {
+			lastKey = make([]interface{}, len(keyIndexes))
+			for i, idx := range keyIndexes {
+				lastKey[i] = keyValue(kinds[idx], values[idx])
+			}
+		}
+	}
+
+	return lastKey, rows.Err()
+}
+
+// getPrimaryKey returns the primary key columns of table in key order, or
+// nothing if the table has no primary key.
+func (d *Dumper) getPrimaryKey(ctx context.Context, q querier, table string) ([]string, error) {
+	query := "SELECT column_name FROM information_schema.key_column_usage WHERE table_schema = DATABASE() AND table_name = ? AND constraint_name = 'PRIMARY' ORDER BY ordinal_position"
+	return d.queryNames(ctx, q, query, table)
+}
+
+// dumpTableDataChunked walks table in primary key order, chunkSize rows per
+// query, so no single statement has to read the whole table.
+func (d *Dumper) dumpTableDataChunked(ctx context.Context, q querier, tw *tableDataWriter, keyColumns []string, where string, chunkSize int) error {
+	keyIndexes := make([]int, len(keyColumns))
+	for i, key := range keyColumns {
+		keyIndexes[i] = -1
+		for j, column := range tw.columns {
+			if column == "`"+key+"`" {
+				keyIndexes[i] = j
+			}
+		}
+		if keyIndexes[i] < 0 {
+			return fmt.Errorf("primary key column %s of table %s not found", key, tw.table)
+		}
+	}
+
+	var lastKey []interface{}
+	for {
+		query := buildChunkQuery(tw.table, tw.columns, keyColumns, where, lastKey != nil, chunkSize)
+		rows, err := q.QueryContext(ctx, query, lastKey...)
+		if err != nil {
+			return err
+		}
+
+		before := tw.rows
+		key, err := tw.writeRows(rows, keyIndexes)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if tw.rows-before < int64(chunkSize) {
+			return nil
+		}
+		lastKey = key
+	}
+}
+
+// buildChunkQuery returns the SELECT for one chunk of the rows meeting where
+// (if not empty). After the first chunk the query takes the key values of the
+// previous chunk's last row as arguments.
+func buildChunkQuery(table string, columns, keyColumns []string, where string, afterKey bool, chunkSize int) string {
+	keys := make([]string, len(keyColumns))
+	placeholders := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		keys[i] = "`" + key + "`"
+		placeholders[i] = "?"
+	}
+	keyList := strings.Join(keys, ", ")
+
+	var conditions []string
+	if where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+	if afterKey {
+		conditions = append(conditions, fmt.Sprintf("(%s) > (%s)", keyList, strings.Join(placeholders, ", ")))
+	}
+
+	var whereClause string
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return fmt.Sprintf("SELECT %s FROM `%s`%s ORDER BY %s LIMIT %d",
+		strings.Join(columns, ", "), table, whereClause, keyList, chunkSize)
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildChunkQuery(t *testing.T) {
+	columns := []string{"`id`", "`name`"}
+
+	tests := []struct {
+		name       string
+		keyColumns []string
+		where      string
+		afterKey   bool
+		expected   string
+	}{
+		{
+			name:       "first chunk",
+			keyColumns: []string{"id"},
+			expected:   "SELECT `id`, `name` FROM `users` ORDER BY `id` LIMIT 1000",
+		},
+		{
+			name:       "next chunk",
+			keyColumns: []string{"id"},
+			afterKey:   true,
+			expected:   "SELECT `id`, `name` FROM `users` WHERE (`id`) > (?) ORDER BY `id` LIMIT 1000",
+		},
+		{
+			name:       "composite key",
+			keyColumns: []string{"tenant_id", "id"},
+			afterKey:   true,
+			expected:   "SELECT `id`, `name` FROM `users` WHERE (`tenant_id`, `id`) > (?, ?) ORDER BY `tenant_id`, `id` LIMIT 1000",
+		},
+		{
+			name:       "first chunk with row filter",
+			keyColumns: []string{"id"},
+			where:      "(active = 1)",
+			expected:   "SELECT `id`, `name` FROM `users` WHERE ((active = 1)) ORDER BY `id` LIMIT 1000",
+		},
+		{
+			name:       "next chunk with row filter",
+			keyColumns: []string{"id"},
+			where:      "(active = 1)",
+			afterKey:   true,
+			expected:   "SELECT `id`, `name` FROM `users` WHERE ((active = 1)) AND (`id`) > (?) ORDER BY `id` LIMIT 1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildChunkQuery("users", columns, tt.keyColumns, tt.where, tt.afterKey, 1000)
+			if query != tt.expected {
+				t.Errorf("buildChunkQuery mismatch:\nGot:\n%q\nExpected:\n%q", query, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTableDataWriter(t *testing.T) {
+	var buf strings.Builder
+	var progress []TableProgress
+
+	tw := &tableDataWriter{
+		d:             &Dumper{},
+		w:             &buf,
+		table:         "users",
+		columns:       []string{"`id`"},
+		batchSize:     2,
+		estimatedRows: 3,
+		progress:      func(p TableProgress) { progress = append(progress, p) },
+	}
+
+	for _, row := range []string{"(1)", "(2)", "(3)"} {
+		if err := tw.add(row); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if err := tw.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	expected := "--\n-- Dumping data for table `users`\n--\n\n" +
+		"LOCK TABLES `users` WRITE;\n" +
+		"INSERT INTO `users` (`id`) VALUES\n(1),\n(2);\n" +
+		"INSERT INTO `users` (`id`) VALUES\n(3);\n" +
+		"UNLOCK TABLES;\n\n"
+	if buf.String() != expected {
+		t.Errorf("Output mismatch:\nGot:\n%q\nExpected:\n%q", buf.String(), expected)
+	}
+
+	if len(progress) != 3 {
+		t.Fatalf("Expected 3 progress reports, got %d", len(progress))
+	}
+	if progress[0].Rows != 2 || progress[0].Done {
+		t.Errorf("Unexpected first progress report: %+v", progress[0])
+	}
+	if last := progress[2]; last.Rows != 3 || !last.Done {
+		t.Errorf("Unexpected final progress report: %+v", last)
+	}
+}
+
+func TestTableDataWriterEmptyTable(t *testing.T) {
+	var buf strings.Builder
+
+	tw := &tableDataWriter{d: &Dumper{}, w: &buf, table: "empty", columns: []string{"`id`"}, batchSize: 10}
+	if err := tw.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output for an empty table, got %q", buf.String())
+	}
+}
+
+func TestTableProgressString(t *testing.T) {
+	tests := []struct {
+		progress TableProgress
+		expected string
+	}{
+		{TableProgress{Table: "users", Rows: 500, EstimatedRows: 2000}, "Dumping table `users`: 500 of ~2000 rows"},
+		{TableProgress{Table: "users", Rows: 500}, "Dumping table `users`: 500 rows"},
+		{TableProgress{Table: "users", Rows: 2010, EstimatedRows: 2000, Done: true}, "Dumped table `users`: 2010 rows"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.progress.String(); got != tt.expected {
+			t.Errorf("String() = %q, expected %q", got, tt.expected)
+		}
+	}
+}
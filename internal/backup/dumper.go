@@ -6,20 +6,44 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"github.com/casparjones/go-dumper/internal/filecrypt"
+	"github.com/casparjones/go-dumper/internal/storage"
 	"github.com/casparjones/go-dumper/internal/store"
-	"github.com/go-sql-driver/mysql"
 )
 
 type Dumper struct {
 	repo      *store.Repository
 	backupDir string
+
+	// storage receives finished dumps, which are staged in backupDir
+	storage storage.Storage
+
+	// files resolves the FilePath of existing backups for retention
+	files *storage.Resolver
+
+	// encryption, if set, encrypts new backup files
+	encryption *Encryption
+
+	// queue runs the backups, it may be shared with other dumpers
+	queue *Queue
+}
+
+// querier is the subset of *sql.Conn / *sql.Tx used by the dump helpers.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type DumpOptions struct {
@@ -28,29 +52,286 @@ type DumpOptions struct {
 	BackupID     int64
 	Compress     bool
 	BatchSize    int
+
+	IncludeRoutines bool
+	IncludeTriggers bool
+	IncludeEvents   bool
+
+	// IncludeStructure writes DDL: tables, views and stored programs
+	IncludeStructure bool
+
+	// IncludeData writes the table rows
+	IncludeData bool
+
+	// Tables selects the tables to dump and those dumped without rows
+	Tables TableFilter
+
+	// Sanitize, if set, filters and masks the rows of matching tables
+	Sanitize *SanitizeRules
+
+	// Parallelism is the number of tables dumped at the same time
+	Parallelism int
+
+	// ChunkSize > 0 reads tables in primary key ranges of that many rows
+	ChunkSize int
+
+	// Progress, if set, is called as rows are written; it must be safe for
+	// concurrent use when Parallelism > 1
+	Progress func(TableProgress)
+
+	// Encrypt, if not empty, encrypts the file for these keys after
+	// compression
+	Encrypt []filecrypt.KeyWrapper
 }
 
 func NewDumper(repo *store.Repository, backupDir string) *Dumper {
+	return NewDumperWithStorage(repo, backupDir, storage.NewLocal(backupDir))
+}
+
+// NewDumperWithStorage returns a dumper that keeps backups in dest instead of
+// backupDir.
+func NewDumperWithStorage(repo *store.Repository, backupDir string, dest storage.Storage) *Dumper {
+	queue, _ := NewQueue(DefaultConcurrency, LockPolicyQueue)
 	return &Dumper{
 		repo:      repo,
 		backupDir: backupDir,
+		storage:   dest,
+		files:     storage.NewResolver(dest),
+		queue:     queue,
+	}
+}
+
+// SetQueue makes the dumper run its backups in queue, which dumpers share
+// to limit backups across all of them.
+func (d *Dumper) SetQueue(queue *Queue) {
+	d.queue = queue
+}
+
+// Queue returns the queue the dumper runs its backups in.
+func (d *Dumper) Queue() *Queue {
+	return d.queue
+}
+
+// SetEncryption makes the dumper encrypt new backup files as configured by
+// enc; nil turns encryption off.
+func (d *Dumper) SetEncryption(enc *Encryption) {
+	d.encryption = enc
+}
+
+// RemoveLeftovers deletes what backups interrupted by a crash left in the
+// backup directory: .partial staging files, the .chunks-* directories of
+// parallel dumps, the sqlite-* directories of SQLite dumps and the .upload-*
+// files of local storage. It returns the number of entries removed and must
+// only be called while no backup runs.
+func (d *Dumper) RemoveLeftovers() (int, error) {
+	removed := 0
+	err := filepath.WalkDir(d.backupDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if path == d.backupDir {
+			return nil
+		}
+
+		name := entry.Name()
+		if entry.IsDir() {
+			if !strings.HasPrefix(name, ".chunks-") && !strings.HasPrefix(name, "sqlite-") {
+				return nil
+			}
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			removed++
+			return filepath.SkipDir
+		}
+		if !strings.HasSuffix(name, ".partial") && !strings.HasPrefix(name, ".upload-") {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// RunOptions are the settings of a single backup run that are not taken from
+// the target, or override it.
+type RunOptions struct {
+	IncludeStructure bool
+	IncludeData      bool
+
+	// Databases, if not empty, replaces the target's database selection
+	Databases []string
+
+	// Compress, if set, replaces the target's AutoCompress
+	Compress *bool
+
+	// Tables is merged into the target's table filter, see TableFilter.Merge
+	Tables TableFilter
+
+	// SanitizeProfileID, if set, names the sanitize profile applied to the
+	// rows of the dump
+	SanitizeProfileID int64
+
+	// Replicas each receive a copy of every backup of the run
+	Replicas []storage.DestinationConfig
+
+	// JobID is the schedule job of the run, 0 for manual backups
+	JobID int64
+
+	// sanitizeProfile and sanitize are loaded from SanitizeProfileID
+	sanitizeProfile string
+	sanitize        *SanitizeRules
+
+	// replicas are opened from Replicas
+	replicas []replica
+}
+
+// FullBackup is a backup of both structure and data.
+var FullBackup = RunOptions{IncludeStructure: true, IncludeData: true}
+
+// Kind returns the store.BackupKind* constant for the content of the run.
+func (o RunOptions) Kind() (string, error) {
+	switch {
+	case o.IncludeStructure && o.IncludeData:
+		return store.BackupKindFull, nil
+	case o.IncludeStructure:
+		return store.BackupKindStructure, nil
+	case o.IncludeData:
+		return store.BackupKindData, nil
+	default:
+		return "", fmt.Errorf("backup must include structure, data or both")
 	}
 }
 
 func (d *Dumper) CreateBackup(ctx context.Context, targetID int64) (*store.Backup, error) {
+	return d.CreateBackupWithOptions(ctx, targetID, FullBackup)
+}
+
+// CreateBackupWithOptions starts a backup of targetID like CreateBackup, with
+// the content chosen by run. The backups wait in the queue of the dumper,
+// which rejects them with ErrTargetBusy or ErrBackupSkipped if the target
+// already has backups queued or running and its policy is fail or skip.
+func (d *Dumper) CreateBackupWithOptions(ctx context.Context, targetID int64, run RunOptions) (*store.Backup, error) {
+	ticket, err := d.queue.Submit(targetID, run.JobID)
+	if err != nil {
+		return nil, err
+	}
+
+	backups, target, run, err := d.prepareBackups(ctx, targetID, run, ticket)
+	if err != nil {
+		ticket.Done()
+		return nil, err
+	}
+
+	// Start backup process in background
+	go func() {
+		defer ticket.Done()
+		d.performQueuedBackup(context.Background(), ticket, backups, target, run)
+	}()
+
+	// Return the first backup as reference (for API compatibility)
+	return backups[0], nil
+}
+
+// RunBackup backs up targetID like CreateBackupWithOptions, but returns only
+// once the backups of all databases are finished, with their final status.
+func (d *Dumper) RunBackup(ctx context.Context, targetID int64, run RunOptions) ([]*store.Backup, error) {
+	ticket, err := d.queue.Submit(targetID, run.JobID)
+	if err != nil {
+		return nil, err
+	}
+	defer ticket.Done()
+
+	backups, target, run, err := d.prepareBackups(ctx, targetID, run, ticket)
+	if err != nil {
+		return nil, err
+	}
+	d.performQueuedBackup(ctx, ticket, backups, target, run)
+	return backups, nil
+}
+
+// performQueuedBackup performs the backups once it is the turn of ticket.
+func (d *Dumper) performQueuedBackup(ctx context.Context, ticket *Ticket, backups []*store.Backup, target *store.Target, run RunOptions) {
+	if err := ticket.Wait(ctx); err != nil {
+		for _, backup := range backups {
+			d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Cancelled while queued: %v", err))
+		}
+		return
+	}
+
+	for _, backup := range backups {
+		if backup.Status == store.BackupStatusQueued {
+			backup.Status = store.BackupStatusRunning
+			backup.StartedAt = time.Now()
+			d.repo.UpdateBackup(backup)
+		}
+	}
+	d.performMultipleDatabaseBackup(ctx, backups, target, run)
+}
+
+// prepareBackups checks run against the target and creates a backup record
+// for each database it backs up, queued until it is the turn of ticket.
+func (d *Dumper) prepareBackups(ctx context.Context, targetID int64, run RunOptions, ticket *Ticket) ([]*store.Backup, *store.Target, RunOptions, error) {
+	kind, err := run.Kind()
+	if err != nil {
+		return nil, nil, run, err
+	}
+
 	target, err := d.repo.GetTarget(targetID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get target: %w", err)
+		return nil, nil, run, fmt.Errorf("failed to get target: %w", err)
 	}
 
-	// Get databases to backup based on target configuration
-	databases, err := d.getDatabasesForTarget(target)
+	targetTables, err := TargetTableFilter(target)
+	if err != nil {
+		return nil, nil, run, err
+	}
+	run.Tables = targetTables.Merge(run.Tables)
+	if err := run.Tables.Validate(); err != nil {
+		return nil, nil, run, err
+	}
+
+	if run.SanitizeProfileID != 0 {
+		// A profile that is gone or broken fails the run, it must never
+		// fall back to an unsanitized dump
+		profile, err := d.repo.GetSanitizeProfile(run.SanitizeProfileID)
+		if err != nil {
+			return nil, nil, run, fmt.Errorf("failed to get sanitize profile: %w", err)
+		}
+		run.sanitize, err = ParseSanitizeRules(profile.Rules)
+		if err != nil {
+			return nil, nil, run, fmt.Errorf("sanitize profile %s: %w", profile.Name, err)
+		}
+		run.sanitizeProfile = profile.Name
+	}
+
+	run.replicas, err = openReplicas(run.Replicas)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get databases for target: %w", err)
+		return nil, nil, run, err
 	}
 
+	// Get databases to backup based on target configuration
+	databases := run.Databases
 	if len(databases) == 0 {
-		return nil, fmt.Errorf("no databases found to backup")
+		databases, err = d.getDatabasesForTarget(ctx, target)
+		if err != nil {
+			return nil, nil, run, fmt.Errorf("failed to get databases for target: %w", err)
+		}
+	}
+
+	if len(databases) == 0 {
+		return nil, nil, run, fmt.Errorf("no databases found to backup")
+	}
+
+	status := store.BackupStatusQueued
+	if ticket.Started() {
+		status = store.BackupStatusRunning
 	}
 
 	// Create backup records for each database
@@ -59,57 +340,37 @@ func (d *Dumper) CreateBackup(ctx context.Context, targetID int64) (*store.Backu
 		backup := &store.Backup{
 			TargetID:     targetID,
 			DatabaseName: dbName,
+			Kind:         kind,
 			StartedAt:    time.Now(),
-			Status:       store.BackupStatusRunning,
+			Status:       status,
 		}
 
 		if err := d.repo.CreateBackup(backup); err != nil {
-			return nil, fmt.Errorf("failed to create backup record for %s: %w", dbName, err)
+			return nil, nil, run, fmt.Errorf("failed to create backup record for %s: %w", dbName, err)
 		}
 		backups = append(backups, backup)
 	}
 
-	// Start backup process in background
-	go func() {
-		d.performMultipleDatabaseBackup(context.Background(), backups, target)
-	}()
-
-	// Return the first backup as reference (for API compatibility)
-	return backups[0], nil
+	return backups, target, run, nil
 }
 
-func (d *Dumper) getDatabasesForTarget(target *store.Target) ([]string, error) {
-	password, err := store.DecryptPassword(target.PasswordEnc)
+func (d *Dumper) getDatabasesForTarget(ctx context.Context, target *store.Target) ([]string, error) {
+	engine, err := EngineFor(target.Engine, d)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt password: %w", err)
-	}
-
-	// Connect without specifying a database
-	cfg := mysql.Config{
-		User:   target.User,
-		Passwd: password,
-		Net:    "tcp",
-		Addr:   fmt.Sprintf("%s:%d", target.Host, target.Port),
-		Params: map[string]string{
-			"charset": "utf8mb4",
-		},
-		ParseTime:            true,
-		AllowNativePasswords: true,
+		return nil, err
 	}
 
-	db, err := sql.Open("mysql", cfg.FormatDSN())
+	conn, err := dbconn.ForTarget(ctx, target)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
-	}
-	defer db.Close()
-
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
+		return nil, err
 	}
 
 	if target.DatabaseMode == store.DatabaseModeAll {
-		return d.getAllDatabases(db)
+		return engine.ListDatabases(ctx, conn)
 	} else if target.DatabaseMode == store.DatabaseModeSelected {
+		if err := engine.Ping(ctx, conn); err != nil {
+			return nil, err
+		}
 		return d.getSelectedDatabases(target)
 	}
 
@@ -159,27 +420,32 @@ func (d *Dumper) getSelectedDatabases(target *store.Target) ([]string, error) {
 	return databases, nil
 }
 
-func (d *Dumper) performMultipleDatabaseBackup(ctx context.Context, backups []*store.Backup, target *store.Target) {
-	password, err := store.DecryptPassword(target.PasswordEnc)
+func (d *Dumper) performMultipleDatabaseBackup(ctx context.Context, backups []*store.Backup, target *store.Target, run RunOptions) {
+	conn, err := dbconn.ForTarget(ctx, target)
 	if err != nil {
 		for _, backup := range backups {
-			d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Failed to decrypt password: %v", err))
+			d.updateBackupStatus(backup, store.BackupStatusFailed, err.Error())
 		}
 		return
 	}
 
 	// Process each database backup
 	for _, backup := range backups {
-		d.performSingleDatabaseBackup(ctx, backup, target, password)
+		d.performSingleDatabaseBackup(ctx, backup, target, conn, run)
 	}
 
 	// Cleanup old backups after all databases are processed
 	d.cleanupOldBackups(target.ID, target.RetentionDays)
 }
 
-func (d *Dumper) performSingleDatabaseBackup(ctx context.Context, backup *store.Backup, target *store.Target, password string) {
-	timestamp := backup.StartedAt.Format("2006-01-02_15-04-05")
-	filename := fmt.Sprintf("%s_%s_%s.sql.gz", target.Name, backup.DatabaseName, timestamp)
+func (d *Dumper) performSingleDatabaseBackup(ctx context.Context, backup *store.Backup, target *store.Target, conn dbconn.Options, run RunOptions) {
+	compress := target.AutoCompress
+	if run.Compress != nil {
+		compress = *run.Compress
+	}
+
+	encrypt := d.encryption.keys()
+	filename := backupFilename(target, backup, compress, len(encrypt) > 0)
 	
 	// Create year/month directory structure (YYYY/MM/)
 	yearMonth := backup.StartedAt.Format("2006/01")
@@ -191,27 +457,87 @@ func (d *Dumper) performSingleDatabaseBackup(ctx context.Context, backup *store.
 		return
 	}
 	
-	filepath := filepath.Join(backupSubDir, filename)
+	// The dump is staged next to where a local backup ends up, and only
+	// handed to the storage once it is complete
+	key := yearMonth + "/" + filename
+	stagingPath := filepath.Join(backupSubDir, filename+".partial")
 
 	options := &DumpOptions{
 		Target:       target,
 		DatabaseName: backup.DatabaseName,
 		BackupID:     backup.ID,
-		Compress:     target.AutoCompress,
+		Compress:     compress,
 		BatchSize:    1000,
+
+		IncludeStructure: run.IncludeStructure,
+		IncludeData:      run.IncludeData,
+		Tables:           run.Tables,
+		Sanitize:         run.sanitize,
+
+		IncludeRoutines: target.IncludeRoutines,
+		IncludeTriggers: target.IncludeTriggers,
+		IncludeEvents:   target.IncludeEvents,
+
+		Parallelism: target.Parallelism,
+		ChunkSize:   target.ChunkSize,
+		Progress:    d.progressReporter(backup),
+		Encrypt:     encrypt,
 	}
 
-	size, err := d.dumpDatabase(ctx, options, filepath, password)
+	result, err := d.dumpDatabase(ctx, options, stagingPath, conn)
 	if err != nil {
 		d.updateBackupStatus(backup, store.BackupStatusFailed, err.Error())
 		return
 	}
 
+	backup.Checksum, err = storage.FileChecksum(stagingPath)
+	if err != nil {
+		os.Remove(stagingPath)
+		d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Failed to checksum backup: %v", err))
+		return
+	}
+
+	for _, r := range run.replicas {
+		d.replicate(ctx, backup, r, key, stagingPath)
+	}
+
+	err = d.storage.Put(ctx, key, stagingPath)
+	os.Remove(stagingPath)
+	if err != nil {
+		d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Failed to store backup: %v", err))
+		return
+	}
+
+	meta := result.metadata(options)
+	meta.SanitizeProfile = run.sanitizeProfile
+	if len(encrypt) > 0 {
+		meta.Encryption = d.encryption.Mode
+	}
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Failed to encode backup metadata: %v", err))
+		return
+	}
+
 	finishedAt := time.Now()
 	backup.FinishedAt = &finishedAt
-	backup.SizeBytes = size
+	backup.SizeBytes = result.Size
 	backup.Status = store.BackupStatusSuccess
-	backup.FilePath = filepath
+	backup.FilePath = d.storage.URI(key)
+	backup.Notes = ""
+	backup.Metadata = string(metadata)
+
+	primary := &store.BackupCopy{
+		BackupID:    backup.ID,
+		Destination: store.CopyDestinationPrimary,
+		URI:         backup.FilePath,
+		Status:      store.CopyStatusSuccess,
+	}
+	if err := d.repo.CreateBackupCopy(primary); err != nil {
+		d.storage.Delete(ctx, key)
+		d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Failed to record backup copy: %v", err))
+		return
+	}
 
 	if err := d.repo.UpdateBackup(backup); err != nil {
 		d.updateBackupStatus(backup, store.BackupStatusFailed, fmt.Sprintf("Failed to update backup: %v", err))
@@ -219,73 +545,247 @@ func (d *Dumper) performSingleDatabaseBackup(ctx context.Context, backup *store.
 	}
 }
 
-func (d *Dumper) dumpDatabase(ctx context.Context, options *DumpOptions, outputPath, password string) (int64, error) {
-	cfg := mysql.Config{
-		User:                 options.Target.User,
-		Passwd:               password,
-		Net:                  "tcp",
-		Addr:                 fmt.Sprintf("%s:%d", options.Target.Host, options.Target.Port),
-		DBName:               options.DatabaseName,
-		Params:               map[string]string{"charset": "utf8mb4"},
-		ParseTime:            true,
-		AllowNativePasswords: true,
+// backupFilename names the dump file of backup; only compressed dumps get
+// the .gz suffix the restorer looks for, encrypted ones end in .enc. Copies
+// of SQLite files end in .sqlite instead of .sql.
+func backupFilename(target *store.Target, backup *store.Backup, compress, encrypt bool) string {
+	timestamp := backup.StartedAt.Format("2006-01-02_15-04-05")
+	extension := ".sql"
+	if target.Engine == store.EngineSQLite {
+		extension = ".sqlite"
 	}
-
-	db, err := sql.Open("mysql", cfg.FormatDSN())
-	if err != nil {
-		return 0, fmt.Errorf("failed to connect to MySQL: %w", err)
+	filename := fmt.Sprintf("%s_%s_%s%s", target.Name, backup.DatabaseName, timestamp, extension)
+	if compress {
+		filename += ".gz"
 	}
-	defer db.Close()
+	if encrypt {
+		filename += filecrypt.Suffix
+	}
+	return filename
+}
 
-	if err := db.PingContext(ctx); err != nil {
-		return 0, fmt.Errorf("failed to ping MySQL: %w", err)
+// dumpDatabase writes the dump of options.DatabaseName to outputPath,
+// compressed and encrypted as options say. The engine of the target writes
+// the SQL.
+func (d *Dumper) dumpDatabase(ctx context.Context, options *DumpOptions, outputPath string, connOptions dbconn.Options) (result *DumpResult, err error) {
+	engine, err := EngineFor(options.Target.Engine, d)
+	if err != nil {
+		return nil, err
 	}
 
 	file, err := os.Create(outputPath)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create output file: %w", err)
+		return nil, fmt.Errorf("failed to create output file: %w", err)
 	}
 	// WICHTIG: file.Close() NICHT sofort defer’n – erst ganz am Ende schließen
 	// damit wir die Reihenfolge kontrollieren
 	// defer file.Close()
 
+	// Never leave a truncated dump behind that could be mistaken for a backup
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(outputPath)
+		}
+	}()
+
 	var (
-		writer   io.Writer = file
-		gzWriter *gzip.Writer
+		writer    io.Writer = file
+		encWriter io.WriteCloser
+		gzWriter  *gzip.Writer
 	)
+	if len(options.Encrypt) > 0 {
+		encWriter, err = filecrypt.NewWriter(file, options.Encrypt...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start encryption: %w", err)
+		}
+		writer = encWriter
+	}
 	if options.Compress {
-		gzWriter = gzip.NewWriter(file)
+		gzWriter = gzip.NewWriter(writer)
 		writer = gzWriter
 	}
 
 	bufWriter := bufio.NewWriter(writer)
 
-	// … deine Schreib-Logik bleibt gleich …
-
-	if err := d.enableForeignKeyChecks(bufWriter); err != nil {
-		return 0, fmt.Errorf("failed to enable foreign key checks: %w", err)
+	result, err = engine.Dump(ctx, connOptions, bufWriter, options, filepath.Dir(outputPath))
+	if err != nil {
+		return nil, err
 	}
 
 	if err := bufWriter.Flush(); err != nil {
-		return 0, fmt.Errorf("failed to flush buffer: %w", err)
+		return nil, fmt.Errorf("failed to flush buffer: %w", err)
 	}
 	if gzWriter != nil {
 		if err := gzWriter.Close(); err != nil { // explizit schließen, damit alles auf die Datei geschrieben ist
-			return 0, fmt.Errorf("failed to close gzip writer: %w", err)
+			return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+		}
+	}
+	if encWriter != nil {
+		if err := encWriter.Close(); err != nil {
+			return nil, fmt.Errorf("failed to finish encryption: %w", err)
 		}
 	}
 	if err := file.Sync(); err != nil { // optional, sorgt für persistente Größe
-		return 0, fmt.Errorf("failed to sync file: %w", err)
+		return nil, fmt.Errorf("failed to sync file: %w", err)
 	}
 	if err := file.Close(); err != nil {
-		return 0, fmt.Errorf("failed to close file: %w", err)
+		return nil, fmt.Errorf("failed to close file: %w", err)
 	}
 
 	stat, err := os.Stat(outputPath)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get file stats: %w", err)
+		return nil, fmt.Errorf("failed to get file stats: %w", err)
+	}
+	result.Size = stat.Size()
+	return result, nil
+}
+
+// dumpMySQL writes the dump of a MySQL database to w, see Engine.Dump.
+func (d *Dumper) dumpMySQL(ctx context.Context, connOptions dbconn.Options, w io.Writer, options *DumpOptions, tempDir string) (*DumpResult, error) {
+	// TIMESTAMP values are read in UTC to match the TIME_ZONE of the dump
+	// header. Times are not parsed, so fractional seconds and zero dates are
+	// kept exactly as the server returns them.
+	connOptions.Database = options.DatabaseName
+	connOptions.Params = map[string]string{"charset": "utf8mb4", "time_zone": "'+00:00'"}
+	connOptions.ParseTime = false
+
+	db, err := dbconn.Open(ctx, connOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	// All reads, the list of tables included, happen inside snapshot
+	// transactions started at the same point in time, so tables and views
+	// are consistent with each other. conn is always the first of the
+	// returned connections.
+	result := &DumpResult{}
+	listTables := func(ctx context.Context, q querier) ([]string, error) {
+		allTables, err := d.getTables(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		tables, excluded := options.Tables.filterTables(options.DatabaseName, allTables)
+		result.Tables, result.ExcludedTables = tables, excluded
+		return tables, nil
+	}
+	conns, tables, err := d.startSnapshots(ctx, db.DB, conn, listTables, options.Parallelism)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start consistent snapshot: %w", err)
+	}
+	defer func() {
+		for i, c := range conns {
+			c.ExecContext(context.Background(), "ROLLBACK")
+			if i > 0 {
+				c.Close()
+			}
+		}
+	}()
+	for _, table := range tables {
+		if options.Tables.IsSchemaOnly(options.DatabaseName, table) {
+			result.SchemaOnlyTables = append(result.SchemaOnlyTables, table)
+		}
+	}
+
+	if err := d.writeHeader(w, options.Target, options.DatabaseName); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	var dumpTable tableDumpFunc = func(ctx context.Context, q querier, w io.Writer, table string) error {
+		return d.dumpTableAndTriggers(ctx, q, w, table, options)
+	}
+	if len(conns) > 1 {
+		if err := dumpTablesParallel(ctx, conns, w, tables, tempDir, dumpTable); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, table := range tables {
+			if err := dumpTable(ctx, conn, w, table); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if options.IncludeStructure {
+		if err := d.dumpSchemaObjects(ctx, conn, w, options); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.enableForeignKeyChecks(w); err != nil {
+		return nil, fmt.Errorf("failed to enable foreign key checks: %w", err)
+	}
+
+	if err := d.writeFooter(w); err != nil {
+		return nil, fmt.Errorf("failed to write footer: %w", err)
+	}
+	return result, nil
+}
+
+// dumpSchemaObjects writes the routines, views and events of the database.
+func (d *Dumper) dumpSchemaObjects(ctx context.Context, q querier, w io.Writer, options *DumpOptions) error {
+	// Routines go before views, which may call stored functions
+	if options.IncludeRoutines {
+		if err := d.dumpRoutines(ctx, q, w); err != nil {
+			return fmt.Errorf("failed to dump routines: %w", err)
+		}
+	}
+
+	views, err := d.getViews(ctx, q)
+	if err != nil {
+		return fmt.Errorf("failed to list views: %w", err)
+	}
+
+	for _, view := range views {
+		if err := d.dumpView(ctx, q, w, view); err != nil {
+			return fmt.Errorf("failed to dump view %s: %w", view, err)
+		}
 	}
-	return stat.Size(), nil
+
+	if options.IncludeEvents {
+		if err := d.dumpEvents(ctx, q, w); err != nil {
+			return fmt.Errorf("failed to dump events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dumpTableAndTriggers writes the structure, data and (optionally) triggers of table.
+func (d *Dumper) dumpTableAndTriggers(ctx context.Context, q querier, w io.Writer, table string, options *DumpOptions) error {
+	if err := d.dumpTable(ctx, q, w, table, options); err != nil {
+		return fmt.Errorf("failed to dump table %s: %w", table, err)
+	}
+
+	// Triggers follow the data so they do not fire while it is reloaded
+	if options.IncludeStructure && options.IncludeTriggers {
+		if err := d.dumpTriggers(ctx, q, w, table); err != nil {
+			return fmt.Errorf("failed to dump triggers for table %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// beginSnapshot opens a read-only REPEATABLE READ transaction on conn and
+// takes the InnoDB read view immediately instead of at the first read.
+func (d *Dumper) beginSnapshot(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY")
+	return err
 }
 
 func (d *Dumper) writeHeader(w io.Writer, target *store.Target, databaseName string) error {
@@ -321,9 +821,27 @@ func (d *Dumper) enableForeignKeyChecks(w io.Writer) error {
 	return err
 }
 
-func (d *Dumper) getTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
-	query := "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'"
-	rows, err := tx.QueryContext(ctx, query)
+// writeFooter restores the session variables saved by writeHeader.
+func (d *Dumper) writeFooter(w io.Writer) error {
+	footer := `
+/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
+/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;
+/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
+/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;
+/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;
+/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
+
+-- Dump completed
+`
+	_, err := w.Write([]byte(footer))
+	return err
+}
+
+func (d *Dumper) getTables(ctx context.Context, q querier) ([]string, error) {
+	query := "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name"
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -341,9 +859,9 @@ func (d *Dumper) getTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
 	return tables, nil
 }
 
-func (d *Dumper) getViews(ctx context.Context, tx *sql.Tx) ([]string, error) {
-	query := "SELECT table_name FROM information_schema.views WHERE table_schema = DATABASE()"
-	rows, err := tx.QueryContext(ctx, query)
+func (d *Dumper) getViews(ctx context.Context, q querier) ([]string, error) {
+	query := "SELECT table_name FROM information_schema.views WHERE table_schema = DATABASE() ORDER BY table_name"
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -361,8 +879,21 @@ func (d *Dumper) getViews(ctx context.Context, tx *sql.Tx) ([]string, error) {
 	return views, nil
 }
 
-func (d *Dumper) dumpTable(ctx context.Context, tx *sql.Tx, w io.Writer, table string, batchSize int) error {
-	createTableSQL, err := d.getCreateTableSQL(ctx, tx, table)
+func (d *Dumper) dumpTable(ctx context.Context, q querier, w io.Writer, table string, options *DumpOptions) error {
+	if options.IncludeStructure {
+		if err := d.dumpTableStructure(ctx, q, w, table); err != nil {
+			return err
+		}
+	}
+
+	if !options.IncludeData || options.Tables.IsSchemaOnly(options.DatabaseName, table) {
+		return nil
+	}
+	return d.dumpTableData(ctx, q, w, table, options)
+}
+
+func (d *Dumper) dumpTableStructure(ctx context.Context, q querier, w io.Writer, table string) error {
+	createTableSQL, err := d.getCreateTableSQL(ctx, q, table)
 	if err != nil {
 		return fmt.Errorf("failed to get CREATE TABLE for %s: %w", table, err)
 	}
@@ -375,99 +906,88 @@ func (d *Dumper) dumpTable(ctx context.Context, tx *sql.Tx, w io.Writer, table s
 		return err
 	}
 
-	if _, err := w.Write([]byte(createTableSQL + ";\n\n")); err != nil {
-		return err
-	}
-
-	return d.dumpTableData(ctx, tx, w, table, batchSize)
+	_, err = w.Write([]byte(createTableSQL + ";\n\n"))
+	return err
 }
 
-func (d *Dumper) getCreateTableSQL(ctx context.Context, tx *sql.Tx, table string) (string, error) {
+func (d *Dumper) getCreateTableSQL(ctx context.Context, q querier, table string) (string, error) {
 	var tableName, createSQL string
-	err := tx.QueryRowContext(ctx, "SHOW CREATE TABLE `"+table+"`").Scan(&tableName, &createSQL)
+	err := q.QueryRowContext(ctx, "SHOW CREATE TABLE `"+table+"`").Scan(&tableName, &createSQL)
 	if err != nil {
 		return "", err
 	}
 	return createSQL, nil
 }
 
-func (d *Dumper) dumpTableData(ctx context.Context, tx *sql.Tx, w io.Writer, table string, batchSize int) error {
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table)
-	var count int64
-	if err := tx.QueryRowContext(ctx, countQuery).Scan(&count); err != nil {
+func (d *Dumper) dumpTableData(ctx context.Context, q querier, w io.Writer, table string, options *DumpOptions) error {
+	columns, err := d.getTableColumns(ctx, q, table)
+	if err != nil {
 		return err
 	}
 
-	if count == 0 {
-		return nil
-	}
+	// Row estimate for progress reports; an exact COUNT(*) would scan the table
+	var estimatedRows sql.NullInt64
+	q.QueryRowContext(ctx, "SELECT table_rows FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).Scan(&estimatedRows)
 
-	if _, err := w.Write([]byte(fmt.Sprintf("--\n-- Dumping data for table `%s`\n--\n\n", table))); err != nil {
-		return err
+	sanitizer := options.Sanitize.forTable(options.DatabaseName, table)
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = strings.Trim(column, "`")
 	}
-
-	if _, err := w.Write([]byte(fmt.Sprintf("LOCK TABLES `%s` WRITE;\n", table))); err != nil {
-		return err
-	}
-
-	columns, err := d.getTableColumns(ctx, tx, table)
+	masks, err := sanitizer.columnMasks(names)
 	if err != nil {
 		return err
 	}
 
-	query := fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(columns, ", "), table)
-	rows, err := tx.QueryContext(ctx, query)
-	if err != nil {
-		return err
+	tw := &tableDataWriter{
+		d:             d,
+		w:             w,
+		table:         table,
+		columns:       columns,
+		masks:         masks,
+		batchSize:     options.BatchSize,
+		estimatedRows: estimatedRows.Int64,
+		progress:      options.Progress,
 	}
-	defer rows.Close()
 
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-	for i := range values {
-		valuePtrs[i] = &values[i]
+	var where string
+	if sanitizer != nil {
+		where = sanitizer.where
 	}
 
-	var insertValues []string
-	rowCount := 0
-
-	for rows.Next() {
-		if err := rows.Scan(valuePtrs...); err != nil {
+	if options.ChunkSize > 0 {
+		keyColumns, err := d.getPrimaryKey(ctx, q, table)
+		if err != nil {
 			return err
 		}
-
-		rowData := make([]string, len(columns))
-		for i, val := range values {
-			rowData[i] = d.formatValue(val)
-		}
-
-		insertValues = append(insertValues, fmt.Sprintf("(%s)", strings.Join(rowData, ", ")))
-		rowCount++
-
-		if rowCount%batchSize == 0 {
-			if err := d.writeInsert(w, table, columns, insertValues); err != nil {
+		if len(keyColumns) > 0 {
+			if err := d.dumpTableDataChunked(ctx, q, tw, keyColumns, where, options.ChunkSize); err != nil {
 				return err
 			}
-			insertValues = insertValues[:0]
+			return tw.close()
 		}
 	}
 
-	if len(insertValues) > 0 {
-		if err := d.writeInsert(w, table, columns, insertValues); err != nil {
-			return err
-		}
+	query := fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(columns, ", "), table)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	if _, err := w.Write([]byte("UNLOCK TABLES;\n\n")); err != nil {
+	if _, err := tw.writeRows(rows, nil); err != nil {
 		return err
 	}
 
-	return nil
+	return tw.close()
 }
 
-func (d *Dumper) getTableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+func (d *Dumper) getTableColumns(ctx context.Context, q querier, table string) ([]string, error) {
 	query := fmt.Sprintf("SHOW COLUMNS FROM `%s`", table)
-	rows, err := tx.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -506,11 +1026,13 @@ func (d *Dumper) formatValue(val interface{}) string {
 	case string:
 		return "'" + d.escapeString(v) + "'"
 	case time.Time:
-		return "'" + v.Format("2006-01-02 15:04:05") + "'"
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		return fmt.Sprintf("%d", v)
-	case float32, float64:
-		return fmt.Sprintf("%g", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
 	case bool:
 		if v {
 			return "1"
@@ -528,11 +1050,13 @@ func (d *Dumper) escapeString(s string) string {
 	s = strings.ReplaceAll(s, "\n", "\\n")
 	s = strings.ReplaceAll(s, "\r", "\\r")
 	s = strings.ReplaceAll(s, "\t", "\\t")
+	s = strings.ReplaceAll(s, "\x00", "\\0")
+	s = strings.ReplaceAll(s, "\x1a", "\\Z")
 	return s
 }
 
-func (d *Dumper) dumpView(ctx context.Context, tx *sql.Tx, w io.Writer, view string) error {
-	createViewSQL, err := d.getCreateViewSQL(ctx, tx, view)
+func (d *Dumper) dumpView(ctx context.Context, q querier, w io.Writer, view string) error {
+	createViewSQL, err := d.getCreateViewSQL(ctx, q, view)
 	if err != nil {
 		return fmt.Errorf("failed to get CREATE VIEW for %s: %w", view, err)
 	}
@@ -552,15 +1076,227 @@ func (d *Dumper) dumpView(ctx context.Context, tx *sql.Tx, w io.Writer, view str
 	return nil
 }
 
-func (d *Dumper) getCreateViewSQL(ctx context.Context, tx *sql.Tx, view string) (string, error) {
+func (d *Dumper) getCreateViewSQL(ctx context.Context, q querier, view string) (string, error) {
 	var viewName, createSQL, charset, collation string
-	err := tx.QueryRowContext(ctx, "SHOW CREATE VIEW `"+view+"`").Scan(&viewName, &createSQL, &charset, &collation)
+	err := q.QueryRowContext(ctx, "SHOW CREATE VIEW `"+view+"`").Scan(&viewName, &createSQL, &charset, &collation)
 	if err != nil {
 		return "", err
 	}
 	return createSQL, nil
 }
 
+// storedProgram is a trigger, routine or event definition as read from the server.
+type storedProgram struct {
+	Kind      string // TRIGGER, PROCEDURE, FUNCTION or EVENT
+	Name      string
+	CreateSQL string
+	SQLMode   string
+	TimeZone  string // only set for events
+}
+
+func (d *Dumper) dumpTriggers(ctx context.Context, q querier, w io.Writer, table string) error {
+	query := "SELECT trigger_name FROM information_schema.triggers WHERE event_object_schema = DATABASE() AND event_object_table = ? ORDER BY action_order"
+	names, err := d.queryNames(ctx, q, query, table)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	if _, err := w.Write([]byte(fmt.Sprintf("--\n-- Triggers for table `%s`\n--\n\n", table))); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		program, err := d.getStoredProgram(ctx, q, "TRIGGER", name)
+		if err != nil {
+			return err
+		}
+		if err := d.writeStoredProgram(w, program); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dumper) dumpRoutines(ctx context.Context, q querier, w io.Writer) error {
+	query := "SELECT routine_type, routine_name FROM information_schema.routines WHERE routine_schema = DATABASE() ORDER BY routine_type, routine_name"
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var routines [][2]string
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		routines = append(routines, [2]string{kind, name})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(routines) == 0 {
+		return nil
+	}
+
+	if _, err := w.Write([]byte("--\n-- Dumping routines\n--\n\n")); err != nil {
+		return err
+	}
+
+	for _, routine := range routines {
+		program, err := d.getStoredProgram(ctx, q, routine[0], routine[1])
+		if err != nil {
+			return err
+		}
+		if err := d.writeStoredProgram(w, program); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dumper) dumpEvents(ctx context.Context, q querier, w io.Writer) error {
+	query := "SELECT event_name FROM information_schema.events WHERE event_schema = DATABASE() ORDER BY event_name"
+	names, err := d.queryNames(ctx, q, query)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	if _, err := w.Write([]byte("--\n-- Dumping events\n--\n\n")); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		program, err := d.getStoredProgram(ctx, q, "EVENT", name)
+		if err != nil {
+			return err
+		}
+		if err := d.writeStoredProgram(w, program); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryNames returns the first column of every row of query.
+func (d *Dumper) queryNames(ctx context.Context, q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// createColumns maps a stored program kind to the SHOW CREATE column holding its definition.
+var createColumns = map[string]string{
+	"TRIGGER":   "SQL Original Statement",
+	"PROCEDURE": "Create Procedure",
+	"FUNCTION":  "Create Function",
+	"EVENT":     "Create Event",
+}
+
+// getStoredProgram reads a definition via SHOW CREATE <kind>. The result
+// columns differ between MySQL and MariaDB versions, so they are read by name.
+func (d *Dumper) getStoredProgram(ctx context.Context, q querier, kind, name string) (storedProgram, error) {
+	program := storedProgram{Kind: kind, Name: name}
+
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SHOW CREATE %s `%s`", kind, name))
+	if err != nil {
+		return program, fmt.Errorf("failed to get CREATE %s for %s: %w", kind, name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return program, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return program, err
+		}
+		return program, fmt.Errorf("%s %s not found", strings.ToLower(kind), name)
+	}
+
+	values := make([]sql.NullString, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return program, err
+	}
+
+	for i, column := range columns {
+		switch column {
+		case createColumns[kind]:
+			program.CreateSQL = values[i].String
+		case "sql_mode":
+			program.SQLMode = values[i].String
+		case "time_zone":
+			program.TimeZone = values[i].String
+		}
+	}
+
+	// The definition is NULL when the user lacks privileges to see it
+	if program.CreateSQL == "" {
+		return program, fmt.Errorf("definition of %s %s is not readable - check user privileges", strings.ToLower(kind), name)
+	}
+
+	return program, nil
+}
+
+// writeStoredProgram writes a definition inside a DELIMITER block, running it
+// under the sql_mode (and for events the time zone) it was created with.
+func (d *Dumper) writeStoredProgram(w io.Writer, program storedProgram) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "DROP %s IF EXISTS `%s`;\n", program.Kind, program.Name)
+	if program.TimeZone != "" {
+		b.WriteString("/*!50106 SET @saved_time_zone = @@TIME_ZONE */;\n")
+		fmt.Fprintf(&b, "/*!50106 SET TIME_ZONE = '%s' */;\n", d.escapeString(program.TimeZone))
+	}
+	b.WriteString("/*!50003 SET @saved_sql_mode = @@SQL_MODE */;\n")
+	fmt.Fprintf(&b, "/*!50003 SET SQL_MODE = '%s' */;\n", d.escapeString(program.SQLMode))
+	b.WriteString("DELIMITER ;;\n")
+	b.WriteString(program.CreateSQL)
+	b.WriteString(" ;;\n")
+	b.WriteString("DELIMITER ;\n")
+	b.WriteString("/*!50003 SET SQL_MODE = @saved_sql_mode */;\n")
+	if program.TimeZone != "" {
+		b.WriteString("/*!50106 SET TIME_ZONE = @saved_time_zone */;\n")
+	}
+	b.WriteString("\n")
+
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
+
 func (d *Dumper) updateBackupStatus(backup *store.Backup, status, notes string) {
 	finishedAt := time.Now()
 	backup.FinishedAt = &finishedAt
@@ -569,27 +1305,52 @@ func (d *Dumper) updateBackupStatus(backup *store.Backup, status, notes string)
 	d.repo.UpdateBackup(backup)
 }
 
+// cleanupOldBackups removes the copies of the target's backups that are older
+// than their retention, retentionDays for copies without their own. A backup
+// is deleted along with its last copy; copies that cannot be deleted are kept
+// and tried again on the next run.
 func (d *Dumper) cleanupOldBackups(targetID int64, retentionDays int) {
+	ctx := context.Background()
+
 	if retentionDays <= 0 {
 		retentionDays = 30 // Default to 30 days if not set
 	}
 
-	cutoff := time.Now().AddDate(0, 0, -retentionDays)
 	backups, err := d.repo.GetBackupsByTarget(targetID)
 	if err != nil {
 		return
 	}
 
+	now := time.Now()
 	for _, backup := range backups {
-		if backup.StartedAt.Before(cutoff) && backup.FilePath != "" {
-			// Remove the backup file
-			if err := os.Remove(backup.FilePath); err == nil || os.IsNotExist(err) {
-				// Only delete from database if file was successfully removed or doesn't exist
-				d.repo.DeleteBackup(backup.ID)
+		// Backups without copies failed before storing a file
+		if len(backup.Copies) == 0 {
+			continue
+		}
+
+		remaining := 0
+		for _, backupCopy := range backup.Copies {
+			days := backupCopy.RetentionDays
+			if days <= 0 {
+				days = retentionDays
+			}
+			if !backup.StartedAt.Before(now.AddDate(0, 0, -days)) {
+				remaining++
+				continue
 			}
+
+			if err := DeleteBackupCopy(ctx, d.files, backupCopy); err != nil {
+				remaining++
+				continue
+			}
+			d.repo.DeleteBackupCopy(backupCopy.ID)
+		}
+
+		if remaining == 0 {
+			d.repo.DeleteBackup(backup.ID)
 		}
 	}
-	
+
 	// Also cleanup empty year/month directories
 	d.cleanupEmptyDirectories()
 }
@@ -1,6 +1,8 @@
 package backup
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -181,6 +183,139 @@ func TestWriteHeader(t *testing.T) {
 	}
 }
 
+func TestWriteFooter(t *testing.T) {
+	d := &Dumper{}
+	var buf strings.Builder
+
+	if err := d.writeFooter(&buf); err != nil {
+		t.Fatalf("writeFooter failed: %v", err)
+	}
+
+	output := buf.String()
+
+	if !strings.Contains(output, "SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS") {
+		t.Error("Footer missing foreign key checks restore")
+	}
+
+	if !strings.Contains(output, "SET SQL_MODE=@OLD_SQL_MODE") {
+		t.Error("Footer missing sql mode restore")
+	}
+}
+
+func TestWriteStoredProgram(t *testing.T) {
+	d := &Dumper{}
+
+	tests := []struct {
+		name     string
+		program  storedProgram
+		expected string
+	}{
+		{
+			name: "procedure",
+			program: storedProgram{
+				Kind:      "PROCEDURE",
+				Name:      "cleanup",
+				CreateSQL: "CREATE PROCEDURE `cleanup`()\nBEGIN\n  DELETE FROM sessions;\nEND",
+				SQLMode:   "STRICT_TRANS_TABLES",
+			},
+			expected: "DROP PROCEDURE IF EXISTS `cleanup`;\n" +
+				"/*!50003 SET @saved_sql_mode = @@SQL_MODE */;\n" +
+				"/*!50003 SET SQL_MODE = 'STRICT_TRANS_TABLES' */;\n" +
+				"DELIMITER ;;\n" +
+				"CREATE PROCEDURE `cleanup`()\nBEGIN\n  DELETE FROM sessions;\nEND ;;\n" +
+				"DELIMITER ;\n" +
+				"/*!50003 SET SQL_MODE = @saved_sql_mode */;\n\n",
+		},
+		{
+			name: "event with time zone",
+			program: storedProgram{
+				Kind:      "EVENT",
+				Name:      "nightly",
+				CreateSQL: "CREATE EVENT `nightly` ON SCHEDULE EVERY 1 DAY DO CALL cleanup()",
+				TimeZone:  "SYSTEM",
+			},
+			expected: "DROP EVENT IF EXISTS `nightly`;\n" +
+				"/*!50106 SET @saved_time_zone = @@TIME_ZONE */;\n" +
+				"/*!50106 SET TIME_ZONE = 'SYSTEM' */;\n" +
+				"/*!50003 SET @saved_sql_mode = @@SQL_MODE */;\n" +
+				"/*!50003 SET SQL_MODE = '' */;\n" +
+				"DELIMITER ;;\n" +
+				"CREATE EVENT `nightly` ON SCHEDULE EVERY 1 DAY DO CALL cleanup() ;;\n" +
+				"DELIMITER ;\n" +
+				"/*!50003 SET SQL_MODE = @saved_sql_mode */;\n" +
+				"/*!50106 SET TIME_ZONE = @saved_time_zone */;\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			if err := d.writeStoredProgram(&buf, tt.program); err != nil {
+				t.Fatalf("writeStoredProgram failed: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("writeStoredProgram output mismatch:\nGot:\n%q\nExpected:\n%q", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunOptionsKind(t *testing.T) {
+	tests := []struct {
+		name          string
+		run           RunOptions
+		expected      string
+		expectedError bool
+	}{
+		{name: "full", run: FullBackup, expected: store.BackupKindFull},
+		{name: "structure only", run: RunOptions{IncludeStructure: true}, expected: store.BackupKindStructure},
+		{name: "data only", run: RunOptions{IncludeData: true}, expected: store.BackupKindData},
+		{name: "nothing", run: RunOptions{}, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, err := tt.run.Kind()
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("Expected error, got kind %q", kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if kind != tt.expected {
+				t.Errorf("Kind() = %q, expected %q", kind, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackupFilename(t *testing.T) {
+	target := &store.Target{Name: "prod"}
+	backup := &store.Backup{
+		DatabaseName: "shop",
+		StartedAt:    time.Date(2024, 3, 1, 4, 5, 6, 0, time.UTC),
+	}
+
+	if got := backupFilename(target, backup, true, false); got != "prod_shop_2024-03-01_04-05-06.sql.gz" {
+		t.Errorf("Unexpected compressed filename %q", got)
+	}
+	if got := backupFilename(target, backup, false, false); got != "prod_shop_2024-03-01_04-05-06.sql" {
+		t.Errorf("Unexpected uncompressed filename %q", got)
+	}
+	if got := backupFilename(target, backup, true, true); got != "prod_shop_2024-03-01_04-05-06.sql.gz.enc" {
+		t.Errorf("Unexpected encrypted filename %q", got)
+	}
+
+	target.Engine = store.EngineSQLite
+	backup.DatabaseName = "main"
+	if got := backupFilename(target, backup, true, false); got != "prod_main_2024-03-01_04-05-06.sqlite.gz" {
+		t.Errorf("Unexpected SQLite filename %q", got)
+	}
+}
+
 func TestWriteInsert(t *testing.T) {
 	d := &Dumper{}
 	var buf strings.Builder
@@ -295,3 +430,49 @@ func TestParseScheduleTime(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	month := filepath.Join(dir, "2026", "10")
+	files := map[string]bool{
+		"2026/10/shop_20261017.sql.gz":         true,
+		"2026/10/shop_20261017.sql.gz.partial": false,
+		"2026/10/.chunks-123/orders.sql":       false,
+		"2026/10/sqlite-456/app.db":            false,
+		"2026/10/.upload-789":                  false,
+		"2026/09/notes.partial.txt":            true,
+		"2026/09/sqlite_20260930.db.gz":        true,
+	}
+	for name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := NewDumper(nil, dir)
+	removed, err := d.RemoveLeftovers()
+	if err != nil {
+		t.Fatalf("RemoveLeftovers: %v", err)
+	}
+	if removed != 4 {
+		t.Errorf("RemoveLeftovers removed %d entries, expected 4", removed)
+	}
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if exists := err == nil; exists != kept {
+			t.Errorf("%s exists = %v, expected %v", name, exists, kept)
+		}
+	}
+	if _, err := os.Stat(month); err != nil {
+		t.Errorf("backup directory removed: %v", err)
+	}
+
+	missing := NewDumper(nil, filepath.Join(dir, "missing"))
+	if removed, err := missing.RemoveLeftovers(); err != nil || removed != 0 {
+		t.Errorf("RemoveLeftovers of a missing directory = %d, %v; expected 0, nil", removed, err)
+	}
+}
@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/config"
+	"github.com/casparjones/go-dumper/internal/filecrypt"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// Encryption modes of backup files
+const (
+	EncryptionNone      = "none"      // files are stored as dumped
+	EncryptionMaster    = "master"    // data keys are wrapped by APP_ENC_KEY
+	EncryptionRecipient = "recipient" // data keys are wrapped for the recipients only
+)
+
+// MasterKey wraps the data keys of backup files with APP_ENC_KEY, like the
+// passwords of targets.
+var MasterKey = filecrypt.MasterKey{Seal: store.EncryptPassword, Open: store.DecryptPassword}
+
+// Encryption configures how the dumper encrypts backup files.
+type Encryption struct {
+	Mode string
+
+	// Recipients get a copy of every data key. With EncryptionRecipient they
+	// are the only ones who can read the files; the app can't restore them.
+	Recipients []*filecrypt.Recipient
+}
+
+// EncryptionFromEnv returns the encryption selected by BACKUP_ENCRYPTION:
+// "none" (the default), "master" or "recipient", with the X25519 public keys
+// in the comma separated BACKUP_RECIPIENTS.
+func EncryptionFromEnv() (*Encryption, error) {
+	enc := &Encryption{Mode: config.GetEnv("BACKUP_ENCRYPTION", EncryptionNone)}
+	for _, key := range strings.Split(config.GetEnv("BACKUP_RECIPIENTS", ""), ",") {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+		recipient, err := filecrypt.ParseRecipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("BACKUP_RECIPIENTS: %w", err)
+		}
+		enc.Recipients = append(enc.Recipients, recipient)
+	}
+
+	switch enc.Mode {
+	case EncryptionNone, EncryptionMaster:
+	case EncryptionRecipient:
+		if len(enc.Recipients) == 0 {
+			return nil, fmt.Errorf("BACKUP_ENCRYPTION=recipient requires BACKUP_RECIPIENTS")
+		}
+	default:
+		return nil, fmt.Errorf("unknown backup encryption %q", enc.Mode)
+	}
+	return enc, nil
+}
+
+// keys returns who the data keys are wrapped for, none if files are not
+// encrypted.
+func (e *Encryption) keys() []filecrypt.KeyWrapper {
+	if e == nil || e.Mode == EncryptionNone || e.Mode == "" {
+		return nil
+	}
+	var keys []filecrypt.KeyWrapper
+	if e.Mode == EncryptionMaster {
+		keys = append(keys, MasterKey)
+	}
+	for _, recipient := range e.Recipients {
+		keys = append(keys, recipient)
+	}
+	return keys
+}
+
+// backupReader reads a backup file, decrypted if needed.
+type backupReader struct {
+	io.Reader
+	io.Closer
+}
+
+// decryptBackupFile returns file decrypted with MasterKey if it is
+// encrypted, else file itself.
+func decryptBackupFile(file io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(file)
+	if !filecrypt.IsEncrypted(buffered) {
+		return backupReader{Reader: buffered, Closer: file}, nil
+	}
+	plain, err := filecrypt.NewReader(buffered, MasterKey)
+	if err != nil {
+		file.Close()
+		if errors.Is(err, filecrypt.ErrNoKey) {
+			return nil, fmt.Errorf("backup is encrypted for a recipient and must be decrypted offline")
+		}
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	return backupReader{Reader: plain, Closer: file}, nil
+}
@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/casparjones/go-dumper/internal/filecrypt"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+func TestEncryptionFromEnv(t *testing.T) {
+	identity, err := filecrypt.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		recipients string
+		keys       int
+		wantErr    bool
+	}{
+		{"default", "", "", 0, false},
+		{"master", "master", "", 1, false},
+		{"master with escrow recipient", "master", identity.Recipient().String(), 2, false},
+		{"recipient", "recipient", " " + identity.Recipient().String() + " ,", 1, false},
+		{"recipient without recipients", "recipient", "", 0, true},
+		{"invalid recipient", "master", "not-a-key", 0, true},
+		{"unknown mode", "rot13", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BACKUP_ENCRYPTION", tt.mode)
+			t.Setenv("BACKUP_RECIPIENTS", tt.recipients)
+			if tt.mode == "" {
+				os.Unsetenv("BACKUP_ENCRYPTION")
+			}
+
+			enc, err := EncryptionFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncryptionFromEnv failed: %v", err)
+			}
+			if keys := enc.keys(); len(keys) != tt.keys {
+				t.Errorf("Expected %d keys, got %d", tt.keys, len(keys))
+			}
+		})
+	}
+}
+
+func TestOpenEncryptedBackupFile(t *testing.T) {
+	setupTestEncryption(t)
+	identity, _ := filecrypt.GenerateIdentity()
+	dir := t.TempDir()
+
+	write := func(name string, keys ...filecrypt.KeyWrapper) *store.Backup {
+		path := filepath.Join(dir, name)
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var w io.Writer = file
+		var enc io.WriteCloser
+		if len(keys) > 0 {
+			enc, err = filecrypt.NewWriter(file, keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w = enc
+		}
+		io.WriteString(w, "-- MySQL dump\n")
+		if enc != nil {
+			enc.Close()
+		}
+		file.Close()
+		return &store.Backup{FilePath: path}
+	}
+
+	restorer := NewRestorer(nil)
+	ctx := context.Background()
+
+	for _, backup := range []*store.Backup{
+		write("plain.sql"),
+		write("master.sql.enc", MasterKey, identity.Recipient()),
+	} {
+		file, err := restorer.OpenBackupFile(ctx, backup)
+		if err != nil {
+			t.Fatalf("OpenBackupFile(%s) failed: %v", backup.FilePath, err)
+		}
+		data, _ := io.ReadAll(file)
+		file.Close()
+		if string(data) != "-- MySQL dump\n" {
+			t.Errorf("OpenBackupFile(%s) = %q", backup.FilePath, data)
+		}
+	}
+
+	// Only the holder of the identity can read files for a recipient
+	backup := write("recipient.sql.enc", identity.Recipient())
+	if _, err := restorer.OpenBackupFile(ctx, backup); err == nil || !strings.Contains(err.Error(), "decrypted offline") {
+		t.Errorf("Expected offline decryption error, got %v", err)
+	}
+	file, err := restorer.OpenStoredBackupFile(ctx, backup)
+	if err != nil {
+		t.Fatalf("OpenStoredBackupFile failed: %v", err)
+	}
+	plain, err := filecrypt.NewReader(file, identity)
+	if err != nil {
+		t.Fatalf("Decrypting with the identity failed: %v", err)
+	}
+	data, _ := io.ReadAll(plain)
+	file.Close()
+	if string(data) != "-- MySQL dump\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+}
+
+func TestIsCompressed(t *testing.T) {
+	tests := map[string]bool{
+		"file:///data/a.sql.gz":     true,
+		"file:///data/a.sql.gz.enc": true,
+		"file:///data/a.sql.enc":    false,
+		"/data/a.sql":               false,
+	}
+	for path, expected := range tests {
+		if got := IsCompressed(&store.Backup{FilePath: path}); got != expected {
+			t.Errorf("IsCompressed(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
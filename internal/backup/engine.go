@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// Engine dumps and restores the databases of one kind of server. Dumps are
+// files that only the engine that wrote them restores: SQL scripts, or for
+// SQLite a copy of the database file. The Dumper and
+// Restorer take care of everything else: backup records, compression,
+// encryption, storage and retention.
+type Engine interface {
+	// Ping checks that the server can be reached and logged into.
+	Ping(ctx context.Context, conn dbconn.Options) error
+
+	// ListDatabases returns the databases on the server, without the
+	// server's own.
+	ListDatabases(ctx context.Context, conn dbconn.Options) ([]string, error)
+
+	// Dump writes the database options.DatabaseName to w: the schema,
+	// data, or both, as options selects. Parallel dumps keep temporary
+	// files in tempDir.
+	Dump(ctx context.Context, conn dbconn.Options, w io.Writer, options *DumpOptions, tempDir string) (*DumpResult, error)
+
+	// CreateDatabase creates database unless it exists.
+	CreateDatabase(ctx context.Context, conn dbconn.Options, database string) error
+
+	// Restore runs the dump read from r in database, which must exist.
+	Restore(ctx context.Context, conn dbconn.Options, database string, r io.Reader) error
+}
+
+// EngineFor returns the Engine for a target's store.Engine* name; targets
+// from before engines have none and are MySQL targets. MySQL dumps are
+// written by d, the configured dumper.
+func EngineFor(name string, d *Dumper) (Engine, error) {
+	switch name {
+	case "", store.EngineMySQL:
+		if d == nil {
+			return nil, fmt.Errorf("mysql engine needs a dumper")
+		}
+		return mysqlEngine{d: d}, nil
+	case store.EnginePostgres:
+		return postgresEngine{}, nil
+	case store.EngineSQLite:
+		return sqliteEngine{}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q", name)
+	}
+}
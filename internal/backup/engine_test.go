@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEngineFor(t *testing.T) {
+	tests := []struct {
+		engine   string
+		expected string
+		wantErr  bool
+	}{
+		{engine: "", expected: "backup.mysqlEngine"},
+		{engine: "mysql", expected: "backup.mysqlEngine"},
+		{engine: "postgres", expected: "backup.postgresEngine"},
+		{engine: "sqlite", expected: "backup.sqliteEngine"},
+		{engine: "oracle", wantErr: true},
+	}
+
+	dumper := NewDumper(nil, t.TempDir())
+	for _, tt := range tests {
+		engine, err := EngineFor(tt.engine, dumper)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("EngineFor(%q): expected error but got none", tt.engine)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EngineFor(%q): unexpected error: %v", tt.engine, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", engine); got != tt.expected {
+			t.Errorf("EngineFor(%q) = %s, expected %s", tt.engine, got, tt.expected)
+		}
+	}
+
+	if _, err := EngineFor("mysql", nil); err == nil {
+		t.Error("EngineFor(\"mysql\", nil): expected error but got none")
+	}
+}
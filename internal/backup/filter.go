@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// TableFilter selects the tables of a dump with glob patterns as understood
+// by path.Match. A pattern without a dot matches table names in every
+// database ("*_log"), a pattern with a dot matches "database.table"
+// ("orders.*").
+type TableFilter struct {
+	// Include, if not empty, limits the dump to matching tables
+	Include []string `json:"include,omitempty"`
+
+	// Exclude drops matching tables, even if they are included
+	Exclude []string `json:"exclude,omitempty"`
+
+	// SchemaOnly dumps the structure of matching tables without their rows
+	SchemaOnly []string `json:"schema_only,omitempty"`
+}
+
+// Validate reports the first malformed pattern.
+func (f TableFilter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude, f.SchemaOnly} {
+		for _, pattern := range patterns {
+			if strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("empty table pattern")
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether the filter keeps every table as it is.
+func (f TableFilter) IsEmpty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0 && len(f.SchemaOnly) == 0
+}
+
+// Includes reports whether table of database is dumped at all.
+func (f TableFilter) Includes(database, table string) bool {
+	if len(f.Include) > 0 && !matchTable(f.Include, database, table) {
+		return false
+	}
+	return !matchTable(f.Exclude, database, table)
+}
+
+// IsSchemaOnly reports whether the rows of table are left out.
+func (f TableFilter) IsSchemaOnly(database, table string) bool {
+	return matchTable(f.SchemaOnly, database, table)
+}
+
+// Merge returns f with the rules of override applied on top: a non-empty
+// include list replaces f's, excludes and schema-only tables add up.
+func (f TableFilter) Merge(override TableFilter) TableFilter {
+	merged := TableFilter{
+		Include:    f.Include,
+		Exclude:    append(append([]string(nil), f.Exclude...), override.Exclude...),
+		SchemaOnly: append(append([]string(nil), f.SchemaOnly...), override.SchemaOnly...),
+	}
+	if len(override.Include) > 0 {
+		merged.Include = override.Include
+	}
+	return merged
+}
+
+func matchTable(patterns []string, database, table string) bool {
+	for _, pattern := range patterns {
+		name := table
+		if strings.Contains(pattern, ".") {
+			name = database + "." + table
+		}
+		// Patterns are validated when saved, a bad one never matches
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetTableFilter reads the table rules stored with target.
+func TargetTableFilter(target *store.Target) (TableFilter, error) {
+	var filter TableFilter
+	fields := []struct {
+		name  string
+		value string
+		dest  *[]string
+	}{
+		{"include tables", target.IncludeTables, &filter.Include},
+		{"exclude tables", target.ExcludeTables, &filter.Exclude},
+		{"schema only tables", target.SchemaOnlyTables, &filter.SchemaOnly},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.value), field.dest); err != nil {
+			return TableFilter{}, fmt.Errorf("failed to parse %s: %w", field.name, err)
+		}
+	}
+	return filter, nil
+}
+
+// filterTables splits tables into the ones f keeps and the ones it drops.
+func (f TableFilter) filterTables(database string, tables []string) (kept, excluded []string) {
+	for _, table := range tables {
+		if f.Includes(database, table) {
+			kept = append(kept, table)
+		} else {
+			excluded = append(excluded, table)
+		}
+	}
+	return kept, excluded
+}
@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+func TestTableFilterIncludes(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   TableFilter
+		database string
+		table    string
+		expected bool
+	}{
+		{name: "empty filter", database: "shop", table: "users", expected: true},
+		{
+			name:     "excluded suffix",
+			filter:   TableFilter{Exclude: []string{"*_log", "cache_*"}},
+			database: "shop", table: "access_log",
+			expected: false,
+		},
+		{
+			name:     "excluded prefix",
+			filter:   TableFilter{Exclude: []string{"*_log", "cache_*"}},
+			database: "shop", table: "cache_pages",
+			expected: false,
+		},
+		{
+			name:     "not excluded",
+			filter:   TableFilter{Exclude: []string{"*_log", "cache_*"}},
+			database: "shop", table: "logins",
+			expected: true,
+		},
+		{
+			name:     "included by database pattern",
+			filter:   TableFilter{Include: []string{"orders.*"}},
+			database: "orders", table: "items",
+			expected: true,
+		},
+		{
+			name:     "other database not included",
+			filter:   TableFilter{Include: []string{"orders.*"}},
+			database: "shop", table: "items",
+			expected: false,
+		},
+		{
+			name:     "exclude wins over include",
+			filter:   TableFilter{Include: []string{"orders.*"}, Exclude: []string{"orders.tmp_*"}},
+			database: "orders", table: "tmp_import",
+			expected: false,
+		},
+		{
+			name:     "character class",
+			filter:   TableFilter{Include: []string{"events_202[34]"}},
+			database: "shop", table: "events_2024",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Includes(tt.database, tt.table); got != tt.expected {
+				t.Errorf("Includes(%q, %q) = %v, expected %v", tt.database, tt.table, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTableFilterSchemaOnly(t *testing.T) {
+	filter := TableFilter{SchemaOnly: []string{"sessions", "shop.audit_*"}}
+
+	if !filter.IsSchemaOnly("any", "sessions") {
+		t.Error("Expected sessions to be schema only")
+	}
+	if !filter.IsSchemaOnly("shop", "audit_2024") {
+		t.Error("Expected shop.audit_2024 to be schema only")
+	}
+	if filter.IsSchemaOnly("other", "audit_2024") {
+		t.Error("Expected other.audit_2024 to keep its rows")
+	}
+}
+
+func TestTableFilterMerge(t *testing.T) {
+	target := TableFilter{Include: []string{"a*"}, Exclude: []string{"*_log"}, SchemaOnly: []string{"sessions"}}
+
+	merged := target.Merge(TableFilter{Exclude: []string{"cache_*"}})
+	expected := TableFilter{Include: []string{"a*"}, Exclude: []string{"*_log", "cache_*"}, SchemaOnly: []string{"sessions"}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Merge = %+v, expected %+v", merged, expected)
+	}
+
+	merged = target.Merge(TableFilter{Include: []string{"orders.*"}})
+	if !reflect.DeepEqual(merged.Include, []string{"orders.*"}) {
+		t.Errorf("Expected job include list to replace the target's, got %v", merged.Include)
+	}
+	if !reflect.DeepEqual(target.Exclude, []string{"*_log"}) {
+		t.Errorf("Merge modified the original filter: %v", target.Exclude)
+	}
+}
+
+func TestTableFilterValidate(t *testing.T) {
+	if err := (TableFilter{Include: []string{"orders.*"}, Exclude: []string{"*_log"}}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := (TableFilter{Exclude: []string{"[abc"}}).Validate(); err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+	if err := (TableFilter{SchemaOnly: []string{" "}}).Validate(); err == nil {
+		t.Error("Expected error for empty pattern")
+	}
+}
+
+func TestTargetTableFilter(t *testing.T) {
+	target := &store.Target{
+		ExcludeTables:    `["*_log"]`,
+		SchemaOnlyTables: `["sessions"]`,
+	}
+
+	filter, err := TargetTableFilter(target)
+	if err != nil {
+		t.Fatalf("TargetTableFilter failed: %v", err)
+	}
+	expected := TableFilter{Exclude: []string{"*_log"}, SchemaOnly: []string{"sessions"}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("TargetTableFilter = %+v, expected %+v", filter, expected)
+	}
+
+	target.IncludeTables = "not json"
+	if _, err := TargetTableFilter(target); err == nil {
+		t.Error("Expected error for malformed include list")
+	}
+}
@@ -0,0 +1,125 @@
+//go:build integration
+// +build integration
+
+package backup
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+func TestIntegrationSQLiteBackupAndRestore(t *testing.T) {
+	_, repo, dumper, restorer := setupIntegrationTest(t)
+
+	path := filepath.Join(sqliteTargetDir(t), "app.db")
+	createSQLiteFile(t, path,
+		"CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)",
+		"INSERT INTO notes (body) VALUES ('first'), ('second')",
+	)
+
+	target := &store.Target{
+		Name:          "Test SQLite",
+		Engine:        store.EngineSQLite,
+		Path:          path,
+		RetentionDays: 7,
+		AutoCompress:  true,
+		DatabaseMode:  store.DatabaseModeAll,
+	}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	backup, err := dumper.CreateBackup(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	completed := waitForBackup(t, repo, backup)
+	if completed.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completed.Notes)
+	}
+	if completed.DatabaseName != "main" {
+		t.Errorf("Expected database main, got %s", completed.DatabaseName)
+	}
+	if !strings.HasSuffix(completed.FilePath, ".sqlite.gz") {
+		t.Errorf("Expected a compressed SQLite file, got %s", completed.FilePath)
+	}
+	if content := readBackupFile(t, completed.FilePath); !strings.HasPrefix(content, "SQLite format 3\x00") {
+		t.Error("Backup file is not a SQLite database")
+	}
+
+	backups, err := repo.GetBackupsByTarget(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("Expected the backup to be listed for the target, got %d", len(backups))
+	}
+
+	createSQLiteFile(t, path, "DELETE FROM notes", "CREATE TABLE added (id INTEGER)")
+	if err := restorer.RestoreBackup(ctx, backup.ID); err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+
+	notes := querySQLite(t, path, "SELECT body FROM notes ORDER BY id")
+	if len(notes) != 2 || notes[0] != "first" || notes[1] != "second" {
+		t.Errorf("Unexpected restored rows %v", notes)
+	}
+	if tables := querySQLite(t, path, "SELECT name FROM sqlite_master WHERE name = 'added'"); len(tables) != 0 {
+		t.Error("Expected the restore to replace the whole file")
+	}
+}
+
+func TestIntegrationSQLiteRunBackup(t *testing.T) {
+	_, repo, dumper, _ := setupIntegrationTest(t)
+
+	path := filepath.Join(sqliteTargetDir(t), "app.db")
+	createSQLiteFile(t, path, "CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)")
+
+	target := &store.Target{
+		Name:          "Test SQLite run",
+		Engine:        store.EngineSQLite,
+		Path:          path,
+		RetentionDays: 7,
+		DatabaseMode:  store.DatabaseModeAll,
+	}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// RunBackup returns finished backups
+	backups, err := dumper.RunBackup(ctx, target.ID, FullBackup)
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Status != store.BackupStatusSuccess || backups[0].FinishedAt == nil {
+		t.Fatalf("Expected one finished backup, got %+v", backups)
+	}
+	stored, err := repo.GetBackup(backups[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != store.BackupStatusSuccess {
+		t.Errorf("Expected the stored backup to be finished, got %s", stored.Status)
+	}
+
+	// A dump that fails after the backup was started is reported as failed
+	// by the time RunBackup returns
+	backups, err = dumper.RunBackup(ctx, target.ID, RunOptions{IncludeData: true})
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Status != store.BackupStatusFailed || backups[0].Notes == "" {
+		t.Errorf("Expected a failed backup with notes, got %+v", backups)
+	}
+}
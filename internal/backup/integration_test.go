@@ -4,16 +4,19 @@
 package backup
 
 import (
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/casparjones/go-dumper/internal/storage"
 	"github.com/casparjones/go-dumper/internal/store"
 	"github.com/go-sql-driver/mysql"
 
@@ -170,6 +173,33 @@ func setupMySQLTarget(t *testing.T, repo *store.Repository) *store.Target {
 	return target
 }
 
+// readBackupFile returns the SQL text of a (possibly gzipped) backup file.
+func readBackupFile(t *testing.T, uri string) string {
+	t.Helper()
+
+	file, err := storage.NewResolver().Open(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(uri, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
 func TestIntegrationBackupAndRestore(t *testing.T) {
 	_, repo, dumper, restorer := setupIntegrationTest(t)
 	target := setupMySQLTarget(t, repo)
@@ -205,12 +235,16 @@ func TestIntegrationBackupAndRestore(t *testing.T) {
 	}
 
 	// Verify backup file exists
-	if _, err := os.Stat(completedBackup.FilePath); os.IsNotExist(err) {
+	path, ok := storage.FilePath(completedBackup.FilePath)
+	if !ok {
+		t.Fatalf("Expected a local backup file, got %s", completedBackup.FilePath)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
 		t.Fatalf("Backup file does not exist: %s", completedBackup.FilePath)
 	}
 
 	// Verify backup file is not empty
-	info, err := os.Stat(completedBackup.FilePath)
+	info, err := os.Stat(path)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -223,6 +257,19 @@ func TestIntegrationBackupAndRestore(t *testing.T) {
 		t.Errorf("Size mismatch: database shows %d, file is %d", completedBackup.SizeBytes, info.Size())
 	}
 
+	// Verify the dump contains the schema and rows of the test table
+	dump := readBackupFile(t, completedBackup.FilePath)
+	for _, want := range []string{
+		"CREATE TABLE `test_users`",
+		"INSERT INTO `test_users`",
+		"john@example.com",
+		"SET FOREIGN_KEY_CHECKS=1;",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Backup file missing %q", want)
+		}
+	}
+
 	// Test restore
 	err = restorer.RestoreBackup(ctx, backup.ID)
 	if err != nil {
@@ -232,6 +279,843 @@ func TestIntegrationBackupAndRestore(t *testing.T) {
 	t.Logf("Integration test completed successfully. Backup size: %d bytes", completedBackup.SizeBytes)
 }
 
+func TestIntegrationBackupContent(t *testing.T) {
+	_, repo, dumper, _ := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	tests := []struct {
+		name    string
+		run     RunOptions
+		kind    string
+		present string
+		absent  string
+	}{
+		{
+			name:    "structure only",
+			run:     RunOptions{IncludeStructure: true},
+			kind:    store.BackupKindStructure,
+			present: "CREATE TABLE `test_users`",
+			absent:  "INSERT INTO `test_users`",
+		},
+		{
+			name:    "data only",
+			run:     RunOptions{IncludeData: true},
+			kind:    store.BackupKindData,
+			present: "INSERT INTO `test_users`",
+			absent:  "CREATE TABLE `test_users`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			backup, err := dumper.CreateBackupWithOptions(ctx, target.ID, tt.run)
+			if err != nil {
+				t.Fatalf("Failed to create backup: %v", err)
+			}
+
+			var completedBackup *store.Backup
+			for i := 0; i < 30; i++ {
+				time.Sleep(1 * time.Second)
+				completedBackup, err = repo.GetBackup(backup.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if completedBackup.Status != store.BackupStatusRunning {
+					break
+				}
+			}
+
+			if completedBackup.Status != store.BackupStatusSuccess {
+				t.Fatalf("Backup failed: %s", completedBackup.Notes)
+			}
+			if completedBackup.Kind != tt.kind {
+				t.Errorf("Expected backup kind %q, got %q", tt.kind, completedBackup.Kind)
+			}
+
+			dump := readBackupFile(t, completedBackup.FilePath)
+			if !strings.Contains(dump, tt.present) {
+				t.Errorf("Backup file missing %q", tt.present)
+			}
+			if strings.Contains(dump, tt.absent) {
+				t.Errorf("Backup file unexpectedly contains %q", tt.absent)
+			}
+		})
+	}
+}
+
+func TestIntegrationRunOverrides(t *testing.T) {
+	_, repo, dumper, restorer := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	// The target selects no database and compresses; the run overrides both
+	target.DatabaseMode = store.DatabaseModeSelected
+	target.SelectedDatabases = `["does_not_exist"]`
+	target.AutoCompress = true
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	compress := false
+	backup, err := dumper.CreateBackupWithOptions(ctx, target.ID, RunOptions{
+		IncludeStructure: true,
+		IncludeData:      true,
+		Databases:        databases[:1],
+		Compress:         &compress,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 30; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+	if completedBackup.DatabaseName != databases[0] {
+		t.Errorf("Expected backup of %s, got %s", databases[0], completedBackup.DatabaseName)
+	}
+	if strings.HasSuffix(completedBackup.FilePath, ".gz") {
+		t.Errorf("Expected uncompressed backup, got %s", completedBackup.FilePath)
+	}
+
+	if err := restorer.RestoreBackup(ctx, backup.ID); err != nil {
+		t.Fatalf("Failed to restore uncompressed backup: %v", err)
+	}
+}
+
+func TestIntegrationTableFilter(t *testing.T) {
+	_, repo, dumper, _ := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	target.ExcludeTables = `["*_log"]`
+	target.SchemaOnlyTables = `["filter_sessions"]`
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tables := []string{"filter_access_log", "filter_sessions"}
+	for _, table := range tables {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INT PRIMARY KEY, label VARCHAR(50))", table)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("REPLACE INTO %s VALUES (1, '%s row')", table, table)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, table := range tables {
+			db.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+table)
+		}
+	}()
+
+	// The job adds an exclude rule on top of the target's
+	backup, err := dumper.CreateBackupWithOptions(ctx, target.ID, RunOptions{
+		IncludeStructure: true,
+		IncludeData:      true,
+		Tables:           TableFilter{Exclude: []string{"test_*"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 60; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+
+	dump := readBackupFile(t, completedBackup.FilePath)
+	for _, absent := range []string{"`filter_access_log`", "`test_users`", "filter_sessions row"} {
+		if strings.Contains(dump, absent) {
+			t.Errorf("Backup file unexpectedly contains %s", absent)
+		}
+	}
+	if !strings.Contains(dump, "CREATE TABLE `filter_sessions`") {
+		t.Error("Backup file missing structure of schema-only table")
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal([]byte(completedBackup.Metadata), &metadata); err != nil {
+		t.Fatalf("Failed to parse backup metadata: %v", err)
+	}
+	if len(metadata.SchemaOnlyTables) != 1 || metadata.SchemaOnlyTables[0] != "filter_sessions" {
+		t.Errorf("Unexpected schema-only tables in metadata: %v", metadata.SchemaOnlyTables)
+	}
+	for _, excluded := range []string{"filter_access_log", "test_users"} {
+		found := false
+		for _, table := range metadata.ExcludedTables {
+			found = found || table == excluded
+		}
+		if !found {
+			t.Errorf("Metadata does not list %s as excluded: %v", excluded, metadata.ExcludedTables)
+		}
+	}
+}
+
+func TestIntegrationSanitizedDump(t *testing.T) {
+	_, repo, dumper, _ := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS sanitize_customers (id INT PRIMARY KEY, email VARCHAR(100), phone VARCHAR(20), active TINYINT)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.ExecContext(context.Background(), "DROP TABLE IF EXISTS sanitize_customers")
+
+	if _, err := db.ExecContext(ctx, `REPLACE INTO sanitize_customers VALUES
+		(1, 'alice@real.example', '555-0101', 1),
+		(2, 'bob@real.example', NULL, 1),
+		(3, 'carol@real.example', '555-0103', 0)`); err != nil {
+		t.Fatal(err)
+	}
+
+	profile := &store.SanitizeProfile{
+		Name:  "customers",
+		Rules: `{"tables":[{"table":"sanitize_customers","where":"active = 1","masks":{"email":{"type":"email"},"phone":{"type":"fixed","value":"000"}}}]}`,
+	}
+	if err := repo.CreateSanitizeProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+
+	run := FullBackup
+	run.Tables = TableFilter{Include: []string{"sanitize_customers"}}
+	run.SanitizeProfileID = profile.ID
+	backup, err := dumper.CreateBackupWithOptions(ctx, target.ID, run)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 60; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+
+	dump := readBackupFile(t, completedBackup.FilePath)
+	for _, absent := range []string{"real.example", "555-01", "(3, "} {
+		if strings.Contains(dump, absent) {
+			t.Errorf("Backup file unexpectedly contains %s", absent)
+		}
+	}
+	if !strings.Contains(dump, "(1, 'user-") || !strings.Contains(dump, "'000'") {
+		t.Error("Backup file missing masked values")
+	}
+	if !strings.Contains(dump, "@example.com', NULL, ") {
+		t.Error("Expected NULL phone to stay NULL")
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal([]byte(completedBackup.Metadata), &metadata); err != nil {
+		t.Fatalf("Failed to parse backup metadata: %v", err)
+	}
+	if metadata.SanitizeProfile != "customers" {
+		t.Errorf("Expected sanitize profile in metadata, got %q", metadata.SanitizeProfile)
+	}
+
+	// A job whose profile is gone must not fall back to an unsanitized dump
+	if err := repo.DeleteSanitizeProfile(profile.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dumper.CreateBackupWithOptions(ctx, target.ID, run); err == nil {
+		t.Error("Expected error for deleted sanitize profile")
+	}
+}
+
+func TestIntegrationSanitizeColumnNames(t *testing.T) {
+	_, repo, dumper, _ := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{name: "mis-cased column", rules: `{"tables":[{"table":"test_users","masks":{"EMAIL":{"type":"fixed","value":"masked"}}}]}`},
+		{name: "unknown column", rules: `{"tables":[{"table":"test_users","masks":{"e_mail":{"type":"null"}}}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := &store.SanitizeProfile{Name: tt.name, Rules: tt.rules}
+			if err := repo.CreateSanitizeProfile(profile); err != nil {
+				t.Fatal(err)
+			}
+
+			run := FullBackup
+			run.Tables = TableFilter{Include: []string{"test_users"}}
+			run.SanitizeProfileID = profile.ID
+			backups, err := dumper.RunBackup(ctx, target.ID, run)
+			if err != nil {
+				t.Fatalf("Failed to run backup: %v", err)
+			}
+			backup := backups[0]
+
+			if tt.wantErr {
+				if backup.Status != store.BackupStatusFailed || !strings.Contains(backup.Notes, "e_mail") || !strings.Contains(backup.Notes, "test_users") {
+					t.Errorf("Expected the backup to fail naming the column and table, got %s: %s", backup.Status, backup.Notes)
+				}
+				return
+			}
+			if backup.Status != store.BackupStatusSuccess {
+				t.Fatalf("Backup failed: %s", backup.Notes)
+			}
+			dump := readBackupFile(t, backup.FilePath)
+			if strings.Contains(dump, "john@example.com") || !strings.Contains(dump, "'masked'") {
+				t.Error("Expected the mis-cased column to be masked")
+			}
+		})
+	}
+}
+
+func TestIntegrationStoredPrograms(t *testing.T) {
+	_, repo, dumper, restorer := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	target.IncludeRoutines = true
+	target.IncludeTriggers = true
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		ParseTime:            true,
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, stmt := range []string{
+		"DROP PROCEDURE IF EXISTS count_test_users",
+		"CREATE PROCEDURE count_test_users() BEGIN\n  -- statements inside the body end in semicolons\n  SELECT COUNT(*) FROM test_users;\nEND",
+		"DROP TRIGGER IF EXISTS test_users_lower_email",
+		"CREATE TRIGGER test_users_lower_email BEFORE INSERT ON test_users FOR EACH ROW SET NEW.email = LOWER(NEW.email)",
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("Failed to create stored program: %v", err)
+		}
+	}
+
+	backup, err := dumper.CreateBackup(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 30; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+
+	dump := readBackupFile(t, completedBackup.FilePath)
+	for _, want := range []string{"DELIMITER ;;", "PROCEDURE `count_test_users`", "TRIGGER `test_users_lower_email`"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Backup file missing %q", want)
+		}
+	}
+
+	// Drop the programs so the restore has to recreate them
+	db.ExecContext(ctx, "DROP PROCEDURE count_test_users")
+	db.ExecContext(ctx, "DROP TRIGGER test_users_lower_email")
+
+	if err := restorer.RestoreBackup(ctx, backup.ID); err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+
+	var routines, triggers int
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.routines WHERE routine_schema = DATABASE() AND routine_name = 'count_test_users'").Scan(&routines)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.triggers WHERE trigger_schema = DATABASE() AND trigger_name = 'test_users_lower_email'").Scan(&triggers)
+	if routines != 1 || triggers != 1 {
+		t.Errorf("Stored programs not restored: routines=%d triggers=%d", routines, triggers)
+	}
+}
+
+func TestIntegrationParallelDump(t *testing.T) {
+	_, repo, dumper, restorer := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	target.Parallelism = 3
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		ParseTime:            true,
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tables := []string{"parallel_a", "parallel_b", "parallel_c", "parallel_d"}
+	for _, table := range tables {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INT PRIMARY KEY, label VARCHAR(50))", table)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("REPLACE INTO %s VALUES (1, '%s row')", table, table)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, table := range tables {
+			db.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+table)
+		}
+	}()
+
+	backup, err := dumper.CreateBackup(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 60; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+
+	// Tables must appear in the same order as in a sequential dump
+	dump := readBackupFile(t, completedBackup.FilePath)
+	last := -1
+	for _, table := range tables {
+		pos := strings.Index(dump, "CREATE TABLE `"+table+"`")
+		if pos < 0 {
+			t.Fatalf("Backup file missing table %s", table)
+		}
+		if pos < last {
+			t.Errorf("Table %s is out of order", table)
+		}
+		last = pos
+		if !strings.Contains(dump, table+" row") {
+			t.Errorf("Backup file missing data of table %s", table)
+		}
+	}
+
+	if err := restorer.RestoreBackup(ctx, backup.ID); err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+}
+
+func TestIntegrationChunkedDump(t *testing.T) {
+	_, repo, dumper, restorer := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	target.ChunkSize = 10
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		ParseTime:            true,
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Composite key so chunks continue in the middle of a tenant
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS chunked (tenant_id INT, id INT, label VARCHAR(50), PRIMARY KEY (tenant_id, id))"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.ExecContext(context.Background(), "DROP TABLE IF EXISTS chunked")
+
+	const rowCount = 25
+	for i := 0; i < rowCount; i++ {
+		if _, err := db.ExecContext(ctx, "REPLACE INTO chunked VALUES (?, ?, ?)", i%3, i, fmt.Sprintf("chunk row %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backup, err := dumper.CreateBackup(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 60; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+
+	dump := readBackupFile(t, completedBackup.FilePath)
+	for i := 0; i < rowCount; i++ {
+		if !strings.Contains(dump, fmt.Sprintf("'chunk row %d'", i)) {
+			t.Errorf("Backup file missing row %d", i)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM chunked"); err != nil {
+		t.Fatal(err)
+	}
+	if err := restorer.RestoreBackup(ctx, backup.ID); err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+
+	var restored int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunked").Scan(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored != rowCount {
+		t.Errorf("Expected %d rows after restore, got %d", rowCount, restored)
+	}
+}
+
+func TestIntegrationChunkedDumpCaseInsensitiveKey(t *testing.T) {
+	_, repo, dumper, _ := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	target.ChunkSize = 2
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// The collation orders a before B, byte order the other way round
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS chunked_ci (code VARCHAR(20) COLLATE utf8mb4_general_ci PRIMARY KEY) DEFAULT CHARSET = utf8mb4"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.ExecContext(context.Background(), "DROP TABLE IF EXISTS chunked_ci")
+
+	codes := []string{"a", "B", "c", "D", "e", "F", "g", "Z"}
+	for _, code := range codes {
+		if _, err := db.ExecContext(ctx, "REPLACE INTO chunked_ci VALUES (?)", code); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := FullBackup
+	run.Tables = TableFilter{Include: []string{"chunked_ci"}}
+	backups, err := dumper.RunBackup(ctx, target.ID, run)
+	if err != nil {
+		t.Fatalf("Failed to run backup: %v", err)
+	}
+	if backups[0].Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", backups[0].Notes)
+	}
+
+	dump := readBackupFile(t, backups[0].FilePath)
+	for _, code := range codes {
+		if n := strings.Count(dump, "('"+code+"')"); n != 1 {
+			t.Errorf("Expected row %s once in the dump, found it %d times", code, n)
+		}
+	}
+}
+
+func TestIntegrationValueTypes(t *testing.T) {
+	_, repo, dumper, restorer := setupIntegrationTest(t)
+	target := setupMySQLTarget(t, repo)
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var databases []string
+	if err := json.Unmarshal([]byte(target.SelectedDatabases), &databases); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := mysql.Config{
+		User:                 target.User,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%s:%d", target.Host, target.Port),
+		DBName:               databases[0],
+		AllowNativePasswords: true,
+	}
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS value_types (
+		id INT PRIMARY KEY,
+		bin_col VARBINARY(16),
+		blob_col BLOB,
+		dec_col DECIMAL(30,10),
+		dbl_col DOUBLE,
+		dt_col DATETIME(6),
+		ts_col TIMESTAMP(3) NULL,
+		bit_col BIT(10),
+		json_col JSON,
+		geo_col GEOMETRY
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	defer db.ExecContext(context.Background(), "DROP TABLE IF EXISTS value_types")
+
+	if _, err := db.ExecContext(ctx, `REPLACE INTO value_types VALUES
+		(1, 0x00275C22FF0A, 0x1A0D0900, 12345678901234567890.0123456789, 0.1, '2024-02-29 23:59:59.123456',
+		 '2024-01-01 12:00:00.5', b'1000000001', '{"quote": "it''s", "nested": [1, 2.5, null]}', ST_GeomFromText('POINT(1 2)')),
+		(2, '', NULL, -0.0000000001, 1.7976931348623157e308, '1000-01-01 00:00:00', NULL, b'0', 'null', NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := func() string {
+		var result string
+		query := `SELECT GROUP_CONCAT(CONCAT_WS('|', id, HEX(bin_col), HEX(blob_col), dec_col, dbl_col, dt_col,
+			ts_col, bit_col+0, json_col, HEX(geo_col)) ORDER BY id SEPARATOR '\n') FROM value_types`
+		if err := db.QueryRowContext(ctx, query).Scan(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	before := fingerprint()
+
+	backup, err := dumper.CreateBackup(ctx, target.ID)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	var completedBackup *store.Backup
+	for i := 0; i < 60; i++ {
+		time.Sleep(1 * time.Second)
+		completedBackup, err = repo.GetBackup(backup.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completedBackup.Status != store.BackupStatusRunning {
+			break
+		}
+	}
+
+	if completedBackup.Status != store.BackupStatusSuccess {
+		t.Fatalf("Backup failed: %s", completedBackup.Notes)
+	}
+
+	dump := readBackupFile(t, completedBackup.FilePath)
+	if !strings.Contains(dump, "0x00275C22FF0A") {
+		t.Error("Binary column not written as hex literal")
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM value_types"); err != nil {
+		t.Fatal(err)
+	}
+	if err := restorer.RestoreBackup(ctx, backup.ID); err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+
+	if after := fingerprint(); after != before {
+		t.Errorf("Values changed by backup and restore:\nBefore:\n%s\nAfter:\n%s", before, after)
+	}
+}
+
 func TestIntegrationLargeDataset(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping large dataset test in short mode")
@@ -0,0 +1,45 @@
+package backup
+
+// Metadata is stored as JSON with every successful backup and describes what
+// its dump contains.
+type Metadata struct {
+	// TableFilter is the filter the dump was taken with, if any
+	TableFilter *TableFilter `json:"table_filter,omitempty"`
+
+	// Tables are the tables in the dump, ExcludedTables those left out
+	Tables         []string `json:"tables"`
+	ExcludedTables []string `json:"excluded_tables,omitempty"`
+
+	// SchemaOnlyTables are dumped without their rows
+	SchemaOnlyTables []string `json:"schema_only_tables,omitempty"`
+
+	// SanitizeProfile is the name of the sanitize profile applied, if any
+	SanitizeProfile string `json:"sanitize_profile,omitempty"`
+
+	// Encryption is the Encryption mode the file was written with, if any
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// DumpResult is what dumpDatabase reports about a finished dump.
+type DumpResult struct {
+	Size             int64
+	Tables           []string
+	ExcludedTables   []string
+	SchemaOnlyTables []string
+}
+
+func (r *DumpResult) metadata(options *DumpOptions) *Metadata {
+	metadata := &Metadata{
+		Tables:           r.Tables,
+		ExcludedTables:   r.ExcludedTables,
+		SchemaOnlyTables: r.SchemaOnlyTables,
+	}
+	if metadata.Tables == nil {
+		metadata.Tables = []string{}
+	}
+	if !options.Tables.IsEmpty() {
+		filter := options.Tables
+		metadata.TableFilter = &filter
+	}
+	return metadata
+}
@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlErrEmptyQuery is ER_EMPTY_QUERY, returned for statements that are
+// only comments.
+const mysqlErrEmptyQuery = 1065
+
+// mysqlEngine is the Engine of MySQL and MariaDB targets. The dump itself is
+// written by d, the dumper the engine was made for.
+type mysqlEngine struct {
+	d *Dumper
+}
+
+// open connects to the server of conn without selecting a database.
+func (e mysqlEngine) open(ctx context.Context, conn dbconn.Options) (*dbconn.DB, error) {
+	conn.Database = ""
+	conn.Params = map[string]string{"charset": "utf8mb4"}
+	conn.ParseTime = true
+
+	db, err := dbconn.Open(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
+	}
+	return db, nil
+}
+
+func (e mysqlEngine) Ping(ctx context.Context, conn dbconn.Options) error {
+	db, err := e.open(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func (e mysqlEngine) ListDatabases(ctx context.Context, conn dbconn.Options) ([]string, error) {
+	db, err := e.open(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return e.d.getAllDatabases(db.DB)
+}
+
+func (e mysqlEngine) Dump(ctx context.Context, conn dbconn.Options, w io.Writer, options *DumpOptions, tempDir string) (*DumpResult, error) {
+	return e.d.dumpMySQL(ctx, conn, w, options, tempDir)
+}
+
+func (e mysqlEngine) CreateDatabase(ctx context.Context, conn dbconn.Options, dbName string) error {
+	db, err := e.open(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Set a longer timeout for the connection
+	db.SetConnMaxLifetime(30 * time.Second)
+	db.SetMaxOpenConns(1)
+
+	// Check if database exists
+	var exists bool
+	query := "SELECT EXISTS(SELECT 1 FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?)"
+	err = db.QueryRowContext(ctx, query, dbName).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if database exists: %w", err)
+	}
+
+	// Create database if it doesn't exist
+	if !exists {
+		createQuery := fmt.Sprintf("CREATE DATABASE `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", dbName)
+		_, err = db.ExecContext(ctx, createQuery)
+		if err != nil {
+			return fmt.Errorf("failed to create database '%s': %w", dbName, err)
+		}
+	}
+
+	return nil
+}
+
+func (e mysqlEngine) Restore(ctx context.Context, conn dbconn.Options, dbName string, reader io.Reader) error {
+	conn.Database = dbName
+	conn.Params = map[string]string{
+		"charset":         "utf8mb4",
+		"multiStatements": "true",
+	}
+	conn.ParseTime = true
+
+	db, err := dbconn.Open(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	defer db.Close()
+
+	// Set connection settings to avoid timeouts
+	db.SetConnMaxLifetime(30 * time.Second)
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping MySQL: %w", err)
+	}
+
+	// Verify that the target database exists
+	if err := e.verifyDatabaseExists(ctx, db.DB, dbName); err != nil {
+		return fmt.Errorf("database verification failed: %w", err)
+	}
+
+	return e.executeSQLFile(ctx, db.DB, reader)
+}
+
+func (e mysqlEngine) verifyDatabaseExists(ctx context.Context, db *sql.DB, dbName string) error {
+	var exists bool
+	query := "SELECT EXISTS(SELECT 1 FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?)"
+
+	err := db.QueryRowContext(ctx, query, dbName).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if database exists: %w", err)
+	}
+
+	if !exists {
+		return fmt.Errorf("target database '%s' does not exist - please create it first or enable 'Create database if it doesn't exist' option", dbName)
+	}
+
+	return nil
+}
+
+func (e mysqlEngine) executeSQLFile(ctx context.Context, db *sql.DB, reader io.Reader) error {
+	// Session settings from the dump header (foreign key checks, sql_mode, ...)
+	// must apply to every statement, so all of them run on one connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	scanner := newStatementScanner(reader)
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading SQL file: %w", err)
+		}
+
+		if err := e.executeStatement(ctx, conn, stmt.SQL); err != nil {
+			return fmt.Errorf("error at line %d (byte offset %d): %w\nStatement: %s",
+				stmt.Line, stmt.Offset, err, stmt.SQL[:min(len(stmt.SQL), 100)])
+		}
+	}
+}
+
+func (e mysqlEngine) executeStatement(ctx context.Context, q querier, statement string) error {
+	statement = strings.TrimSpace(statement)
+	if statement == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(strings.ToUpper(statement), "LOCK TABLES") ||
+		strings.HasPrefix(strings.ToUpper(statement), "UNLOCK TABLES") {
+		return nil
+	}
+
+	_, err := q.ExecContext(ctx, statement)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		// A version comment for a newer server than ours leaves nothing to run
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrEmptyQuery {
+			return nil
+		}
+		if strings.Contains(err.Error(), "Unknown database") {
+			return fmt.Errorf("database does not exist - please create it first: %w", err)
+		}
+		if strings.Contains(err.Error(), "Access denied") {
+			return fmt.Errorf("access denied - check user permissions: %w", err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,227 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// listTablesFunc returns the tables to dump, as read through q.
+type listTablesFunc func(ctx context.Context, q querier) ([]string, error)
+
+// startSnapshots starts the snapshot transaction on conn, lists the tables to
+// dump with listTables inside it and, when more than one table should be
+// dumped at a time, starts snapshots on additional worker connections.
+// Workers only share conn's snapshot if they start it while writes are
+// blocked; when that is not permitted the dump falls back to conn alone.
+func (d *Dumper) startSnapshots(ctx context.Context, db *sql.DB, conn *sql.Conn, listTables listTablesFunc, parallelism int) ([]*sql.Conn, []string, error) {
+	conns := []*sql.Conn{conn}
+	if parallelism <= 1 {
+		tables, err := d.snapshotTables(ctx, conn, listTables)
+		return conns, tables, err
+	}
+
+	lockConn, err := db.Conn(ctx)
+	if err != nil {
+		log.Printf("Parallel dump not possible, dumping tables sequentially: %v", err)
+		tables, err := d.snapshotTables(ctx, conn, listTables)
+		return conns, tables, err
+	}
+	defer func() {
+		lockConn.ExecContext(context.Background(), "UNLOCK TABLES")
+		lockConn.Close()
+	}()
+
+	// With every table held still, the tables listed in the snapshot are the
+	// tables of every worker's snapshot
+	_, flushErr := lockConn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	if flushErr == nil {
+		tables, err := d.snapshotTables(ctx, conn, listTables)
+		if err != nil {
+			return nil, nil, err
+		}
+		conns, err = d.startWorkers(ctx, db, conn, min(parallelism, len(tables)))
+		return conns, tables, err
+	}
+
+	// LOCK TABLES, which needs no RELOAD privilege, has to name the tables
+	// before the snapshot starts. They are listed again inside it, and the
+	// dump fails if they changed in between.
+	tables, err := listTables(ctx, conn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	workers := min(parallelism, len(tables))
+	if workers <= 1 {
+		tables, err := d.snapshotTables(ctx, conn, listTables)
+		return conns, tables, err
+	}
+	if err := lockTables(ctx, lockConn, tables); err != nil {
+		log.Printf("Parallel dump not possible, dumping tables sequentially: %v; %v", flushErr, err)
+		tables, err := d.snapshotTables(ctx, conn, listTables)
+		return conns, tables, err
+	}
+
+	snapshotTables, err := d.snapshotTables(ctx, conn, listTables)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Equal(tables, snapshotTables) {
+		return nil, nil, fmt.Errorf("tables changed while the snapshot was started")
+	}
+	conns, err = d.startWorkers(ctx, db, conn, workers)
+	return conns, tables, err
+}
+
+// snapshotTables starts the snapshot transaction on conn and lists the
+// tables inside it.
+func (d *Dumper) snapshotTables(ctx context.Context, conn *sql.Conn, listTables listTablesFunc) ([]string, error) {
+	if err := d.beginSnapshot(ctx, conn); err != nil {
+		return nil, err
+	}
+	tables, err := listTables(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
+
+// startWorkers opens workers-1 connections besides conn and starts the
+// snapshot transaction on each of them. It returns all connections with conn
+// first. Writes must be blocked for the workers to share conn's snapshot.
+func (d *Dumper) startWorkers(ctx context.Context, db *sql.DB, conn *sql.Conn, workers int) ([]*sql.Conn, error) {
+	conns := []*sql.Conn{conn}
+	for len(conns) < workers {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			closeConns(conns[1:])
+			return nil, fmt.Errorf("failed to get worker connection: %w", err)
+		}
+		conns = append(conns, c)
+		if err := d.beginSnapshot(ctx, c); err != nil {
+			closeConns(conns[1:])
+			return nil, err
+		}
+	}
+	return conns, nil
+}
+
+// lockTables blocks writes to tables until UNLOCK TABLES on lockConn.
+func lockTables(ctx context.Context, lockConn *sql.Conn, tables []string) error {
+	locks := make([]string, len(tables))
+	for i, table := range tables {
+		locks[i] = fmt.Sprintf("`%s` READ", table)
+	}
+	if _, err := lockConn.ExecContext(ctx, "LOCK TABLES "+strings.Join(locks, ", ")); err != nil {
+		return fmt.Errorf("failed to block writes: %w", err)
+	}
+	return nil
+}
+
+func closeConns(conns []*sql.Conn) {
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// tableDumpFunc writes everything a dump contains for one table to w.
+type tableDumpFunc func(ctx context.Context, q querier, w io.Writer, table string) error
+
+// dumpTablesParallel dumps tables with dumpTable on conns concurrently, each
+// table into its own chunk file below dir, and then appends the chunks to w
+// in table order so the result is identical to a sequential dump.
+func dumpTablesParallel(ctx context.Context, conns []*sql.Conn, w io.Writer, tables []string, dir string, dumpTable tableDumpFunc) error {
+	chunkDir, err := os.MkdirTemp(dir, ".chunks-*")
+	if err != nil {
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+	defer os.RemoveAll(chunkDir)
+
+	chunkPath := func(i int) string {
+		return filepath.Join(chunkDir, fmt.Sprintf("%06d.sql", i))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	errs := make(chan error, len(conns))
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *sql.Conn) {
+			defer wg.Done()
+			for i := range jobs {
+				if err := dumpTableToFile(ctx, conn, chunkPath(i), tables[i], dumpTable); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}(conn)
+	}
+
+feed:
+	for i := range tables {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for i := range tables {
+		if err := appendFile(w, chunkPath(i)); err != nil {
+			return fmt.Errorf("failed to assemble table %s: %w", tables[i], err)
+		}
+	}
+
+	return nil
+}
+
+func dumpTableToFile(ctx context.Context, q querier, path, table string, dumpTable tableDumpFunc) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create chunk file for table %s: %w", table, err)
+	}
+	defer file.Close()
+
+	bufWriter := bufio.NewWriter(file)
+	if err := dumpTable(ctx, q, bufWriter, table); err != nil {
+		return err
+	}
+	if err := bufWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to write chunk file for table %s: %w", table, err)
+	}
+	return file.Close()
+}
+
+func appendFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
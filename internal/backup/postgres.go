@@ -0,0 +1,1121 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"github.com/casparjones/go-dumper/internal/store"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgErrInvalidCatalogName is the SQLSTATE of connecting to a database that
+// does not exist.
+const pgErrInvalidCatalogName = "3D000"
+
+// postgresMaintenanceDB is connected to when no database is selected, as by
+// psql and pg_dumpall.
+const postgresMaintenanceDB = "postgres"
+
+// postgresParams make the server format values the same way whatever the
+// settings of the server, database and role are. Restores use them too, and
+// the dump header repeats them for restores with psql.
+var postgresParams = map[string]string{
+	"client_encoding":    "UTF8",
+	"DateStyle":          "ISO",
+	"IntervalStyle":      "postgres",
+	"TimeZone":           "UTC",
+	"extra_float_digits": "3",
+}
+
+// Conditions on pg_namespace n and the object oid of a catalog: objects of
+// the user's schemas that are not part of an extension. Extensions are
+// dumped as CREATE EXTENSION, which brings all of their objects back.
+const (
+	pgUserSchema = `n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\_%'`
+
+	pgNotInExtension = `NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend e WHERE e.classid = '%s'::pg_catalog.regclass AND e.objid = %s AND e.deptype = 'e')`
+)
+
+// postgresEngine is the Engine of PostgreSQL targets. Dumps are SQL scripts
+// that psql could run as well: the schemas, extensions, enum types,
+// sequences and routines of the database first, then each table with its
+// rows, indexes and triggers, and finally sequence values, foreign keys and
+// views. Tables outside the public schema are named "schema.table".
+type postgresEngine struct{}
+
+// open connects to database and checks the connection.
+func (e postgresEngine) open(ctx context.Context, conn dbconn.Options, database string) (*dbconn.DB, error) {
+	conn.Database = database
+	conn.Params = postgresParams
+
+	db, err := dbconn.Open(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
+	}
+	return db, nil
+}
+
+func (e postgresEngine) Ping(ctx context.Context, conn dbconn.Options) error {
+	db, err := e.open(ctx, conn, postgresMaintenanceDB)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func (e postgresEngine) ListDatabases(ctx context.Context, conn dbconn.Options) ([]string, error) {
+	db, err := e.open(ctx, conn, postgresMaintenanceDB)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT datname FROM pg_catalog.pg_database WHERE NOT datistemplate AND datallowconn ORDER BY datname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	defer rows.Close()
+
+	var databases []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan database name: %w", err)
+		}
+		databases = append(databases, name)
+	}
+	return databases, rows.Err()
+}
+
+func (e postgresEngine) CreateDatabase(ctx context.Context, conn dbconn.Options, database string) error {
+	db, err := e.open(ctx, conn, postgresMaintenanceDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var exists bool
+	err = db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM pg_catalog.pg_database WHERE datname = $1)", database).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if database exists: %w", err)
+	}
+
+	if !exists {
+		if _, err := db.ExecContext(ctx, "CREATE DATABASE "+pgQuoteIdent(database)); err != nil {
+			return fmt.Errorf("failed to create database '%s': %w", database, err)
+		}
+	}
+	return nil
+}
+
+func (e postgresEngine) Restore(ctx context.Context, conn dbconn.Options, database string, r io.Reader) error {
+	db, err := e.open(ctx, conn, database)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgErrInvalidCatalogName {
+			return fmt.Errorf("target database '%s' does not exist - please create it first or enable 'Create database if it doesn't exist' option", database)
+		}
+		return err
+	}
+	defer db.Close()
+
+	// The SET statements of the dump header must apply to every statement
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer c.Close()
+
+	scanner := newPostgresStatementScanner(r)
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading SQL file: %w", err)
+		}
+
+		if _, err := c.ExecContext(ctx, stmt.SQL); err != nil {
+			return fmt.Errorf("error at line %d (byte offset %d): %w\nStatement: %s",
+				stmt.Line, stmt.Offset, err, stmt.SQL[:min(len(stmt.SQL), 100)])
+		}
+	}
+}
+
+// pgTable is a table or view of a dumped database.
+type pgTable struct {
+	OID  int64
+	Name string // qualified and quoted, e.g. public."Orders"
+	Kind string // relkind: r for tables, v for views, m for materialized views
+
+	// Display is the name the table is filtered and reported by: the bare
+	// name in the public schema, "schema.table" elsewhere.
+	Display string
+}
+
+// pgSequence is a sequence with the column owning it, if any.
+type pgSequence struct {
+	Name      string
+	Type      string
+	Start     int64
+	Increment int64
+	Min       int64
+	Max       int64
+	Cache     int64
+	Cycle     bool
+
+	// OwnerKind is "a" for serial columns, "i" for identity columns, which
+	// create their sequence themselves, or "" for free sequences
+	OwnerKind   string
+	OwnerOID    int64
+	OwnerTable  string
+	OwnerColumn string
+}
+
+// pgDump is the state of one dump of a PostgreSQL database.
+type pgDump struct {
+	options *DumpOptions
+	tables  map[string]pgTable // by Display name
+	dumped  map[int64]bool     // oids of the dumped tables
+}
+
+func (e postgresEngine) Dump(ctx context.Context, conn dbconn.Options, w io.Writer, options *DumpOptions, tempDir string) (*DumpResult, error) {
+	db, err := e.open(ctx, conn, options.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer c.Close()
+
+	// One snapshot for the whole dump. All reads happen inside it, so
+	// tables, sequences and views are consistent with each other.
+	if err := beginPostgresSnapshot(ctx, c, ""); err != nil {
+		return nil, fmt.Errorf("failed to start consistent snapshot: %w", err)
+	}
+	defer c.ExecContext(context.Background(), "ROLLBACK")
+
+	relations, err := pgRelations(ctx, c, "'r', 'p'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	dump := &pgDump{
+		options: options,
+		tables:  make(map[string]pgTable),
+		dumped:  make(map[int64]bool),
+	}
+	var all []string
+	for _, table := range relations {
+		dump.tables[table.Display] = table
+		all = append(all, table.Display)
+	}
+
+	result := &DumpResult{}
+	tables, excluded := options.Tables.filterTables(options.DatabaseName, all)
+	result.Tables, result.ExcludedTables = tables, excluded
+	for _, name := range tables {
+		table := dump.tables[name]
+		if table.Kind == "p" {
+			return nil, fmt.Errorf("table %s is partitioned, which is not supported; exclude it to dump the other tables", name)
+		}
+		dump.dumped[table.OID] = true
+		if options.Tables.IsSchemaOnly(options.DatabaseName, name) {
+			result.SchemaOnlyTables = append(result.SchemaOnlyTables, name)
+		}
+	}
+
+	sequences, err := dump.sequences(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+	views, err := pgRelations(ctx, c, "'v', 'm'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list views: %w", err)
+	}
+
+	conns := []*sql.Conn{c}
+	if workers := min(options.Parallelism, len(tables)); workers > 1 {
+		conns, err = startPostgresWorkers(ctx, db.DB, c, workers)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			for _, worker := range conns[1:] {
+				worker.ExecContext(context.Background(), "ROLLBACK")
+				worker.Close()
+			}
+		}()
+	}
+
+	if err := writePostgresHeader(w, options.Target, options.DatabaseName); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	if options.IncludeStructure {
+		if err := dump.writeObjects(ctx, c, w, tables, views, sequences); err != nil {
+			return nil, err
+		}
+	}
+
+	dumpTable := func(ctx context.Context, q querier, w io.Writer, name string) error {
+		if err := dump.writeTable(ctx, q, w, dump.tables[name]); err != nil {
+			return fmt.Errorf("failed to dump table %s: %w", name, err)
+		}
+		return nil
+	}
+	if len(conns) > 1 {
+		if err := dumpTablesParallel(ctx, conns, w, tables, tempDir, dumpTable); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range tables {
+			if err := dumpTable(ctx, c, w, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if options.IncludeData {
+		if err := dump.writeSequenceValues(ctx, c, w, sequences); err != nil {
+			return nil, fmt.Errorf("failed to dump sequence values: %w", err)
+		}
+	}
+
+	if options.IncludeStructure {
+		if err := dump.writeDependents(ctx, c, w, views, sequences); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := io.WriteString(w, "\n-- Dump completed\n"); err != nil {
+		return nil, fmt.Errorf("failed to write footer: %w", err)
+	}
+	return result, nil
+}
+
+// beginPostgresSnapshot starts the read-only REPEATABLE READ transaction of
+// a dump on conn, importing snapshot unless it is empty. Names in the output
+// of the server's functions are schema qualified, as search_path is empty.
+func beginPostgresSnapshot(ctx context.Context, conn *sql.Conn, snapshot string) error {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_catalog.set_config('search_path', '', false)"); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ, READ ONLY"); err != nil {
+		return err
+	}
+	if snapshot != "" {
+		_, err := conn.ExecContext(ctx, "SET TRANSACTION SNAPSHOT "+pgQuoteLiteral(snapshot))
+		return err
+	}
+	return nil
+}
+
+// startPostgresWorkers returns conn and workers-1 further connections that
+// share the snapshot of conn. If the snapshot cannot be exported, e.g. on a
+// server too busy to hand out more connections, the dump falls back to conn
+// alone.
+func startPostgresWorkers(ctx context.Context, db *sql.DB, conn *sql.Conn, workers int) ([]*sql.Conn, error) {
+	conns := []*sql.Conn{conn}
+
+	var snapshot string
+	if err := conn.QueryRowContext(ctx, "SELECT pg_catalog.pg_export_snapshot()").Scan(&snapshot); err != nil {
+		log.Printf("Parallel dump not possible, dumping tables sequentially: %v", err)
+		return conns, nil
+	}
+
+	for len(conns) < workers {
+		c, err := db.Conn(ctx)
+		if err == nil {
+			if err = beginPostgresSnapshot(ctx, c, snapshot); err != nil {
+				c.Close()
+			}
+		}
+		if err != nil {
+			for _, worker := range conns[1:] {
+				worker.ExecContext(context.Background(), "ROLLBACK")
+				worker.Close()
+			}
+			log.Printf("Parallel dump not possible, dumping tables sequentially: %v", err)
+			return []*sql.Conn{conn}, nil
+		}
+		conns = append(conns, c)
+	}
+	return conns, nil
+}
+
+// pgRelations returns the relations of the given relkinds in the user's
+// schemas, ordered by schema and name.
+func pgRelations(ctx context.Context, q querier, kinds string) ([]pgTable, error) {
+	query := `SELECT c.oid, c.oid::pg_catalog.regclass::text, c.relkind::text, n.nspname, c.relname
+FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN (` + kinds + `) AND NOT c.relispartition AND ` + pgUserSchema + `
+AND ` + fmt.Sprintf(pgNotInExtension, "pg_catalog.pg_class", "c.oid") + `
+ORDER BY n.nspname, c.relname`
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []pgTable
+	for rows.Next() {
+		var (
+			table        pgTable
+			schema, name string
+		)
+		if err := rows.Scan(&table.OID, &table.Name, &table.Kind, &schema, &name); err != nil {
+			return nil, err
+		}
+		table.Display = pgDisplayName(schema, name)
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// pgDisplayName returns the name a table is filtered and reported by.
+func pgDisplayName(schema, table string) string {
+	if schema == "public" {
+		return table
+	}
+	return schema + "." + table
+}
+
+// sequences returns the sequences to dump: free ones and those of the dumped
+// tables.
+func (p *pgDump) sequences(ctx context.Context, q querier) ([]pgSequence, error) {
+	query := `SELECT c.oid::pg_catalog.regclass::text, pg_catalog.format_type(s.seqtypid, NULL),
+	s.seqstart, s.seqincrement, s.seqmin, s.seqmax, s.seqcache, s.seqcycle,
+	COALESCE(d.deptype::text, ''), COALESCE(d.refobjid::bigint, 0),
+	COALESCE(d.refobjid::pg_catalog.regclass::text, ''), COALESCE(a.attname::text, '')
+FROM pg_catalog.pg_sequence s
+JOIN pg_catalog.pg_class c ON c.oid = s.seqrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_catalog.pg_depend d ON d.classid = 'pg_catalog.pg_class'::pg_catalog.regclass AND d.objid = c.oid
+	AND d.refclassid = 'pg_catalog.pg_class'::pg_catalog.regclass AND d.deptype IN ('a', 'i')
+LEFT JOIN pg_catalog.pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+WHERE ` + pgUserSchema + ` AND ` + fmt.Sprintf(pgNotInExtension, "pg_catalog.pg_class", "c.oid") + `
+ORDER BY 1`
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sequences []pgSequence
+	for rows.Next() {
+		var s pgSequence
+		if err := rows.Scan(&s.Name, &s.Type, &s.Start, &s.Increment, &s.Min, &s.Max, &s.Cache, &s.Cycle,
+			&s.OwnerKind, &s.OwnerOID, &s.OwnerTable, &s.OwnerColumn); err != nil {
+			return nil, err
+		}
+		if s.OwnerOID != 0 && !p.dumped[s.OwnerOID] {
+			continue
+		}
+		sequences = append(sequences, s)
+	}
+	return sequences, rows.Err()
+}
+
+// writeObjects writes what the tables may depend on: schemas, extensions,
+// enum types, sequences and routines. Existing tables and views are dropped
+// first, which also drops their sequences.
+func (p *pgDump) writeObjects(ctx context.Context, q querier, w io.Writer, tables []string, views []pgTable, sequences []pgSequence) error {
+	schemas, err := queryPostgresStrings(ctx, q, `SELECT pg_catalog.quote_ident(n.nspname) FROM pg_catalog.pg_namespace n
+WHERE `+pgUserSchema+` AND `+fmt.Sprintf(pgNotInExtension, "pg_catalog.pg_namespace", "n.oid")+`
+ORDER BY n.nspname`)
+	if err != nil {
+		return fmt.Errorf("failed to list schemas: %w", err)
+	}
+	extensions, err := queryPostgresStrings(ctx, q, `SELECT 'CREATE EXTENSION IF NOT EXISTS ' || pg_catalog.quote_ident(x.extname) || ' WITH SCHEMA ' || pg_catalog.quote_ident(n.nspname)
+FROM pg_catalog.pg_extension x JOIN pg_catalog.pg_namespace n ON n.oid = x.extnamespace
+WHERE x.extname <> 'plpgsql' ORDER BY x.extname`)
+	if err != nil {
+		return fmt.Errorf("failed to list extensions: %w", err)
+	}
+	enums, err := queryPostgresStrings(ctx, q, `SELECT 'CREATE TYPE ' || pg_catalog.format_type(t.oid, NULL) || ' AS ENUM (' ||
+	(SELECT pg_catalog.string_agg(pg_catalog.quote_literal(l.enumlabel), ', ' ORDER BY l.enumsortorder) FROM pg_catalog.pg_enum l WHERE l.enumtypid = t.oid) || ')'
+FROM pg_catalog.pg_type t JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+WHERE t.typtype = 'e' AND `+pgUserSchema+` AND `+fmt.Sprintf(pgNotInExtension, "pg_catalog.pg_type", "t.oid")+`
+ORDER BY 1`)
+	if err != nil {
+		return fmt.Errorf("failed to list enum types: %w", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--\n-- Schemas and extensions\n--\n\n")
+	for _, schema := range schemas {
+		fmt.Fprintf(&sb, "CREATE SCHEMA IF NOT EXISTS %s;\n", schema)
+	}
+	for _, extension := range extensions {
+		sb.WriteString(extension + ";\n")
+	}
+
+	sb.WriteString("\n")
+	for _, view := range views {
+		fmt.Fprintf(&sb, "DROP %s IF EXISTS %s CASCADE;\n", pgViewKeyword(view.Kind), view.Name)
+	}
+	for _, name := range tables {
+		fmt.Fprintf(&sb, "DROP TABLE IF EXISTS %s CASCADE;\n", p.tables[name].Name)
+	}
+
+	if len(enums) > 0 {
+		sb.WriteString("\n--\n-- Types\n--\n\n")
+	}
+	for _, enum := range enums {
+		// CREATE TYPE has no IF NOT EXISTS
+		fmt.Fprintf(&sb, "DO $$ BEGIN\n    %s;\nEXCEPTION WHEN duplicate_object THEN NULL;\nEND $$;\n", enum)
+	}
+
+	if len(sequences) > 0 {
+		sb.WriteString("\n--\n-- Sequences\n--\n\n")
+	}
+	for _, s := range sequences {
+		if s.OwnerKind == "i" {
+			continue
+		}
+		cycle := "NO CYCLE"
+		if s.Cycle {
+			cycle = "CYCLE"
+		}
+		fmt.Fprintf(&sb, "CREATE SEQUENCE IF NOT EXISTS %s AS %s START WITH %d INCREMENT BY %d MINVALUE %d MAXVALUE %d CACHE %d %s;\n",
+			s.Name, s.Type, s.Start, s.Increment, s.Min, s.Max, s.Cache, cycle)
+	}
+	sb.WriteString("\n")
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return err
+	}
+
+	// Routines returning rows of a table can only be created after it
+	if p.options.IncludeRoutines {
+		if err := writePostgresRoutines(ctx, q, w, false); err != nil {
+			return fmt.Errorf("failed to dump routines: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeTable writes the structure, rows, indexes and triggers of table.
+func (p *pgDump) writeTable(ctx context.Context, q querier, w io.Writer, table pgTable) error {
+	columns, err := pgTableColumns(ctx, q, table.OID)
+	if err != nil {
+		return err
+	}
+
+	if p.options.IncludeStructure {
+		constraints, err := queryPostgresStrings(ctx, q, `SELECT 'CONSTRAINT ' || pg_catalog.quote_ident(conname) || ' ' || pg_catalog.pg_get_constraintdef(oid)
+FROM pg_catalog.pg_constraint WHERE conrelid = $1 AND contype IN ('p', 'u', 'c', 'x') AND conislocal
+ORDER BY contype <> 'p', conname`, table.OID)
+		if err != nil {
+			return err
+		}
+		var unlogged bool
+		if err := q.QueryRowContext(ctx, "SELECT relpersistence = 'u' FROM pg_catalog.pg_class WHERE oid = $1", table.OID).Scan(&unlogged); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "--\n-- Table structure for table %s\n--\n\n", table.Name); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, pgCreateTable(table.Name, unlogged, columns, constraints)); err != nil {
+			return err
+		}
+	}
+
+	if p.options.IncludeData && !p.options.Tables.IsSchemaOnly(p.options.DatabaseName, table.Display) {
+		if err := p.writeTableData(ctx, q, w, table, columns); err != nil {
+			return err
+		}
+	}
+
+	if !p.options.IncludeStructure {
+		return nil
+	}
+
+	// Indexes and triggers follow the data, so it is loaded without them
+	if err := writePostgresIndexes(ctx, q, w, table.OID); err != nil {
+		return err
+	}
+	if p.options.IncludeTriggers {
+		triggers, err := queryPostgresStrings(ctx, q, "SELECT pg_catalog.pg_get_triggerdef(oid) FROM pg_catalog.pg_trigger WHERE tgrelid = $1 AND NOT tgisinternal ORDER BY tgname", table.OID)
+		if err != nil {
+			return fmt.Errorf("failed to dump triggers: %w", err)
+		}
+		for _, trigger := range triggers {
+			if _, err := io.WriteString(w, trigger+";\n"); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// pgColumn is a column as needed to recreate it and dump its values.
+type pgColumn struct {
+	Name      string
+	Type      string // with modifiers, e.g. character varying(20)
+	Collation string // qualified, set if it differs from the type's default
+	NotNull   bool
+	Default   string // expression of DEFAULT or GENERATED ALWAYS AS
+	Identity  string // attidentity: a for ALWAYS, d for BY DEFAULT
+	Generated string // attgenerated: s for stored, v for virtual; not dumped
+}
+
+func pgTableColumns(ctx context.Context, q querier, oid int64) ([]pgColumn, error) {
+	query := `SELECT a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod),
+	COALESCE((SELECT pg_catalog.quote_ident(cn.nspname) || '.' || pg_catalog.quote_ident(co.collname)
+		FROM pg_catalog.pg_collation co JOIN pg_catalog.pg_namespace cn ON cn.oid = co.collnamespace
+		WHERE co.oid = a.attcollation AND a.attcollation <> t.typcollation), ''),
+	a.attnotnull, COALESCE(pg_catalog.pg_get_expr(d.adbin, d.adrelid), ''), a.attidentity::text, a.attgenerated::text
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`
+	rows, err := q.QueryContext(ctx, query, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []pgColumn
+	for rows.Next() {
+		var c pgColumn
+		if err := rows.Scan(&c.Name, &c.Type, &c.Collation, &c.NotNull, &c.Default, &c.Identity, &c.Generated); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// pgCreateTable returns the CREATE TABLE statement of a table with columns
+// and constraints (as "CONSTRAINT name definition"). Foreign keys are added
+// once all tables exist.
+func pgCreateTable(name string, unlogged bool, columns []pgColumn, constraints []string) string {
+	var sb strings.Builder
+	sb.WriteString("CREATE ")
+	if unlogged {
+		sb.WriteString("UNLOGGED ")
+	}
+	sb.WriteString("TABLE " + name + " (")
+
+	for i, c := range columns {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n    " + pgQuoteIdent(c.Name) + " " + c.Type)
+		if c.Collation != "" {
+			sb.WriteString(" COLLATE " + c.Collation)
+		}
+		switch {
+		case c.Generated == "s":
+			sb.WriteString(" GENERATED ALWAYS AS (" + c.Default + ") STORED")
+		case c.Generated == "v":
+			sb.WriteString(" GENERATED ALWAYS AS (" + c.Default + ")")
+		case c.Identity == "a":
+			sb.WriteString(" GENERATED ALWAYS AS IDENTITY")
+		case c.Identity == "d":
+			sb.WriteString(" GENERATED BY DEFAULT AS IDENTITY")
+		case c.Default != "":
+			sb.WriteString(" DEFAULT " + c.Default)
+		}
+		if c.NotNull && c.Identity == "" {
+			sb.WriteString(" NOT NULL")
+		}
+	}
+	for i, constraint := range constraints {
+		if i > 0 || len(columns) > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n    " + constraint)
+	}
+
+	sb.WriteString("\n);\n\n")
+	return sb.String()
+}
+
+func writePostgresIndexes(ctx context.Context, q querier, w io.Writer, oid int64) error {
+	indexes, err := queryPostgresStrings(ctx, q, `SELECT pg_catalog.pg_get_indexdef(i.indexrelid) FROM pg_catalog.pg_index i
+WHERE i.indrelid = $1 AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_constraint c WHERE c.conindid = i.indexrelid AND c.contype IN ('p', 'u', 'x'))
+ORDER BY i.indexrelid::pg_catalog.regclass::text`, oid)
+	if err != nil {
+		return fmt.Errorf("failed to dump indexes: %w", err)
+	}
+	for _, index := range indexes {
+		if _, err := io.WriteString(w, index+";\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTableData writes the rows of table. Values are read in their text
+// form and written as string literals, which INSERT converts back to the
+// type of their column.
+func (p *pgDump) writeTableData(ctx context.Context, q querier, w io.Writer, table pgTable, all []pgColumn) error {
+	var (
+		columns    []string // quoted
+		selects    []string
+		names      []string // unquoted, as the sanitize rules name them
+		overriding bool
+	)
+	for _, c := range all {
+		if c.Generated != "" {
+			continue
+		}
+		columns = append(columns, pgQuoteIdent(c.Name))
+		selects = append(selects, pgQuoteIdent(c.Name)+"::text")
+		names = append(names, c.Name)
+		overriding = overriding || c.Identity == "a"
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	// Row estimate for progress reports; an exact count(*) would scan the table
+	var estimatedRows sql.NullInt64
+	q.QueryRowContext(ctx, "SELECT GREATEST(reltuples, 0)::bigint FROM pg_catalog.pg_class WHERE oid = $1", table.OID).Scan(&estimatedRows)
+
+	sanitizer := p.options.Sanitize.forTable(p.options.DatabaseName, table.Display)
+	masks, err := sanitizer.columnMasks(names)
+	if err != nil {
+		return err
+	}
+
+	tw := &pgTableWriter{
+		w:             w,
+		table:         table.Display,
+		insert:        pgInsertPrefix(table.Name, columns, overriding),
+		masks:         masks,
+		batchSize:     p.options.BatchSize,
+		estimatedRows: estimatedRows.Int64,
+		progress:      p.options.Progress,
+	}
+
+	var where string
+	if sanitizer != nil {
+		where = sanitizer.where
+	}
+
+	var keyIndexes []int
+	if p.options.ChunkSize > 0 {
+		keyColumns, err := queryPostgresStrings(ctx, q, `SELECT a.attname FROM pg_catalog.pg_constraint c
+CROSS JOIN LATERAL pg_catalog.unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+WHERE c.conrelid = $1 AND c.contype = 'p' ORDER BY k.ord`, table.OID)
+		if err != nil {
+			return err
+		}
+		for _, key := range keyColumns {
+			index := -1
+			for i, column := range columns {
+				if column == pgQuoteIdent(key) {
+					index = i
+				}
+			}
+			if index < 0 {
+				// A generated key is not dumped, so it cannot be walked
+				keyIndexes = nil
+				break
+			}
+			keyIndexes = append(keyIndexes, index)
+		}
+	}
+
+	var lastKey []sql.NullString
+	for {
+		query := pgSelectQuery(table.Name, selects, columns, keyIndexes, where, lastKey, p.options.ChunkSize)
+		rows, err := q.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		before := tw.rows
+		key, err := tw.writeRows(rows, keyIndexes)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if keyIndexes == nil || tw.rows-before < int64(p.options.ChunkSize) {
+			return tw.close()
+		}
+		lastKey = key
+	}
+}
+
+// pgSelectQuery returns the query reading the rows of table meeting where
+// (if not empty). With keyIndexes, the rows are read chunkSize at a time in
+// key order, starting after lastKey.
+func pgSelectQuery(table string, selects, columns []string, keyIndexes []int, where string, lastKey []sql.NullString, chunkSize int) string {
+	var conditions []string
+	if where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+
+	var keys []string
+	for _, i := range keyIndexes {
+		keys = append(keys, columns[i])
+	}
+	if lastKey != nil {
+		values := make([]string, len(lastKey))
+		for i, value := range lastKey {
+			values[i] = pgQuoteLiteral(value.String)
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s) > (%s)", strings.Join(keys, ", "), strings.Join(values, ", ")))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selects, ", "), table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if keys != nil {
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(keys, ", "), chunkSize)
+	}
+	return query
+}
+
+func pgInsertPrefix(table string, columns []string, overriding bool) string {
+	prefix := fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(columns, ", "))
+	if overriding {
+		prefix += " OVERRIDING SYSTEM VALUE"
+	}
+	return prefix + " VALUES\n"
+}
+
+// pgTableWriter batches the rows of one table into INSERT statements, like
+// tableDataWriter does for MySQL.
+type pgTableWriter struct {
+	w             io.Writer
+	table         string
+	insert        string
+	masks         []*MaskRule // per column, nil if no column is masked
+	batchSize     int
+	estimatedRows int64
+	progress      func(TableProgress)
+
+	values []string
+	rows   int64
+}
+
+// writeRows adds every row of rows and returns the key columns of the last.
+func (t *pgTableWriter) writeRows(rows *sql.Rows, keyIndexes []int) ([]sql.NullString, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var lastKey []sql.NullString
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+
+		rowData := make([]string, len(values))
+		for i, val := range values {
+			var value interface{}
+			if val.Valid {
+				value = val.String
+			}
+			if t.masks != nil && t.masks[i] != nil {
+				value = t.masks[i].apply(value)
+			}
+			if value == nil {
+				rowData[i] = "NULL"
+			} else {
+				rowData[i] = pgQuoteLiteral(fmt.Sprint(value))
+			}
+		}
+
+		if t.rows == 0 {
+			if _, err := fmt.Fprintf(t.w, "--\n-- Data for table %s\n--\n\n", t.table); err != nil {
+				return nil, err
+			}
+		}
+		t.values = append(t.values, "("+strings.Join(rowData, ", ")+")")
+		t.rows++
+		if len(t.values) >= t.batchSize {
+			if err := t.flush(); err != nil {
+				return nil, err
+			}
+		}
+
+		if keyIndexes != nil {
+			lastKey = make([]sql.NullString, len(keyIndexes))
+			for i, idx := range keyIndexes {
+				lastKey[i] = values[idx]
+			}
+		}
+	}
+	return lastKey, rows.Err()
+}
+
+func (t *pgTableWriter) flush() error {
+	if len(t.values) == 0 {
+		return nil
+	}
+	if _, err := io.WriteString(t.w, t.insert+strings.Join(t.values, ",\n")+";\n"); err != nil {
+		return err
+	}
+	t.values = t.values[:0]
+	t.report(false)
+	return nil
+}
+
+func (t *pgTableWriter) close() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+	if t.rows > 0 {
+		if _, err := io.WriteString(t.w, "\n"); err != nil {
+			return err
+		}
+	}
+	t.report(true)
+	return nil
+}
+
+func (t *pgTableWriter) report(done bool) {
+	if t.progress == nil {
+		return
+	}
+	t.progress(TableProgress{
+		Table:         t.table,
+		Rows:          t.rows,
+		EstimatedRows: t.estimatedRows,
+		Done:          done,
+	})
+}
+
+// writeSequenceValues sets every sequence to its value in the snapshot.
+func (p *pgDump) writeSequenceValues(ctx context.Context, q querier, w io.Writer, sequences []pgSequence) error {
+	if len(sequences) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--\n-- Sequence values\n--\n\n")
+	for _, s := range sequences {
+		var (
+			value  int64
+			called bool
+		)
+		if err := q.QueryRowContext(ctx, "SELECT last_value, is_called FROM "+s.Name).Scan(&value, &called); err != nil {
+			return fmt.Errorf("sequence %s: %w", s.Name, err)
+		}
+		name := pgQuoteLiteral(s.Name)
+		if s.OwnerKind == "i" {
+			// Identity sequences are named when their table is created
+			name = fmt.Sprintf("pg_catalog.pg_get_serial_sequence(%s, %s)", pgQuoteLiteral(s.OwnerTable), pgQuoteLiteral(s.OwnerColumn))
+		}
+		fmt.Fprintf(&sb, "SELECT pg_catalog.setval(%s, %d, %t);\n", name, value, called)
+	}
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeDependents writes what depends on several tables: sequence owners,
+// foreign keys, the routines returning table rows and views.
+func (p *pgDump) writeDependents(ctx context.Context, q querier, w io.Writer, views []pgTable, sequences []pgSequence) error {
+	var sb strings.Builder
+	for _, s := range sequences {
+		if s.OwnerKind == "a" {
+			fmt.Fprintf(&sb, "ALTER SEQUENCE %s OWNED BY %s.%s;\n", s.Name, s.OwnerTable, pgQuoteIdent(s.OwnerColumn))
+		}
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT conrelid, conrelid::pg_catalog.regclass::text, pg_catalog.quote_ident(conname), pg_catalog.pg_get_constraintdef(oid)
+FROM pg_catalog.pg_constraint WHERE contype = 'f' AND conislocal ORDER BY 2, 3`)
+	if err != nil {
+		return fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	var foreignKeys []string
+	for rows.Next() {
+		var (
+			oid                     int64
+			table, name, definition string
+		)
+		if err := rows.Scan(&oid, &table, &name, &definition); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list foreign keys: %w", err)
+		}
+		if p.dumped[oid] {
+			foreignKeys = append(foreignKeys, fmt.Sprintf("ALTER TABLE ONLY %s ADD CONSTRAINT %s %s;\n", table, name, definition))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+
+	if len(foreignKeys) > 0 {
+		sb.WriteString("\n--\n-- Foreign keys\n--\n\n")
+		sb.WriteString(strings.Join(foreignKeys, ""))
+	}
+	sb.WriteString("\n")
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return err
+	}
+
+	if p.options.IncludeRoutines {
+		if err := writePostgresRoutines(ctx, q, w, true); err != nil {
+			return fmt.Errorf("failed to dump routines: %w", err)
+		}
+	}
+
+	// Views in creation order, so views come after the views they select from
+	sortedViews := append([]pgTable(nil), views...)
+	sort.Slice(sortedViews, func(i, j int) bool { return sortedViews[i].OID < sortedViews[j].OID })
+	for _, view := range sortedViews {
+		if err := p.writeView(ctx, q, w, view); err != nil {
+			return fmt.Errorf("failed to dump view %s: %w", view.Display, err)
+		}
+	}
+	return nil
+}
+
+func (p *pgDump) writeView(ctx context.Context, q querier, w io.Writer, view pgTable) error {
+	var definition string
+	if err := q.QueryRowContext(ctx, "SELECT pg_catalog.pg_get_viewdef($1::oid)", view.OID).Scan(&definition); err != nil {
+		return err
+	}
+	definition = strings.TrimSuffix(strings.TrimSpace(definition), ";")
+
+	if _, err := fmt.Fprintf(w, "--\n-- View structure for view %s\n--\n\n", view.Name); err != nil {
+		return err
+	}
+	if view.Kind != "m" {
+		_, err := fmt.Fprintf(w, "CREATE VIEW %s AS\n%s;\n\n", view.Name, definition)
+		return err
+	}
+
+	withData := "WITH NO DATA"
+	if p.options.IncludeData {
+		withData = "WITH DATA"
+	}
+	if _, err := fmt.Fprintf(w, "CREATE MATERIALIZED VIEW %s AS\n%s\n%s;\n", view.Name, definition, withData); err != nil {
+		return err
+	}
+	if err := writePostgresIndexes(ctx, q, w, view.OID); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writePostgresRoutines writes the functions and procedures of the user's
+// schemas: those whose signature uses the row type of a table if rowTypes is
+// set, the others if not.
+func writePostgresRoutines(ctx context.Context, q querier, w io.Writer, rowTypes bool) error {
+	query := `SELECT pg_catalog.pg_get_functiondef(p.oid)
+FROM pg_catalog.pg_proc p JOIN pg_catalog.pg_namespace n ON n.oid = p.pronamespace
+WHERE p.prokind IN ('f', 'p') AND ` + pgUserSchema + ` AND ` + fmt.Sprintf(pgNotInExtension, "pg_catalog.pg_proc", "p.oid") + `
+AND EXISTS (SELECT 1 FROM pg_catalog.pg_depend d JOIN pg_catalog.pg_type t ON t.oid = d.refobjid
+	WHERE d.classid = 'pg_catalog.pg_proc'::pg_catalog.regclass AND d.objid = p.oid
+	AND d.refclassid = 'pg_catalog.pg_type'::pg_catalog.regclass AND t.typrelid <> 0) = $1
+ORDER BY n.nspname, p.proname, p.oid`
+	routines, err := queryPostgresStrings(ctx, q, query, rowTypes)
+	if err != nil {
+		return err
+	}
+	if len(routines) == 0 {
+		return nil
+	}
+
+	if _, err := io.WriteString(w, "--\n-- Routines\n--\n\n"); err != nil {
+		return err
+	}
+	for _, routine := range routines {
+		if _, err := io.WriteString(w, strings.TrimSpace(routine)+";\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryPostgresStrings(ctx context.Context, q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+func writePostgresHeader(w io.Writer, target *store.Target, databaseName string) error {
+	header := fmt.Sprintf(`-- PostgreSQL dump created by go-dumper
+-- Host: %s    Database: %s
+-- ------------------------------------------------------
+
+SET client_encoding = 'UTF8';
+SET standard_conforming_strings = on;
+SET DateStyle = ISO;
+SET IntervalStyle = postgres;
+SET TimeZone = 'UTC';
+SELECT pg_catalog.set_config('search_path', '', false);
+SET check_function_bodies = false;
+SET client_min_messages = warning;
+
+`, target.Host, databaseName)
+
+	_, err := io.WriteString(w, header)
+	return err
+}
+
+func pgViewKeyword(kind string) string {
+	if kind == "m" {
+		return "MATERIALIZED VIEW"
+	}
+	return "VIEW"
+}
+
+// pgQuoteIdent quotes a name for use as an identifier.
+func pgQuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// pgQuoteLiteral quotes s as a string literal. Backslashes are only special
+// in E'...' strings, which are used for values containing them so the dump
+// does not depend on standard_conforming_strings.
+func pgQuoteLiteral(s string) string {
+	if !strings.Contains(s, `\`) {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "E'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
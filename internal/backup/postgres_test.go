@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestPgQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "''"},
+		{"plain", "'plain'"},
+		{"it's", "'it''s'"},
+		{`C:\dir`, `E'C:\\dir'`},
+		{`\x00ff`, `E'\\x00ff'`},
+		{`it's \n`, `E'it''s \\n'`},
+		{"line\nbreak", "'line\nbreak'"},
+	}
+
+	for _, tt := range tests {
+		if got := pgQuoteLiteral(tt.input); got != tt.expected {
+			t.Errorf("pgQuoteLiteral(%q) = %s, expected %s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestPgQuoteIdent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"id", `"id"`},
+		{"Order Items", `"Order Items"`},
+		{`say "hi"`, `"say ""hi"""`},
+	}
+
+	for _, tt := range tests {
+		if got := pgQuoteIdent(tt.input); got != tt.expected {
+			t.Errorf("pgQuoteIdent(%q) = %s, expected %s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestPgDisplayName(t *testing.T) {
+	if got := pgDisplayName("public", "users"); got != "users" {
+		t.Errorf("Expected tables in public without schema, got %s", got)
+	}
+	if got := pgDisplayName("billing", "invoices"); got != "billing.invoices" {
+		t.Errorf("Expected schema.table, got %s", got)
+	}
+
+	// Patterns with a dot match database.name, so schemas add a level
+	filter := TableFilter{Exclude: []string{"shop.billing.*"}}
+	if filter.Includes("shop", pgDisplayName("billing", "invoices")) {
+		t.Error("Expected billing.invoices to be excluded")
+	}
+	if !filter.Includes("shop", pgDisplayName("public", "invoices")) {
+		t.Error("Expected invoices to be included")
+	}
+}
+
+func TestPgCreateTable(t *testing.T) {
+	columns := []pgColumn{
+		{Name: "id", Type: "bigint", NotNull: true, Identity: "a"},
+		{Name: "order_id", Type: "integer", NotNull: true, Default: "nextval('public.orders_id_seq'::regclass)"},
+		{Name: "name", Type: "character varying(100)", Collation: `pg_catalog."C"`},
+		{Name: "total", Type: "numeric(10,2)", Default: "0"},
+		{Name: "total_cents", Type: "bigint", Default: "(total * (100)::numeric)", Generated: "s"},
+	}
+	constraints := []string{
+		`CONSTRAINT "items_pkey" PRIMARY KEY (id)`,
+		`CONSTRAINT "items_total_check" CHECK ((total >= (0)::numeric))`,
+	}
+
+	expected := `CREATE TABLE public.items (
+    "id" bigint GENERATED ALWAYS AS IDENTITY,
+    "order_id" integer DEFAULT nextval('public.orders_id_seq'::regclass) NOT NULL,
+    "name" character varying(100) COLLATE pg_catalog."C",
+    "total" numeric(10,2) DEFAULT 0,
+    "total_cents" bigint GENERATED ALWAYS AS ((total * (100)::numeric)) STORED,
+    CONSTRAINT "items_pkey" PRIMARY KEY (id),
+    CONSTRAINT "items_total_check" CHECK ((total >= (0)::numeric))
+);
+
+`
+	if got := pgCreateTable("public.items", false, columns, constraints); got != expected {
+		t.Errorf("CREATE TABLE mismatch:\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+
+	got := pgCreateTable("public.cache", true, []pgColumn{{Name: "key", Type: "text"}}, nil)
+	if got != "CREATE UNLOGGED TABLE public.cache (\n    \"key\" text\n);\n\n" {
+		t.Errorf("Unexpected unlogged table: %q", got)
+	}
+}
+
+func TestPgSelectQuery(t *testing.T) {
+	selects := []string{`"id"::text`, `"tenant"::text`, `"name"::text`}
+	columns := []string{`"id"`, `"tenant"`, `"name"`}
+
+	tests := []struct {
+		name       string
+		keyIndexes []int
+		where      string
+		lastKey    []sql.NullString
+		expected   string
+	}{
+		{
+			name:     "whole table",
+			expected: `SELECT "id"::text, "tenant"::text, "name"::text FROM public.t`,
+		},
+		{
+			name:     "sanitized",
+			where:    "tenant = 1",
+			expected: `SELECT "id"::text, "tenant"::text, "name"::text FROM public.t WHERE (tenant = 1)`,
+		},
+		{
+			name:       "first chunk",
+			keyIndexes: []int{1, 0},
+			expected:   `SELECT "id"::text, "tenant"::text, "name"::text FROM public.t ORDER BY "tenant", "id" LIMIT 100`,
+		},
+		{
+			name:       "next chunk",
+			keyIndexes: []int{1, 0},
+			where:      "tenant = 1",
+			lastKey:    []sql.NullString{{String: "it's", Valid: true}, {String: "42", Valid: true}},
+			expected:   `SELECT "id"::text, "tenant"::text, "name"::text FROM public.t WHERE (tenant = 1) AND ("tenant", "id") > ('it''s', '42') ORDER BY "tenant", "id" LIMIT 100`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pgSelectQuery("public.t", selects, columns, tt.keyIndexes, tt.where, tt.lastKey, 100)
+			if got != tt.expected {
+				t.Errorf("Query mismatch:\nGot:\n%s\nExpected:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPgInsertPrefix(t *testing.T) {
+	columns := []string{`"id"`, `"name"`}
+	if got := pgInsertPrefix("public.t", columns, false); got != "INSERT INTO public.t (\"id\", \"name\") VALUES\n" {
+		t.Errorf("Unexpected insert: %q", got)
+	}
+	if got := pgInsertPrefix("public.t", columns, true); got != "INSERT INTO public.t (\"id\", \"name\") OVERRIDING SYSTEM VALUE VALUES\n" {
+		t.Errorf("Unexpected insert for identity columns: %q", got)
+	}
+}
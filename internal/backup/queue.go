@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/config"
+)
+
+// DefaultConcurrency is the number of backup runs a queue runs at once
+// unless configured otherwise.
+const DefaultConcurrency = 2
+
+// Target lock policies: what a queue does with a backup of a target that
+// already has one queued or running
+const (
+	LockPolicyQueue = "queue" // run it after the other one
+	LockPolicySkip  = "skip"  // drop it with ErrBackupSkipped
+	LockPolicyFail  = "fail"  // reject it with ErrTargetBusy
+)
+
+var (
+	// ErrTargetBusy rejects backups of targets that already have one queued
+	// or running
+	ErrTargetBusy = errors.New("target already has a backup queued or running")
+
+	// ErrBackupSkipped drops backups of targets that already have one
+	// queued or running
+	ErrBackupSkipped = errors.New("backup skipped, target already has a backup queued or running")
+)
+
+// Task statuses
+const (
+	TaskQueued  = "queued"
+	TaskRunning = "running"
+)
+
+// Task is a backup run in a queue.
+type Task struct {
+	ID        int64      `json:"id"`
+	TargetID  int64      `json:"target_id"`
+	JobID     int64      `json:"job_id,omitempty"` // the schedule job of the run, 0 for manual backups
+	Status    string     `json:"status"`
+	QueuedAt  time.Time  `json:"queued_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// Queue runs backup runs in the order they are submitted, at most
+// Concurrency at a time and one per target at a time.
+type Queue struct {
+	concurrency int
+	policy      string
+
+	mu      sync.Mutex
+	nextID  int64
+	tickets []*Ticket // queued and running, in the order of submission
+}
+
+// Ticket is the place of a backup run in a queue.
+type Ticket struct {
+	queue   *Queue
+	task    Task
+	started chan struct{}
+	done    bool
+}
+
+// NewQueue returns a queue that runs concurrency backup runs at once and
+// handles busy targets by policy.
+func NewQueue(concurrency int, policy string) (*Queue, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("backup concurrency must be at least 1, got %d", concurrency)
+	}
+	switch policy {
+	case LockPolicyQueue, LockPolicySkip, LockPolicyFail:
+	default:
+		return nil, fmt.Errorf("unknown target lock policy %q", policy)
+	}
+	return &Queue{concurrency: concurrency, policy: policy}, nil
+}
+
+// QueueFromEnv returns the queue configured by BACKUP_CONCURRENCY and
+// BACKUP_TARGET_LOCK (queue, skip or fail).
+func QueueFromEnv() (*Queue, error) {
+	concurrency, err := strconv.Atoi(config.GetEnv("BACKUP_CONCURRENCY", strconv.Itoa(DefaultConcurrency)))
+	if err != nil {
+		return nil, fmt.Errorf("BACKUP_CONCURRENCY: %w", err)
+	}
+	return NewQueue(concurrency, config.GetEnv("BACKUP_TARGET_LOCK", LockPolicyQueue))
+}
+
+// Concurrency returns the number of backup runs the queue runs at once.
+func (q *Queue) Concurrency() int {
+	return q.concurrency
+}
+
+// Policy returns the target lock policy of the queue.
+func (q *Queue) Policy() string {
+	return q.policy
+}
+
+// Submit queues a backup run of targetID for jobID, 0 for manual backups.
+// The caller waits for its turn with Wait and must call Done when the run
+// is finished.
+func (q *Queue) Submit(targetID, jobID int64) (*Ticket, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, t := range q.tickets {
+		if t.task.TargetID != targetID {
+			continue
+		}
+		switch q.policy {
+		case LockPolicySkip:
+			return nil, ErrBackupSkipped
+		case LockPolicyFail:
+			return nil, ErrTargetBusy
+		}
+	}
+
+	q.nextID++
+	ticket := &Ticket{
+		queue: q,
+		task: Task{
+			ID:       q.nextID,
+			TargetID: targetID,
+			JobID:    jobID,
+			Status:   TaskQueued,
+			QueuedAt: time.Now(),
+		},
+		started: make(chan struct{}),
+	}
+	q.tickets = append(q.tickets, ticket)
+	q.schedule()
+	return ticket, nil
+}
+
+// Tasks returns the queued and running backup runs in the order they were
+// submitted.
+func (q *Queue) Tasks() []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks := make([]Task, len(q.tickets))
+	for i, t := range q.tickets {
+		tasks[i] = t.task
+	}
+	return tasks
+}
+
+// schedule starts queued runs in order while the queue has room, passing
+// over runs of targets that are busy. It is called with mu held.
+func (q *Queue) schedule() {
+	running := 0
+	busy := make(map[int64]bool)
+	for _, t := range q.tickets {
+		if t.task.Status == TaskRunning {
+			running++
+			busy[t.task.TargetID] = true
+		}
+	}
+
+	for _, t := range q.tickets {
+		if running >= q.concurrency {
+			return
+		}
+		if t.task.Status != TaskQueued || busy[t.task.TargetID] {
+			continue
+		}
+		now := time.Now()
+		t.task.Status = TaskRunning
+		t.task.StartedAt = &now
+		close(t.started)
+		running++
+		busy[t.task.TargetID] = true
+	}
+}
+
+// Started reports whether it is the turn of the run.
+func (t *Ticket) Started() bool {
+	select {
+	case <-t.started:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until it is the turn of the run. If ctx is done first, the
+// run leaves the queue and Wait returns the error of ctx.
+func (t *Ticket) Wait(ctx context.Context) error {
+	select {
+	case <-t.started:
+		return nil
+	case <-ctx.Done():
+		t.Done()
+		return ctx.Err()
+	}
+}
+
+// Done removes the run from the queue, making room for the next one.
+func (t *Ticket) Done() {
+	q := t.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if t.done {
+		return
+	}
+	t.done = true
+	for i, other := range q.tickets {
+		if other == t {
+			q.tickets = append(q.tickets[:i], q.tickets[i+1:]...)
+			break
+		}
+	}
+	q.schedule()
+}
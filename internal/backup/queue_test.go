@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// taskStatuses returns the status of the tasks of q by ID.
+func taskStatuses(q *Queue) map[int64]string {
+	statuses := make(map[int64]string)
+	for _, task := range q.Tasks() {
+		statuses[task.ID] = task.Status
+	}
+	return statuses
+}
+
+func TestNewQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		policy      string
+		wantErr     bool
+	}{
+		{name: "queue", concurrency: 1, policy: LockPolicyQueue},
+		{name: "skip", concurrency: 4, policy: LockPolicySkip},
+		{name: "fail", concurrency: 2, policy: LockPolicyFail},
+		{name: "no concurrency", concurrency: 0, policy: LockPolicyQueue, wantErr: true},
+		{name: "unknown policy", concurrency: 1, policy: "wait", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewQueue(tt.concurrency, tt.policy)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueFromEnv(t *testing.T) {
+	t.Setenv("BACKUP_CONCURRENCY", "3")
+	t.Setenv("BACKUP_TARGET_LOCK", LockPolicyFail)
+	q, err := QueueFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Concurrency() != 3 || q.Policy() != LockPolicyFail {
+		t.Errorf("Unexpected queue %d %s", q.Concurrency(), q.Policy())
+	}
+
+	t.Setenv("BACKUP_CONCURRENCY", "many")
+	if _, err := QueueFromEnv(); err == nil {
+		t.Error("Expected error for an invalid concurrency")
+	}
+}
+
+func TestQueueConcurrency(t *testing.T) {
+	q, err := NewQueue(2, LockPolicyQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tickets []*Ticket
+	for target := int64(1); target <= 3; target++ {
+		ticket, err := q.Submit(target, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tickets = append(tickets, ticket)
+	}
+	if !tickets[0].Started() || !tickets[1].Started() || tickets[2].Started() {
+		t.Fatalf("Expected the first two runs to start, got %v", taskStatuses(q))
+	}
+
+	tickets[1].Done()
+	if err := tickets[2].Wait(context.Background()); err != nil {
+		t.Fatalf("Expected the third run to start: %v", err)
+	}
+	tasks := q.Tasks()
+	if len(tasks) != 2 || tasks[0].TargetID != 1 || tasks[1].TargetID != 3 || tasks[1].StartedAt == nil {
+		t.Errorf("Unexpected tasks %+v", tasks)
+	}
+
+	// Done is idempotent
+	tickets[1].Done()
+	tickets[0].Done()
+	tickets[2].Done()
+	if tasks := q.Tasks(); len(tasks) != 0 {
+		t.Errorf("Expected an empty queue, got %+v", tasks)
+	}
+}
+
+func TestQueueTargetLock(t *testing.T) {
+	q, err := NewQueue(2, LockPolicyQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := q.Submit(1, 10)
+	second, _ := q.Submit(1, 11)
+	other, _ := q.Submit(2, 0)
+	if !first.Started() || second.Started() || !other.Started() {
+		t.Fatalf("Expected the second run of target 1 to wait, got %v", taskStatuses(q))
+	}
+	if tasks := q.Tasks(); tasks[1].JobID != 11 || tasks[1].Status != TaskQueued {
+		t.Errorf("Unexpected queued task %+v", tasks[1])
+	}
+
+	other.Done()
+	if second.Started() {
+		t.Fatal("Expected the run to wait for its target, not for a slot")
+	}
+	first.Done()
+	if !second.Started() {
+		t.Error("Expected the run to start once its target is free")
+	}
+	second.Done()
+}
+
+func TestQueueBusyTargetPolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		expected error
+	}{
+		{policy: LockPolicySkip, expected: ErrBackupSkipped},
+		{policy: LockPolicyFail, expected: ErrTargetBusy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			q, err := NewQueue(1, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			running, _ := q.Submit(1, 0)
+			queued, err := q.Submit(2, 0)
+			if err != nil {
+				t.Fatalf("Expected other targets to queue: %v", err)
+			}
+
+			// Targets with a queued run are busy as well
+			for _, target := range []int64{1, 2} {
+				if _, err := q.Submit(target, 0); !errors.Is(err, tt.expected) {
+					t.Errorf("Expected %v for target %d, got %v", tt.expected, target, err)
+				}
+			}
+
+			running.Done()
+			queued.Done()
+			ticket, err := q.Submit(1, 0)
+			if err != nil {
+				t.Fatalf("Expected a free target to be accepted: %v", err)
+			}
+			ticket.Done()
+		})
+	}
+}
+
+func TestQueueWaitCancelled(t *testing.T) {
+	q, err := NewQueue(1, LockPolicyQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, _ := q.Submit(1, 0)
+	queued, _ := q.Submit(2, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := queued.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait to time out, got %v", err)
+	}
+	if tasks := q.Tasks(); len(tasks) != 1 || tasks[0].TargetID != 1 {
+		t.Errorf("Expected the cancelled run to leave the queue, got %+v", tasks)
+	}
+	running.Done()
+}
@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/casparjones/go-dumper/internal/storage"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// JobMetaConfig is the part of ScheduleJob.MetaConfig used by backups.
+type JobMetaConfig struct {
+	// Offsite is a single destination, as configured before Destinations
+	Offsite *storage.DestinationConfig `json:"offsite,omitempty"`
+
+	// Destinations each receive a copy of every backup of the job
+	Destinations []storage.DestinationConfig `json:"destinations,omitempty"`
+}
+
+// Replicas returns all destinations of the job, Offsite first.
+func (m JobMetaConfig) Replicas() []storage.DestinationConfig {
+	var replicas []storage.DestinationConfig
+	if m.Offsite != nil {
+		replicas = append(replicas, *m.Offsite)
+	}
+	return append(replicas, m.Destinations...)
+}
+
+// ParseJobMetaConfig reads the meta config of a job. Secrets of the
+// destinations stay encrypted until the backup runs.
+func ParseJobMetaConfig(data string) (JobMetaConfig, error) {
+	var meta JobMetaConfig
+	if data == "" {
+		return meta, nil
+	}
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse meta config: %w", err)
+	}
+	return meta, nil
+}
+
+// SealJobMetaConfig checks the destinations in the meta config of a job and
+// encrypts their secrets, as done before the job is saved. Destinations
+// without a name are named after their type; names must be unique. Other
+// keys are kept as they are.
+func SealJobMetaConfig(meta map[string]interface{}) (map[string]interface{}, error) {
+	_, hasOffsite := meta["offsite"]
+	_, hasDestinations := meta["destinations"]
+	if !hasOffsite && !hasDestinations {
+		return meta, nil
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode meta config: %w", err)
+	}
+	var parsed JobMetaConfig
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid destinations: %w", err)
+	}
+
+	names := make(map[string]bool)
+	seal := func(cfg *storage.DestinationConfig) error {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+		}
+		if names[cfg.Name] {
+			return fmt.Errorf("duplicate destination name %q", cfg.Name)
+		}
+		names[cfg.Name] = true
+		if cfg.RetentionDays < 0 {
+			return fmt.Errorf("destination %s: retention_days must not be negative", cfg.Name)
+		}
+		if err := sealDestination(cfg); err != nil {
+			return fmt.Errorf("destination %s: %w", cfg.Name, err)
+		}
+		return nil
+	}
+
+	sealed := make(map[string]interface{}, len(meta))
+	for key, value := range meta {
+		sealed[key] = value
+	}
+	if parsed.Offsite != nil {
+		if err := seal(parsed.Offsite); err != nil {
+			return nil, err
+		}
+		sealed["offsite"] = parsed.Offsite
+	}
+	if hasDestinations {
+		for i := range parsed.Destinations {
+			if err := seal(&parsed.Destinations[i]); err != nil {
+				return nil, err
+			}
+		}
+		sealed["destinations"] = parsed.Destinations
+	}
+	return sealed, nil
+}
+
+// sealDestination checks cfg and encrypts its secrets unless they are
+// encrypted already.
+func sealDestination(cfg *storage.DestinationConfig) error {
+	if cfg.SecretsEncrypted {
+		_, err := openDestination(*cfg)
+		return err
+	}
+	if _, err := storage.NewDestination(*cfg); err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	if err := cfg.MapSecrets(store.EncryptPassword); err != nil {
+		return fmt.Errorf("failed to encrypt destination credentials: %w", err)
+	}
+	cfg.SecretsEncrypted = true
+	return nil
+}
+
+// openDestination returns the storage of a saved destination.
+func openDestination(cfg storage.DestinationConfig) (storage.Storage, error) {
+	if cfg.SecretsEncrypted {
+		if err := cfg.MapSecrets(store.DecryptPassword); err != nil {
+			return nil, fmt.Errorf("failed to decrypt destination credentials: %w", err)
+		}
+	}
+	dest, err := storage.NewDestination(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	return dest, nil
+}
+
+// replica is a destination opened for a run.
+type replica struct {
+	cfg     storage.DestinationConfig
+	config  string // cfg as JSON with encrypted secrets, saved with each copy
+	storage storage.Storage
+}
+
+// openReplicas opens the destinations a run copies its backups to.
+func openReplicas(configs []storage.DestinationConfig) ([]replica, error) {
+	replicas := make([]replica, 0, len(configs))
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+		}
+		if err := sealDestination(&cfg); err != nil {
+			return nil, fmt.Errorf("destination %s: %w", cfg.Name, err)
+		}
+		dest, err := openDestination(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", cfg.Name, err)
+		}
+		config, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode destination %s: %w", cfg.Name, err)
+		}
+		replicas = append(replicas, replica{cfg: cfg, config: string(config), storage: dest})
+	}
+	return replicas, nil
+}
+
+// replicate copies the staged dump at path to the destination of r and
+// records the copy of backup with its outcome. A failed upload leaves the
+// backup itself intact.
+func (d *Dumper) replicate(ctx context.Context, backup *store.Backup, r replica, key, path string) {
+	backupCopy := &store.BackupCopy{
+		BackupID:      backup.ID,
+		Destination:   r.cfg.Name,
+		URI:           r.storage.URI(key),
+		Config:        r.config,
+		RetentionDays: r.cfg.RetentionDays,
+		Status:        store.CopyStatusUploading,
+	}
+	// A copy that is not recorded would never be removed, so don't make it
+	if err := d.repo.CreateBackupCopy(backupCopy); err != nil {
+		return
+	}
+
+	retries := r.cfg.Retries
+	if retries <= 0 {
+		retries = storage.DefaultRetries
+	}
+
+	if err := storage.Upload(ctx, r.storage, key, path, backup.Checksum, retries); err != nil {
+		backupCopy.Status = store.CopyStatusFailed
+		backupCopy.Notes = err.Error()
+	} else {
+		backupCopy.Status = store.CopyStatusSuccess
+	}
+	d.repo.UpdateBackupCopy(backupCopy)
+}
+
+// copyStorage returns a resolver for the URI of backupCopy: files for the
+// primary copy, the saved destination for replicas.
+func copyStorage(files *storage.Resolver, backupCopy *store.BackupCopy) (*storage.Resolver, error) {
+	if backupCopy.Config == "" {
+		return files, nil
+	}
+	var cfg storage.DestinationConfig
+	if err := json.Unmarshal([]byte(backupCopy.Config), &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse destination %s: %w", backupCopy.Destination, err)
+	}
+	dest, err := openDestination(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("destination %s: %w", backupCopy.Destination, err)
+	}
+	return storage.NewResolver(dest), nil
+}
+
+// openBackupCopy returns the content of the file of backupCopy.
+func openBackupCopy(ctx context.Context, files *storage.Resolver, backupCopy *store.BackupCopy) (io.ReadCloser, error) {
+	resolver, err := copyStorage(files, backupCopy)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.Open(ctx, backupCopy.URI)
+}
+
+// DeleteBackupCopy removes the file of backupCopy from where it is stored;
+// files resolves primary copies. The copy's record is left to the caller.
+func DeleteBackupCopy(ctx context.Context, files *storage.Resolver, backupCopy *store.BackupCopy) error {
+	resolver, err := copyStorage(files, backupCopy)
+	if err != nil {
+		return err
+	}
+	return resolver.Delete(ctx, backupCopy.URI)
+}
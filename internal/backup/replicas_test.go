@@ -0,0 +1,216 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/casparjones/go-dumper/internal/storage"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+func setupTestEncryption(t *testing.T) {
+	os.Setenv("APP_ENC_KEY", "utnQ1VVldc0sA94bFDn3foBgyv5U3gVJsgLcoZB3Bj4=")
+	t.Cleanup(func() { os.Unsetenv("APP_ENC_KEY") })
+}
+
+func TestSealJobMetaConfig(t *testing.T) {
+	setupTestEncryption(t)
+
+	meta := map[string]interface{}{
+		"note": "keep me",
+		"offsite": map[string]interface{}{
+			"type":     "webdav",
+			"url":      "https://cloud.example.com/dav/backups",
+			"user":     "alice",
+			"password": "secret",
+		},
+		"destinations": []interface{}{
+			map[string]interface{}{
+				"type":           "webdav",
+				"name":           "archive",
+				"url":            "https://archive.example.com/dav",
+				"retention_days": 90,
+			},
+		},
+	}
+	sealed, err := SealJobMetaConfig(meta)
+	if err != nil {
+		t.Fatalf("SealJobMetaConfig failed: %v", err)
+	}
+	if sealed["note"] != "keep me" {
+		t.Errorf("Expected other keys to be kept, got %v", sealed)
+	}
+
+	data, _ := json.Marshal(sealed)
+	parsed, err := ParseJobMetaConfig(string(data))
+	if err != nil {
+		t.Fatalf("ParseJobMetaConfig failed: %v", err)
+	}
+	replicas := parsed.Replicas()
+	if len(replicas) != 2 {
+		t.Fatalf("Expected 2 replicas, got %+v", replicas)
+	}
+	offsite := replicas[0]
+	if offsite.Name != "webdav" || !offsite.SecretsEncrypted || offsite.Password == "secret" {
+		t.Fatalf("Expected named destination with encrypted password, got %+v", offsite)
+	}
+	if password, err := store.DecryptPassword(offsite.Password); err != nil || password != "secret" {
+		t.Errorf("Expected password to decrypt to %q, got %q (%v)", "secret", password, err)
+	}
+	if replicas[1].Name != "archive" || replicas[1].RetentionDays != 90 {
+		t.Errorf("Unexpected second replica %+v", replicas[1])
+	}
+
+	// Saving the job again keeps the ciphertext as it is
+	var again map[string]interface{}
+	json.Unmarshal(data, &again)
+	resealed, err := SealJobMetaConfig(again)
+	if err != nil {
+		t.Fatalf("SealJobMetaConfig of sealed config failed: %v", err)
+	}
+	data2, _ := json.Marshal(resealed)
+	if string(data2) != string(data) {
+		t.Errorf("Expected sealed config to stay the same:\n%s\n%s", data, data2)
+	}
+
+	invalid := []map[string]interface{}{
+		{"offsite": map[string]interface{}{"type": "ftp"}},
+		{"destinations": []interface{}{
+			map[string]interface{}{"type": "webdav", "url": "https://a.example.com/"},
+			map[string]interface{}{"type": "webdav", "url": "https://b.example.com/"},
+		}},
+		{"destinations": []interface{}{
+			map[string]interface{}{"type": "webdav", "url": "https://a.example.com/", "retention_days": -1},
+		}},
+	}
+	for _, meta := range invalid {
+		if _, err := SealJobMetaConfig(meta); err == nil {
+			t.Errorf("Expected error for %v", meta)
+		}
+	}
+	if sealed, err := SealJobMetaConfig(nil); err != nil || sealed != nil {
+		t.Errorf("Expected nil meta config to pass through, got %v, %v", sealed, err)
+	}
+}
+
+func TestCleanupOldBackupsPerCopy(t *testing.T) {
+	setupTestEncryption(t)
+
+	db, err := store.InitDB(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := store.NewRepository(db)
+
+	server := httptest.NewServer(&webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()})
+	t.Cleanup(server.Close)
+	replicas, err := openReplicas([]storage.DestinationConfig{
+		{Type: storage.DestinationWebDAV, Name: "archive", URL: server.URL + "/", RetentionDays: 90},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	dumper := NewDumper(repo, backupDir)
+	ctx := context.Background()
+
+	target := &store.Target{Name: "app", Host: "localhost", Port: 3306, User: "root", DatabaseMode: store.DatabaseModeAll}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// Backups 3, 30 and 120 days old, each stored locally and in the archive
+	var backups []*store.Backup
+	for _, age := range []int{3, 30, 120} {
+		backup := &store.Backup{
+			TargetID:     target.ID,
+			DatabaseName: "app",
+			StartedAt:    time.Now().AddDate(0, 0, -age),
+			Status:       store.BackupStatusSuccess,
+		}
+		if err := repo.CreateBackup(backup); err != nil {
+			t.Fatal(err)
+		}
+		key := backup.StartedAt.Format("2006-01-02") + ".sql"
+		staging := filepath.Join(t.TempDir(), key)
+		os.WriteFile(staging, []byte(key), 0644)
+		backup.Checksum, _ = storage.FileChecksum(staging)
+
+		dumper.replicate(ctx, backup, replicas[0], key, staging)
+		if err := dumper.storage.Put(ctx, key, staging); err != nil {
+			t.Fatal(err)
+		}
+		backup.FilePath = dumper.storage.URI(key)
+		primary := &store.BackupCopy{BackupID: backup.ID, Destination: store.CopyDestinationPrimary, URI: backup.FilePath, Status: store.CopyStatusSuccess}
+		if err := repo.CreateBackupCopy(primary); err != nil {
+			t.Fatal(err)
+		}
+		repo.UpdateBackup(backup)
+		backups = append(backups, backup)
+	}
+
+	// Primary copies are kept for 7 days, the archive for 90
+	dumper.cleanupOldBackups(target.ID, 7)
+
+	remaining, err := repo.GetBackupsByTarget(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destinations := make(map[int64][]string)
+	for _, backup := range remaining {
+		for _, backupCopy := range backup.Copies {
+			if backupCopy.Status != store.CopyStatusSuccess {
+				t.Errorf("Copy %s of backup %d: %s", backupCopy.Destination, backup.ID, backupCopy.Notes)
+			}
+			destinations[backup.ID] = append(destinations[backup.ID], backupCopy.Destination)
+		}
+	}
+	if len(remaining) != 2 {
+		t.Fatalf("Expected the 120 day old backup to be deleted, got %d backups", len(remaining))
+	}
+	if got := destinations[backups[0].ID]; len(got) != 2 {
+		t.Errorf("Expected both copies of the newest backup, got %v", got)
+	}
+	if got := destinations[backups[1].ID]; len(got) != 1 || got[0] != "archive" {
+		t.Errorf("Expected only the archive copy of the 30 day old backup, got %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, backups[1].StartedAt.Format("2006-01-02")+".sql")); !os.IsNotExist(err) {
+		t.Errorf("Expected local file of the 30 day old backup to be removed, got %v", err)
+	}
+
+	// The archive copy is read once the primary copy is gone
+	restorer := NewRestorer(repo)
+	backup, err := repo.GetBackup(backups[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := restorer.OpenBackupFile(ctx, backup)
+	if err != nil {
+		t.Fatalf("OpenBackupFile failed: %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != backups[1].StartedAt.Format("2006-01-02")+".sql" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	if _, err := openBackupCopy(ctx, dumper.files, &store.BackupCopy{
+		Destination: "archive",
+		URI:         replicas[0].storage.URI(backups[2].StartedAt.Format("2006-01-02") + ".sql"),
+		Config:      replicas[0].config,
+	}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the archive copy of the oldest backup to be deleted, got %v", err)
+	}
+}
@@ -1,28 +1,78 @@
 package backup
 
 import (
-	"bufio"
 	"compress/gzip"
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
 	"strings"
-	"time"
 
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"github.com/casparjones/go-dumper/internal/filecrypt"
+	"github.com/casparjones/go-dumper/internal/storage"
 	"github.com/casparjones/go-dumper/internal/store"
-	"github.com/go-sql-driver/mysql"
 )
 
 type Restorer struct {
-	repo *store.Repository
+	repo   *store.Repository
+	files  *storage.Resolver
+	dumper *Dumper
 }
 
 func NewRestorer(repo *store.Repository) *Restorer {
+	return NewRestorerWithStorage(repo, storage.NewResolver(), NewDumper(repo, ""))
+}
+
+// NewRestorerWithStorage returns a restorer that reads backup files through
+// files, for backups kept outside the local file system. The engines it
+// restores with are those of dumper.
+func NewRestorerWithStorage(repo *store.Repository, files *storage.Resolver, dumper *Dumper) *Restorer {
 	return &Restorer{
-		repo: repo,
+		repo:   repo,
+		files:  files,
+		dumper: dumper,
+	}
+}
+
+// OpenBackupFile returns the content of the file of backup, decrypted but
+// still compressed. See OpenStoredBackupFile.
+func (r *Restorer) OpenBackupFile(ctx context.Context, backup *store.Backup) (io.ReadCloser, error) {
+	file, err := r.OpenStoredBackupFile(ctx, backup)
+	if err != nil {
+		return nil, err
 	}
+	return decryptBackupFile(file)
+}
+
+// OpenStoredBackupFile returns the content of the file of backup as stored.
+// The primary copy is read if it is kept, else the first replica that can be
+// opened. A missing file is reported as an error wrapping fs.ErrNotExist.
+func (r *Restorer) OpenStoredBackupFile(ctx context.Context, backup *store.Backup) (io.ReadCloser, error) {
+	if len(backup.Copies) == 0 {
+		if backup.FilePath == "" {
+			return nil, fmt.Errorf("backup has no file: %w", fs.ErrNotExist)
+		}
+		return r.files.Open(ctx, backup.FilePath)
+	}
+
+	err := fmt.Errorf("backup has no stored copy: %w", fs.ErrNotExist)
+	for _, backupCopy := range backup.Copies {
+		if backupCopy.Status != store.CopyStatusSuccess {
+			continue
+		}
+		var file io.ReadCloser
+		if file, err = openBackupCopy(ctx, r.files, backupCopy); err == nil {
+			return file, nil
+		}
+	}
+	return nil, err
+}
+
+// IsCompressed reports whether the file of backup is gzip compressed.
+func IsCompressed(backup *store.Backup) bool {
+	return strings.HasSuffix(strings.TrimSuffix(backup.FilePath, filecrypt.Suffix), ".gz")
 }
 
 func (r *Restorer) RestoreBackup(ctx context.Context, backupID int64) error {
@@ -36,9 +86,9 @@ func (r *Restorer) RestoreBackup(ctx context.Context, backupID int64) error {
 		return fmt.Errorf("failed to get target: %w", err)
 	}
 
-	password, err := store.DecryptPassword(target.PasswordEnc)
+	connOptions, err := dbconn.ForTarget(ctx, target)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt password: %w", err)
+		return err
 	}
 
 	// Validate backup has a database name (for new multi-database system)
@@ -46,11 +96,10 @@ func (r *Restorer) RestoreBackup(ctx context.Context, backupID int64) error {
 		return fmt.Errorf("backup does not specify a database name - this may be an old backup format")
 	}
 
-	if _, err := os.Stat(backup.FilePath); os.IsNotExist(err) {
+	file, err := r.OpenBackupFile(ctx, backup)
+	if errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("backup file not found: %s", backup.FilePath)
 	}
-
-	file, err := os.Open(backup.FilePath)
 	if err != nil {
 		return fmt.Errorf("failed to open backup file: %w", err)
 	}
@@ -58,7 +107,7 @@ func (r *Restorer) RestoreBackup(ctx context.Context, backupID int64) error {
 
 	var reader io.Reader = file
 
-	if strings.HasSuffix(backup.FilePath, ".gz") {
+	if IsCompressed(backup) {
 		gzReader, err := gzip.NewReader(file)
 		if err != nil {
 			return fmt.Errorf("failed to create gzip reader: %w", err)
@@ -67,56 +116,11 @@ func (r *Restorer) RestoreBackup(ctx context.Context, backupID int64) error {
 		reader = gzReader
 	}
 
-	cfg := mysql.Config{
-		User:   target.User,
-		Passwd: password,
-		Net:    "tcp",
-		Addr:   fmt.Sprintf("%s:%d", target.Host, target.Port),
-		DBName: backup.DatabaseName,
-		Params: map[string]string{
-			"charset":         "utf8mb4",
-			"multiStatements": "true",
-		},
-		ParseTime:            true,
-		AllowNativePasswords: true,
-	}
-
-	db, err := sql.Open("mysql", cfg.FormatDSN())
-	if err != nil {
-		return fmt.Errorf("failed to connect to MySQL: %w", err)
-	}
-	defer db.Close()
-
-	// Set connection settings to avoid timeouts
-	db.SetConnMaxLifetime(30 * time.Second)
-	db.SetMaxOpenConns(1)
-
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping MySQL: %w", err)
-	}
-
-	// Verify that the target database exists
-	if err := r.verifyDatabaseExists(ctx, db, backup.DatabaseName); err != nil {
-		return fmt.Errorf("database verification failed: %w", err)
-	}
-
-	return r.executeSQLFile(ctx, db, reader)
-}
-
-func (r *Restorer) verifyDatabaseExists(ctx context.Context, db *sql.DB, dbName string) error {
-	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?)"
-	
-	err := db.QueryRow(query, dbName).Scan(&exists)
+	engine, err := EngineFor(target.Engine, r.dumper)
 	if err != nil {
-		return fmt.Errorf("failed to check if database exists: %w", err)
+		return err
 	}
-	
-	if !exists {
-		return fmt.Errorf("target database '%s' does not exist - please create it first or enable 'Create database if it doesn't exist' option", dbName)
-	}
-	
-	return nil
+	return engine.Restore(ctx, connOptions, backup.DatabaseName, reader)
 }
 
 // RestoreBackupWithOptions allows restoring with additional options like creating database
@@ -131,9 +135,9 @@ func (r *Restorer) RestoreBackupWithOptions(ctx context.Context, backupID int64,
 		return fmt.Errorf("failed to get target: %w", err)
 	}
 
-	password, err := store.DecryptPassword(target.PasswordEnc)
+	connOptions, err := dbconn.ForTarget(ctx, target)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt password: %w", err)
+		return err
 	}
 
 	// Validate backup has a database name
@@ -141,152 +145,28 @@ func (r *Restorer) RestoreBackupWithOptions(ctx context.Context, backupID int64,
 		return fmt.Errorf("backup does not specify a database name - this may be an old backup format")
 	}
 
-	if _, err := os.Stat(backup.FilePath); os.IsNotExist(err) {
+	// Check the file is there before creating the database
+	file, err := r.OpenBackupFile(ctx, backup)
+	if errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("backup file not found: %s", backup.FilePath)
 	}
-
-	// First connect without specifying database to check/create it
-	if createDatabase {
-		if err := r.ensureDatabaseExists(ctx, target, password, backup.DatabaseName); err != nil {
-			return fmt.Errorf("failed to ensure database exists: %w", err)
-		}
-	}
-
-	// Now proceed with normal restore
-	return r.RestoreBackup(ctx, backupID)
-}
-
-func (r *Restorer) ensureDatabaseExists(ctx context.Context, target *store.Target, password, dbName string) error {
-	// Connect without specifying database
-	cfg := mysql.Config{
-		User:   target.User,
-		Passwd: password,
-		Net:    "tcp",
-		Addr:   fmt.Sprintf("%s:%d", target.Host, target.Port),
-		Params: map[string]string{
-			"charset": "utf8mb4",
-		},
-		ParseTime:            true,
-		AllowNativePasswords: true,
-	}
-
-	db, err := sql.Open("mysql", cfg.FormatDSN())
-	if err != nil {
-		return fmt.Errorf("failed to connect to MySQL: %w", err)
-	}
-	defer db.Close()
-
-	// Set a longer timeout for the connection
-	db.SetConnMaxLifetime(30 * time.Second)
-	db.SetMaxOpenConns(1)
-	
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping MySQL: %w", err)
-	}
-
-	// Check if database exists
-	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?)"
-	err = db.QueryRow(query, dbName).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("failed to check if database exists: %w", err)
+		return fmt.Errorf("failed to open backup file: %w", err)
 	}
+	file.Close()
 
-	// Create database if it doesn't exist
-	if !exists {
-		createQuery := fmt.Sprintf("CREATE DATABASE `%s` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", dbName)
-		_, err = db.Exec(createQuery)
+	if createDatabase {
+		engine, err := EngineFor(target.Engine, r.dumper)
 		if err != nil {
-			return fmt.Errorf("failed to create database '%s': %w", dbName, err)
-		}
-	}
-
-	return nil
-}
-
-func (r *Restorer) executeSQLFile(ctx context.Context, db *sql.DB, reader io.Reader) error {
-	scanner := bufio.NewScanner(reader)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // Increase buffer size for large statements
-
-	var currentStatement strings.Builder
-	lineNumber := 0
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		lineNumber++
-
-		if line == "" || strings.HasPrefix(line, "--") || strings.HasPrefix(line, "/*") {
-			continue
-		}
-
-		currentStatement.WriteString(line)
-		currentStatement.WriteString(" ")
-
-		if strings.HasSuffix(line, ";") {
-			stmt := strings.TrimSpace(currentStatement.String())
-			if stmt != "" && stmt != ";" {
-				if err := r.executeStatement(ctx, db, stmt); err != nil {
-					return fmt.Errorf("error at line %d: %w\nStatement: %s", lineNumber, err, stmt[:min(len(stmt), 100)])
-				}
-			}
-			currentStatement.Reset()
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading SQL file: %w", err)
-	}
-
-	if currentStatement.Len() > 0 {
-		stmt := strings.TrimSpace(currentStatement.String())
-		if stmt != "" && stmt != ";" {
-			if err := r.executeStatement(ctx, db, stmt); err != nil {
-				return fmt.Errorf("error in final statement: %w\nStatement: %s", err, stmt[:min(len(stmt), 100)])
-			}
+			return err
 		}
-	}
-
-	return nil
-}
-
-func (r *Restorer) executeStatement(ctx context.Context, db *sql.DB, statement string) error {
-	statement = strings.TrimSpace(statement)
-	if statement == "" {
-		return nil
-	}
-
-	if strings.HasPrefix(strings.ToUpper(statement), "LOCK TABLES") ||
-		strings.HasPrefix(strings.ToUpper(statement), "UNLOCK TABLES") {
-		return nil
-	}
-
-	if strings.HasPrefix(statement, "/*!") && strings.HasSuffix(statement, "*/;") {
-		versionComment := statement[3 : len(statement)-3]
-
-		if len(versionComment) > 5 {
-			versionStr := versionComment[:5]
-			if strings.HasPrefix(versionStr, "40") || strings.HasPrefix(versionStr, "50") {
-				actualSQL := strings.TrimSpace(versionComment[5:])
-				if actualSQL != "" {
-					_, err := db.ExecContext(ctx, actualSQL)
-					return err
-				}
-			}
-		}
-		return nil
-	}
-
-	_, err := db.ExecContext(ctx, statement)
-	if err != nil {
-		if strings.Contains(err.Error(), "Unknown database") {
-			return fmt.Errorf("database does not exist - please create it first: %w", err)
-		}
-		if strings.Contains(err.Error(), "Access denied") {
-			return fmt.Errorf("access denied - check user permissions: %w", err)
+		if err := engine.CreateDatabase(ctx, connOptions, backup.DatabaseName); err != nil {
+			return fmt.Errorf("failed to ensure database exists: %w", err)
 		}
 	}
 
-	return err
+	// Now proceed with normal restore
+	return r.RestoreBackup(ctx, backupID)
 }
 
 func min(a, b int) int {
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/casparjones/go-dumper/internal/storage"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// RotateEncryptionKey re-encrypts the target passwords and destination
+// secrets in repo under the current APP_ENC_KEY. Backup files encrypted
+// with EncryptionMaster keep their data keys wrapped by the key they were
+// written with, so previous keys are needed until those backups expire.
+func RotateEncryptionKey(repo *store.Repository) (*store.KeyRotation, error) {
+	return repo.RotateEncryptionKey(resealJobMetaConfig, resealCopyConfig)
+}
+
+// resealJobMetaConfig re-encrypts the destination secrets of a job's meta
+// config. Configs without encrypted secrets are returned as they are.
+func resealJobMetaConfig(data string) (string, error) {
+	var meta map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		return "", fmt.Errorf("failed to parse meta config: %w", err)
+	}
+	parsed, err := ParseJobMetaConfig(data)
+	if err != nil {
+		return "", err
+	}
+
+	changed := false
+	if parsed.Offsite != nil {
+		if changed, err = resealDestination(parsed.Offsite); err != nil {
+			return "", err
+		}
+		meta["offsite"] = parsed.Offsite
+	}
+	for i := range parsed.Destinations {
+		resealed, err := resealDestination(&parsed.Destinations[i])
+		if err != nil {
+			return "", err
+		}
+		changed = changed || resealed
+	}
+	if !changed {
+		return data, nil
+	}
+	if parsed.Destinations != nil {
+		meta["destinations"] = parsed.Destinations
+	}
+
+	resealed, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode meta config: %w", err)
+	}
+	return string(resealed), nil
+}
+
+// resealCopyConfig re-encrypts the secrets of the destination saved with a
+// backup copy.
+func resealCopyConfig(data string) (string, error) {
+	var cfg storage.DestinationConfig
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse destination: %w", err)
+	}
+	changed, err := resealDestination(&cfg)
+	if err != nil || !changed {
+		return data, err
+	}
+
+	resealed, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode destination: %w", err)
+	}
+	return string(resealed), nil
+}
+
+// resealDestination re-encrypts the secrets of cfg under the current key and
+// reports whether any of them changed.
+func resealDestination(cfg *storage.DestinationConfig) (bool, error) {
+	if !cfg.SecretsEncrypted {
+		return false, nil
+	}
+	changed := false
+	err := cfg.MapSecrets(func(secret string) (string, error) {
+		resealed, err := store.ReencryptPassword(secret)
+		changed = changed || resealed != secret
+		return resealed, err
+	})
+	if err != nil {
+		return false, fmt.Errorf("destination %s: %w", cfg.Name, err)
+	}
+	return changed, nil
+}
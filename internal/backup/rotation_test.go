@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// legacyCiphertext encrypts password with APP_ENC_KEY in the format used
+// before key IDs.
+func legacyCiphertext(t *testing.T, password string) string {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("APP_ENC_KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(password), nil))
+}
+
+func TestResealJobMetaConfig(t *testing.T) {
+	setupTestEncryption(t)
+
+	legacy := legacyCiphertext(t, "dav-secret")
+	data := `{"note":"keep me","destinations":[{"name":"dav","type":"webdav","url":"https://cloud.example.com/dav","password":"` +
+		legacy + `","secrets_encrypted":true},{"name":"plain","type":"webdav","url":"https://other.example.com/dav"}]}`
+
+	resealed, err := resealJobMetaConfig(data)
+	if err != nil {
+		t.Fatalf("resealJobMetaConfig failed: %v", err)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal([]byte(resealed), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["note"] != "keep me" {
+		t.Errorf("Expected other keys to be kept, got %v", meta)
+	}
+
+	parsed, err := ParseJobMetaConfig(resealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Destinations) != 2 {
+		t.Fatalf("Expected 2 destinations, got %+v", parsed.Destinations)
+	}
+	keyID, err := store.CurrentKeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := parsed.Destinations[0].Password
+	if store.KeyID(password) != keyID {
+		t.Errorf("Expected password under key %s, got %q", keyID, password)
+	}
+	if decrypted, err := store.DecryptPassword(password); err != nil || decrypted != "dav-secret" {
+		t.Errorf("Expected %q, got %q (%v)", "dav-secret", decrypted, err)
+	}
+
+	// Resealing again changes nothing
+	again, err := resealJobMetaConfig(resealed)
+	if err != nil || again != resealed {
+		t.Errorf("Expected meta config to be kept, got %q (%v)", again, err)
+	}
+
+	copyConfig := `{"name":"dav","type":"webdav","password":"` + legacy + `","secrets_encrypted":true}`
+	resealedCopy, err := resealCopyConfig(copyConfig)
+	if err != nil {
+		t.Fatalf("resealCopyConfig failed: %v", err)
+	}
+	if resealedCopy == copyConfig || !strings.Contains(resealedCopy, `"password":"v1:`+keyID+`:`) {
+		t.Errorf("Expected copy config to be resealed, got %q", resealedCopy)
+	}
+}
@@ -0,0 +1,194 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Mask types of a MaskRule
+const (
+	MaskHash  = "hash"  // SHA-256 of the value (salted with Value), as hex
+	MaskNull  = "null"  // NULL
+	MaskEmail = "email" // a fake address derived from the value
+	MaskFixed = "fixed" // Value
+)
+
+// SanitizeRules limit and mask the rows of a dump so it can be handed out
+// without personal data. They are stored as JSON in sanitize profiles.
+type SanitizeRules struct {
+	Tables []TableRule `json:"tables"`
+}
+
+// TableRule applies to every table matching Table, a pattern as in
+// TableFilter.
+type TableRule struct {
+	Table string `json:"table"`
+
+	// Where is an SQL condition rows must meet, e.g.
+	// "created_at > NOW() - INTERVAL 90 DAY"
+	Where string `json:"where,omitempty"`
+
+	// Masks maps column names to the mask applied to their values
+	Masks map[string]MaskRule `json:"masks,omitempty"`
+}
+
+// MaskRule replaces the values of one column. Value is the replacement for
+// MaskFixed and the salt for MaskHash and MaskEmail.
+type MaskRule struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+// ParseSanitizeRules decodes and validates the rules of a sanitize profile.
+func ParseSanitizeRules(data string) (*SanitizeRules, error) {
+	var rules SanitizeRules
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse sanitize rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// Validate reports the first rule that cannot be applied.
+func (r *SanitizeRules) Validate() error {
+	for i, rule := range r.Tables {
+		if err := (TableFilter{Include: []string{rule.Table}}).Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if rule.Where == "" && len(rule.Masks) == 0 {
+			return fmt.Errorf("rule %d for %s has neither a where condition nor masks", i+1, rule.Table)
+		}
+		columns := make(map[string]string)
+		for column, mask := range rule.Masks {
+			if strings.TrimSpace(column) == "" {
+				return fmt.Errorf("rule %d for %s masks a column without a name", i+1, rule.Table)
+			}
+			// Column names match case-insensitively, so these would mask the
+			// same column twice
+			if other, ok := columns[strings.ToLower(column)]; ok {
+				return fmt.Errorf("rule %d for %s masks the same column as %s and %s", i+1, rule.Table, other, column)
+			}
+			columns[strings.ToLower(column)] = column
+			switch mask.Type {
+			case MaskHash, MaskNull, MaskEmail, MaskFixed:
+			default:
+				return fmt.Errorf("rule %d: unknown mask type %q for column %s", i+1, mask.Type, column)
+			}
+		}
+	}
+	return nil
+}
+
+// tableSanitizer is the combination of all rules matching one table.
+type tableSanitizer struct {
+	table string
+	where string
+	masks map[string]columnMask // by lower case column name
+}
+
+// columnMask is the mask of a column as a rule names it.
+type columnMask struct {
+	column string
+	rule   MaskRule
+}
+
+// forTable combines the rules matching table: where conditions must all
+// hold, a later mask of the same column replaces an earlier one. Column names
+// match case-insensitively. It returns nil if no rule matches.
+func (r *SanitizeRules) forTable(database, table string) *tableSanitizer {
+	if r == nil {
+		return nil
+	}
+
+	var (
+		conditions []string
+		masks      map[string]columnMask
+	)
+	for _, rule := range r.Tables {
+		if !matchTable([]string{rule.Table}, database, table) {
+			continue
+		}
+		if rule.Where != "" {
+			conditions = append(conditions, "("+rule.Where+")")
+		}
+		for column, mask := range rule.Masks {
+			if masks == nil {
+				masks = make(map[string]columnMask)
+			}
+			masks[strings.ToLower(column)] = columnMask{column: column, rule: mask}
+		}
+	}
+
+	if conditions == nil && masks == nil {
+		return nil
+	}
+	return &tableSanitizer{table: table, where: strings.Join(conditions, " AND "), masks: masks}
+}
+
+// columnMasks returns the mask of each of the unquoted columns of the table,
+// nil for unmasked columns. A mask of a column the table does not have is an
+// error, as the column it was meant for would go out unmasked.
+func (s *tableSanitizer) columnMasks(columns []string) ([]*MaskRule, error) {
+	if s == nil || len(s.masks) == 0 {
+		return nil, nil
+	}
+	masks := make([]*MaskRule, len(columns))
+	found := make(map[string]bool)
+	for i, column := range columns {
+		if mask, ok := s.masks[strings.ToLower(column)]; ok {
+			masks[i] = &mask.rule
+			found[strings.ToLower(column)] = true
+		}
+	}
+
+	var missing []string
+	for name, mask := range s.masks {
+		if !found[name] {
+			missing = append(missing, mask.column)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("sanitize rules mask column %s, which table %s does not have", strings.Join(missing, ", "), s.table)
+	}
+	return masks, nil
+}
+
+// apply returns the masked value of val. NULL stays NULL, so masking does not
+// change which rows have a value.
+func (m *MaskRule) apply(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+
+	var original string
+	switch v := val.(type) {
+	case []byte:
+		original = string(v)
+	default:
+		original = fmt.Sprint(v)
+	}
+
+	switch m.Type {
+	case MaskNull:
+		return nil
+	case MaskFixed:
+		return m.Value
+	case MaskEmail:
+		return "user-" + maskHash(m.Value, original)[:12] + "@example.com"
+	default:
+		return maskHash(m.Value, original)
+	}
+}
+
+// maskHash is deterministic so masked keys still join across tables.
+func maskHash(salt, value string) string {
+	sum := sha256.Sum256([]byte(salt + value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSanitizeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "where and masks", data: `{"tables":[{"table":"users","where":"active = 1","masks":{"email":{"type":"email"}}}]}`},
+		{name: "no rules", data: `{}`},
+		{name: "malformed json", data: `{"tables":`, wantErr: true},
+		{name: "bad pattern", data: `{"tables":[{"table":"[abc","where":"1"}]}`, wantErr: true},
+		{name: "empty rule", data: `{"tables":[{"table":"users"}]}`, wantErr: true},
+		{name: "unknown mask", data: `{"tables":[{"table":"users","masks":{"name":{"type":"shuffle"}}}]}`, wantErr: true},
+		{name: "unnamed column", data: `{"tables":[{"table":"users","masks":{" ":{"type":"null"}}}]}`, wantErr: true},
+		{name: "column masked twice", data: `{"tables":[{"table":"users","masks":{"email":{"type":"null"},"Email":{"type":"hash"}}}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSanitizeRules(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSanitizeRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitizeRulesForTable(t *testing.T) {
+	rules := &SanitizeRules{Tables: []TableRule{
+		{Table: "users", Where: "active = 1", Masks: map[string]MaskRule{"email": {Type: MaskEmail}}},
+		{Table: "shop.*", Where: "deleted_at IS NULL", Masks: map[string]MaskRule{"EMAIL": {Type: MaskNull}}},
+		{Table: "orders", Masks: map[string]MaskRule{"address": {Type: MaskFixed, Value: "redacted"}}},
+	}}
+
+	s := rules.forTable("shop", "users")
+	if s == nil {
+		t.Fatal("Expected rules for shop.users")
+	}
+	if s.where != "(active = 1) AND (deleted_at IS NULL)" {
+		t.Errorf("Unexpected where condition %q", s.where)
+	}
+	if mask := s.masks["email"]; mask.rule.Type != MaskNull {
+		t.Errorf("Expected the later mask to win, got %+v", mask)
+	}
+
+	if s := rules.forTable("other", "orders"); s == nil || s.where != "" {
+		t.Errorf("Expected masks without condition for other.orders, got %+v", s)
+	}
+	if s := rules.forTable("other", "products"); s != nil {
+		t.Errorf("Expected no rules for other.products, got %+v", s)
+	}
+
+	var none *SanitizeRules
+	if s := none.forTable("shop", "users"); s != nil {
+		t.Errorf("Expected nil rules to match nothing, got %+v", s)
+	}
+}
+
+func TestTableSanitizerColumnMasks(t *testing.T) {
+	rules := &SanitizeRules{Tables: []TableRule{
+		{Table: "users", Masks: map[string]MaskRule{"Email": {Type: MaskEmail}}},
+	}}
+	s := rules.forTable("shop", "users")
+
+	masks, err := s.columnMasks([]string{"id", "email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masks) != 2 || masks[0] != nil || masks[1] == nil || masks[1].Type != MaskEmail {
+		t.Errorf("Expected the mis-cased column to be masked, got %+v", masks)
+	}
+
+	_, err = s.columnMasks([]string{"id", "mail"})
+	if err == nil || !strings.Contains(err.Error(), "Email") || !strings.Contains(err.Error(), "users") {
+		t.Errorf("Expected an error naming the column and table, got %v", err)
+	}
+
+	var none *tableSanitizer
+	if masks, err := none.columnMasks([]string{"id"}); masks != nil || err != nil {
+		t.Errorf("Expected no masks, got %+v, %v", masks, err)
+	}
+}
+
+func TestMaskRuleApply(t *testing.T) {
+	email := []byte("jane@example.org")
+
+	if v := (&MaskRule{Type: MaskNull}).apply(email); v != nil {
+		t.Errorf("null mask = %#v, expected nil", v)
+	}
+	if v := (&MaskRule{Type: MaskFixed, Value: "x"}).apply(email); v != "x" {
+		t.Errorf("fixed mask = %#v, expected \"x\"", v)
+	}
+	if v := (&MaskRule{Type: MaskHash}).apply(nil); v != nil {
+		t.Errorf("Expected NULL to stay NULL, got %#v", v)
+	}
+
+	hashed := (&MaskRule{Type: MaskHash}).apply(email)
+	if hashed != (&MaskRule{Type: MaskHash}).apply(email) {
+		t.Error("Expected hash mask to be deterministic")
+	}
+	if hashed == (&MaskRule{Type: MaskHash, Value: "salt"}).apply(email) {
+		t.Error("Expected the salt to change the hash")
+	}
+	if h, _ := hashed.(string); len(h) != 64 {
+		t.Errorf("Expected a hex SHA-256, got %#v", hashed)
+	}
+
+	fake, _ := (&MaskRule{Type: MaskEmail}).apply(email).(string)
+	if !strings.HasPrefix(fake, "user-") || !strings.HasSuffix(fake, "@example.com") || strings.Contains(fake, "jane") {
+		t.Errorf("Unexpected fake email %q", fake)
+	}
+}
@@ -0,0 +1,449 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"modernc.org/sqlite"
+)
+
+// sqliteDatabase is SQLite's name for the database of a file, the only
+// database of SQLite targets.
+const sqliteDatabase = "main"
+
+// sqliteMaskFunction applies a MaskRule in the SQL of a sanitized copy:
+// dumper_mask(type, value, column).
+const sqliteMaskFunction = "dumper_mask"
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(sqliteMaskFunction, 3, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		maskType, _ := args[0].(string)
+		value, _ := args[1].(string)
+		mask := MaskRule{Type: maskType, Value: value}
+		return mask.apply(args[2]), nil
+	})
+}
+
+// sqliteEngine is the Engine of SQLite targets, which are a database file
+// rather than a server. Dumps are not SQL scripts but a copy of the file
+// taken with VACUUM INTO, which is consistent while other processes keep
+// writing. The table filter and sanitize rules are applied to the copy.
+// Restores replace the file with the copy in one rename.
+type sqliteEngine struct{}
+
+// open opens the file of conn in mode ("ro" or "rw") and checks that it is
+// a database.
+func (e sqliteEngine) open(ctx context.Context, conn dbconn.Options, mode string) (*dbconn.DB, error) {
+	conn.Params = map[string]string{"mode": mode}
+
+	db, err := dbconn.Open(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite file: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(new(int)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite file %s: %w", conn.Path, err)
+	}
+	return db, nil
+}
+
+func (e sqliteEngine) Ping(ctx context.Context, conn dbconn.Options) error {
+	if err := dbconn.CheckSQLitePath(conn.Path); err != nil {
+		return err
+	}
+	db, err := e.open(ctx, conn, "ro")
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func (e sqliteEngine) ListDatabases(ctx context.Context, conn dbconn.Options) ([]string, error) {
+	if err := e.Ping(ctx, conn); err != nil {
+		return nil, err
+	}
+	return []string{sqliteDatabase}, nil
+}
+
+// checkDatabase reports an error for databases other than sqliteDatabase,
+// and for files of conn outside the allowed directories, which targets saved
+// before they were restricted may still name.
+func (e sqliteEngine) checkDatabase(conn dbconn.Options, database string) error {
+	if database != sqliteDatabase {
+		return fmt.Errorf("sqlite targets have only the database %q, not %q", sqliteDatabase, database)
+	}
+	return dbconn.CheckSQLitePath(conn.Path)
+}
+
+func (e sqliteEngine) Dump(ctx context.Context, conn dbconn.Options, w io.Writer, options *DumpOptions, tempDir string) (*DumpResult, error) {
+	if err := e.checkDatabase(conn, options.DatabaseName); err != nil {
+		return nil, err
+	}
+	if !options.IncludeStructure {
+		return nil, fmt.Errorf("sqlite backups are database files, which always include the structure")
+	}
+
+	db, err := e.open(ctx, conn, "ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	dir, err := os.MkdirTemp(tempDir, "sqlite-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyPath := filepath.Join(dir, "copy.sqlite")
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", copyPath); err != nil {
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	copyOptions := conn
+	copyOptions.Path = copyPath
+	result, err := e.filterCopy(ctx, copyOptions, options)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(copyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database copy: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return nil, fmt.Errorf("failed to write database copy: %w", err)
+	}
+	return result, nil
+}
+
+// sqliteTrigger is a trigger of a database copy, dropped while its rows are
+// changed and created again afterwards.
+type sqliteTrigger struct {
+	Table string
+	SQL   string
+}
+
+// filterCopy applies the table filter, the content and the sanitize rules of
+// options to the copy at conn.Path.
+func (e sqliteEngine) filterCopy(ctx context.Context, conn dbconn.Options, options *DumpOptions) (*DumpResult, error) {
+	db, err := e.open(ctx, conn, "rw")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Every statement runs on one connection, without foreign key actions
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer c.Close()
+	if _, err := c.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return nil, fmt.Errorf("failed to disable foreign keys: %w", err)
+	}
+
+	all, err := e.tables(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	result := &DumpResult{}
+	result.Tables, result.ExcludedTables = options.Tables.filterTables(options.DatabaseName, all)
+
+	// Triggers would fire on the rows deleted and masked below
+	triggers, err := e.dropTriggers(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := len(result.ExcludedTables) > 0
+	for _, table := range result.ExcludedTables {
+		if _, err := c.ExecContext(ctx, "DROP TABLE "+sqliteQuoteIdent(table)); err != nil {
+			return nil, fmt.Errorf("failed to remove excluded table %s: %w", table, err)
+		}
+	}
+
+	for _, table := range result.Tables {
+		if !options.IncludeData || options.Tables.IsSchemaOnly(options.DatabaseName, table) {
+			if options.IncludeData {
+				result.SchemaOnlyTables = append(result.SchemaOnlyTables, table)
+			}
+			if _, err := c.ExecContext(ctx, "DELETE FROM "+sqliteQuoteIdent(table)); err != nil {
+				return nil, fmt.Errorf("failed to remove rows of %s: %w", table, err)
+			}
+			changed = true
+			continue
+		}
+
+		sanitizer := options.Sanitize.forTable(options.DatabaseName, table)
+		if sanitizer == nil {
+			continue
+		}
+		if err := e.sanitizeTable(ctx, c, table, sanitizer); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+
+	if options.IncludeTriggers {
+		excluded := make(map[string]bool)
+		for _, table := range result.ExcludedTables {
+			excluded[table] = true
+		}
+		for _, trigger := range triggers {
+			if excluded[trigger.Table] {
+				continue
+			}
+			if _, err := c.ExecContext(ctx, trigger.SQL); err != nil {
+				return nil, fmt.Errorf("failed to restore trigger of %s: %w", trigger.Table, err)
+			}
+		}
+	}
+
+	// Removed rows would otherwise stay readable in free pages
+	if changed {
+		if _, err := c.ExecContext(ctx, "VACUUM"); err != nil {
+			return nil, fmt.Errorf("failed to compact database copy: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// tables returns the tables of the database, without SQLite's own and the
+// shadow tables of virtual tables.
+func (e sqliteEngine) tables(ctx context.Context, q querier) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name FROM pragma_table_list
+WHERE schema = 'main' AND type IN ('table', 'virtual') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// dropTriggers drops all triggers and returns them.
+func (e sqliteEngine) dropTriggers(ctx context.Context, c *sql.Conn) ([]sqliteTrigger, error) {
+	rows, err := c.QueryContext(ctx, "SELECT name, tbl_name, sql FROM sqlite_master WHERE type = 'trigger' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list triggers: %w", err)
+	}
+
+	var (
+		names    []string
+		triggers []sqliteTrigger
+	)
+	for rows.Next() {
+		var name string
+		var trigger sqliteTrigger
+		if err := rows.Scan(&name, &trigger.Table, &trigger.SQL); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list triggers: %w", err)
+		}
+		names = append(names, name)
+		triggers = append(triggers, trigger)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list triggers: %w", err)
+	}
+
+	for _, name := range names {
+		if _, err := c.ExecContext(ctx, "DROP TRIGGER "+sqliteQuoteIdent(name)); err != nil {
+			return nil, fmt.Errorf("failed to drop trigger %s: %w", name, err)
+		}
+	}
+	return triggers, nil
+}
+
+// sanitizeTable deletes the rows of table that don't meet the conditions of
+// sanitizer and masks the others.
+func (e sqliteEngine) sanitizeTable(ctx context.Context, c *sql.Conn, table string, sanitizer *tableSanitizer) error {
+	quoted := sqliteQuoteIdent(table)
+	if sanitizer.where != "" {
+		// Rows for which the condition is NULL are left out, as by WHERE
+		if _, err := c.ExecContext(ctx, "DELETE FROM "+quoted+" WHERE NOT coalesce(("+sanitizer.where+"), 0)"); err != nil {
+			return fmt.Errorf("failed to filter rows of %s: %w", table, err)
+		}
+	}
+
+	rows, err := c.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to get columns of %s: %w", table, err)
+		}
+		columns = append(columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+
+	masks, err := sanitizer.columnMasks(columns)
+	if err != nil {
+		return err
+	}
+	var (
+		assignments []string
+		args        []interface{}
+	)
+	for i, mask := range masks {
+		if mask == nil {
+			continue
+		}
+		column := sqliteQuoteIdent(columns[i])
+		assignments = append(assignments, fmt.Sprintf("%s = %s(?, ?, %s)", column, sqliteMaskFunction, column))
+		args = append(args, mask.Type, mask.Value)
+	}
+	if len(assignments) == 0 {
+		return nil
+	}
+	if _, err := c.ExecContext(ctx, "UPDATE "+quoted+" SET "+strings.Join(assignments, ", "), args...); err != nil {
+		return fmt.Errorf("failed to mask columns of %s: %w", table, err)
+	}
+	return nil
+}
+
+// CreateDatabase creates an empty file, which SQLite opens as an empty
+// database, unless the file exists.
+func (e sqliteEngine) CreateDatabase(ctx context.Context, conn dbconn.Options, database string) error {
+	if err := e.checkDatabase(conn, database); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(conn.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create database file '%s': %w", conn.Path, err)
+	}
+	return file.Close()
+}
+
+// Restore writes the copy read from r next to the file of conn and renames
+// it over the file once it is complete and intact. Processes that have the
+// file open keep reading the old one until they open it again.
+func (e sqliteEngine) Restore(ctx context.Context, conn dbconn.Options, database string, r io.Reader) error {
+	if err := e.checkDatabase(conn, database); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(conn.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("target database file '%s' does not exist - please create it first or enable 'Create database if it doesn't exist' option", conn.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check database file: %w", err)
+	}
+
+	dir := filepath.Dir(conn.Path)
+	file, err := os.CreateTemp(dir, "."+filepath.Base(conn.Path)+".restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create restore file: %w", err)
+	}
+	restorePath := file.Name()
+	defer os.Remove(restorePath)
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write restore file: %w", err)
+	}
+	if err := file.Chmod(info.Mode().Perm()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to set permissions of restore file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync restore file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close restore file: %w", err)
+	}
+
+	restoreOptions := conn
+	restoreOptions.Path = restorePath
+	if err := e.checkIntegrity(ctx, restoreOptions); err != nil {
+		return err
+	}
+
+	// A write-ahead log left behind by the old file would be replayed into
+	// the new one
+	if err := e.checkpoint(ctx, conn); err != nil {
+		return err
+	}
+
+	if err := os.Rename(restorePath, conn.Path); err != nil {
+		return fmt.Errorf("failed to replace database file: %w", err)
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// checkIntegrity reports an error unless the file of conn is an intact
+// database.
+func (e sqliteEngine) checkIntegrity(ctx context.Context, conn dbconn.Options) error {
+	db, err := e.open(ctx, conn, "ro")
+	if err != nil {
+		return fmt.Errorf("backup is not a valid SQLite database: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check(1)").Scan(&result); err != nil {
+		return fmt.Errorf("failed to check backup integrity: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup failed the integrity check: %s", result)
+	}
+	return nil
+}
+
+// checkpoint moves the write-ahead log of the file of conn, if any, into the
+// file and empties it.
+func (e sqliteEngine) checkpoint(ctx context.Context, conn dbconn.Options) error {
+	db, err := e.open(ctx, conn, "rw")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint database file: %w", err)
+	}
+	return nil
+}
+
+// sqliteQuoteIdent quotes an identifier for SQLite.
+func sqliteQuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
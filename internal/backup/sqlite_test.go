@@ -0,0 +1,269 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/casparjones/go-dumper/internal/dbconn"
+)
+
+// sqliteTargetDir returns a temporary directory SQLite targets may use.
+func sqliteTargetDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("SQLITE_TARGET_DIRS", dir)
+	return dir
+}
+
+// createSQLiteFile creates a database at path with statements.
+func createSQLiteFile(t *testing.T, path string, statements ...string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+}
+
+// querySQLite returns the first column of the rows of query on the file at
+// path.
+func querySQLite(t *testing.T, path, query string) []string {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value.String)
+	}
+	return values
+}
+
+func TestSQLiteDumpAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := sqliteTargetDir(t)
+	source := filepath.Join(dir, "app.db")
+	createSQLiteFile(t, source,
+		"PRAGMA journal_mode = WAL",
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, active INTEGER)",
+		"CREATE TABLE sessions (token TEXT PRIMARY KEY, user_id INTEGER REFERENCES users (id) ON DELETE CASCADE)",
+		"CREATE TABLE audit (message TEXT)",
+		"CREATE TABLE secrets (value TEXT)",
+		"CREATE VIEW active_users AS SELECT id, email FROM users WHERE active",
+		"CREATE TRIGGER users_audit AFTER DELETE ON users BEGIN INSERT INTO audit VALUES ('deleted ' || OLD.id); END",
+		"INSERT INTO users VALUES (1, 'jane@example.com', 1), (2, 'john@example.com', 0), (3, NULL, 1)",
+		"INSERT INTO sessions VALUES ('a', 1), ('b', 2)",
+		"INSERT INTO secrets VALUES ('hunter2')",
+	)
+
+	rules, err := ParseSanitizeRules(`{"tables": [{"table": "users", "where": "active", "masks": {"email": {"type": "email"}}}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &DumpOptions{
+		DatabaseName:     "main",
+		IncludeStructure: true,
+		IncludeData:      true,
+		IncludeTriggers:  true,
+		Tables:           TableFilter{Exclude: []string{"secrets"}, SchemaOnly: []string{"sessions"}},
+		Sanitize:         rules,
+	}
+
+	conn := dbconn.Options{Engine: dbconn.EngineSQLite, Path: source}
+	var dump bytes.Buffer
+	result, err := sqliteEngine{}.Dump(ctx, conn, &dump, options, dir)
+	if err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if got := result.Tables; len(got) != 3 || got[0] != "audit" || got[1] != "sessions" || got[2] != "users" {
+		t.Errorf("Unexpected tables %v", got)
+	}
+	if got := result.ExcludedTables; len(got) != 1 || got[0] != "secrets" {
+		t.Errorf("Unexpected excluded tables %v", got)
+	}
+	if got := result.SchemaOnlyTables; len(got) != 1 || got[0] != "sessions" {
+		t.Errorf("Unexpected schema-only tables %v", got)
+	}
+	if bytes.Contains(dump.Bytes(), []byte("hunter2")) || bytes.Contains(dump.Bytes(), []byte("jane@example.com")) {
+		t.Error("Dump contains removed data")
+	}
+	if copies, _ := filepath.Glob(filepath.Join(dir, "sqlite-*")); len(copies) != 0 {
+		t.Errorf("Expected the temporary copy to be removed, found %v", copies)
+	}
+
+	// Restore over a file that is in use, with changes only in its
+	// write-ahead log
+	target := filepath.Join(dir, "restored.db")
+	inUse, err := sql.Open("sqlite", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inUse.Close()
+	inUse.SetMaxOpenConns(1)
+	for _, statement := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA wal_autocheckpoint = 0",
+		"CREATE TABLE old (id INTEGER)",
+		"INSERT INTO old VALUES (1)",
+	} {
+		if _, err := inUse.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	restoreConn := dbconn.Options{Engine: dbconn.EngineSQLite, Path: target}
+	if err := (sqliteEngine{}).Restore(ctx, restoreConn, "main", bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	tables := querySQLite(t, target, "SELECT name FROM sqlite_master ORDER BY name")
+	expected := []string{"active_users", "audit", "sessions", "sqlite_autoindex_sessions_1", "users", "users_audit"}
+	if len(tables) != len(expected) {
+		t.Fatalf("Expected objects %v, got %v", expected, tables)
+	}
+	for i := range expected {
+		if tables[i] != expected[i] {
+			t.Errorf("Expected objects %v, got %v", expected, tables)
+			break
+		}
+	}
+
+	emails := querySQLite(t, target, "SELECT email FROM users ORDER BY id")
+	if len(emails) != 2 || emails[0] != "user-"+maskHash("", "jane@example.com")[:12]+"@example.com" || emails[1] != "" {
+		t.Errorf("Unexpected sanitized emails %v", emails)
+	}
+	if sessions := querySQLite(t, target, "SELECT token FROM sessions"); len(sessions) != 0 {
+		t.Errorf("Expected no sessions, got %v", sessions)
+	}
+	if audit := querySQLite(t, target, "SELECT message FROM audit"); len(audit) != 0 {
+		t.Errorf("Expected the trigger not to fire while sanitizing, got %v", audit)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".restored.db.restore-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("Expected no restore files to be left, found %v", leftovers)
+	}
+}
+
+func TestSQLiteDumpSanitizeColumnNames(t *testing.T) {
+	ctx := context.Background()
+	dir := sqliteTargetDir(t)
+	source := filepath.Join(dir, "app.db")
+	createSQLiteFile(t, source,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT)",
+		"INSERT INTO users VALUES (1, 'jane@example.com')",
+	)
+	conn := dbconn.Options{Engine: dbconn.EngineSQLite, Path: source}
+
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{name: "mis-cased column", rules: `{"tables": [{"table": "users", "masks": {"EMAIL": {"type": "null"}}}]}`},
+		{name: "unknown column", rules: `{"tables": [{"table": "users", "masks": {"e_mail": {"type": "null"}}}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseSanitizeRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := &DumpOptions{DatabaseName: "main", IncludeStructure: true, IncludeData: true, Sanitize: rules}
+
+			var dump bytes.Buffer
+			_, err = sqliteEngine{}.Dump(ctx, conn, &dump, options, dir)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "e_mail") || !strings.Contains(err.Error(), "users") {
+					t.Errorf("Expected an error naming the column and table, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if bytes.Contains(dump.Bytes(), []byte("jane@example.com")) {
+				t.Error("Dump contains the masked email")
+			}
+		})
+	}
+}
+
+func TestSQLiteRestoreRejectsInvalidFile(t *testing.T) {
+	ctx := context.Background()
+	target := filepath.Join(sqliteTargetDir(t), "app.db")
+	createSQLiteFile(t, target, "CREATE TABLE kept (id INTEGER)")
+	conn := dbconn.Options{Engine: dbconn.EngineSQLite, Path: target}
+
+	err := sqliteEngine{}.Restore(ctx, conn, "main", bytes.NewReader([]byte("-- MySQL dump\nCREATE TABLE t (id INT);\n")))
+	if err == nil {
+		t.Fatal("Expected an error for a file that is not a database")
+	}
+	if tables := querySQLite(t, target, "SELECT name FROM sqlite_master"); len(tables) != 1 || tables[0] != "kept" {
+		t.Errorf("Expected the database to be unchanged, got %v", tables)
+	}
+}
+
+func TestSQLiteRejectsFilesOutsideTargetDirs(t *testing.T) {
+	ctx := context.Background()
+	sqliteTargetDir(t)
+	outside := filepath.Join(t.TempDir(), "app.db")
+	createSQLiteFile(t, outside, "CREATE TABLE kept (id INTEGER)")
+	conn := dbconn.Options{Engine: dbconn.EngineSQLite, Path: outside}
+
+	var dump bytes.Buffer
+	options := &DumpOptions{DatabaseName: "main", IncludeStructure: true, IncludeData: true}
+	if _, err := (sqliteEngine{}).Dump(ctx, conn, &dump, options, t.TempDir()); err == nil {
+		t.Error("Expected dumping a file outside SQLITE_TARGET_DIRS to fail")
+	}
+	if err := (sqliteEngine{}).Restore(ctx, conn, "main", bytes.NewReader(nil)); err == nil {
+		t.Error("Expected restoring over a file outside SQLITE_TARGET_DIRS to fail")
+	}
+	if tables := querySQLite(t, outside, "SELECT name FROM sqlite_master"); len(tables) != 1 || tables[0] != "kept" {
+		t.Errorf("Expected the file to be unchanged, got %v", tables)
+	}
+}
+
+func TestSQLiteCreateDatabase(t *testing.T) {
+	ctx := context.Background()
+	target := filepath.Join(sqliteTargetDir(t), "new.db")
+	conn := dbconn.Options{Engine: dbconn.EngineSQLite, Path: target}
+
+	if err := (sqliteEngine{}).Restore(ctx, conn, "main", bytes.NewReader(nil)); err == nil {
+		t.Error("Expected restoring to a missing file to fail")
+	}
+	if err := (sqliteEngine{}).CreateDatabase(ctx, conn, "main"); err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	if err := (sqliteEngine{}).Ping(ctx, conn); err != nil {
+		t.Errorf("Expected the new file to open as a database: %v", err)
+	}
+	if err := (sqliteEngine{}).CreateDatabase(ctx, conn, "other"); err == nil {
+		t.Error("Expected an error for a database other than main")
+	}
+}
@@ -0,0 +1,415 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sqlStatement is one complete statement read from a SQL dump.
+type sqlStatement struct {
+	SQL    string
+	Offset int64 // byte offset of the first character of the statement
+	Line   int   // 1-based line of the first character of the statement
+}
+
+// statementScanner splits a SQL dump into statements the way the mysql
+// client does: delimiters inside quoted strings, identifiers and comments are
+// ignored, DELIMITER commands change the delimiter and statements may have
+// any length.
+//
+// In postgres mode it follows the lexical rules of PostgreSQL instead, like
+// psql: there are no DELIMITER commands, backticks and "#" comments, backslash
+// escapes only exist in E'...' strings and bodies may be dollar quoted
+// ($$ ... $$ or $tag$ ... $tag$).
+type statementScanner struct {
+	r         *bufio.Reader
+	delimiter string
+	postgres  bool
+	offset    int64
+	line      int
+}
+
+func newStatementScanner(r io.Reader) *statementScanner {
+	return &statementScanner{
+		r:         bufio.NewReaderSize(r, 64*1024),
+		delimiter: ";",
+		line:      1,
+	}
+}
+
+func newPostgresStatementScanner(r io.Reader) *statementScanner {
+	s := newStatementScanner(r)
+	s.postgres = true
+	return s
+}
+
+// Next returns the next statement without its delimiter, or io.EOF once the
+// input is exhausted. Comments in front of a statement are dropped, comments
+// inside it are kept. Version comments (/*!40101 ... */) are treated as SQL.
+func (s *statementScanner) Next() (*sqlStatement, error) {
+	var (
+		buf   bytes.Buffer
+		stmt  sqlStatement
+		quote byte // ', " or ` while inside a quoted string or identifier
+		// escapes is set while inside a string with backslash escapes
+		escapes bool
+		// versionComment is set while inside /*! ... */, whose content is SQL
+		versionComment bool
+	)
+
+	for {
+		// Statement boundary: skip whitespace and handle client commands
+		if buf.Len() == 0 {
+			if err := s.skipSpace(); err != nil {
+				return nil, err
+			}
+			stmt.Offset, stmt.Line = s.offset, s.line
+
+			isDelimiter, err := s.peekKeyword("DELIMITER")
+			if err != nil {
+				return nil, err
+			}
+			if isDelimiter && !s.postgres {
+				if err := s.readDelimiterCommand(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		c, err := s.readByte()
+		if err == io.EOF {
+			if quote != 0 {
+				return nil, fmt.Errorf("unterminated %c quoted string in statement starting at line %d", quote, stmt.Line)
+			}
+			if versionComment {
+				return nil, fmt.Errorf("unterminated version comment in statement starting at line %d", stmt.Line)
+			}
+			if sql := strings.TrimSpace(buf.String()); sql != "" {
+				stmt.SQL = sql
+				return &stmt, nil
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if quote != 0 {
+			buf.WriteByte(c)
+			switch {
+			case c == '\\' && escapes:
+				// Backslash escapes the next character, including a quote
+				next, err := s.readByte()
+				if err == io.EOF {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				buf.WriteByte(next)
+			case c == quote:
+				// A doubled quote is an escaped quote, not the end of the string
+				if next, err := s.r.Peek(1); err == nil && next[0] == quote {
+					s.readByte()
+					buf.WriteByte(quote)
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"' || (c == '`' && !s.postgres):
+			quote = c
+			escapes = c != '`' && (!s.postgres || c == '\'' && isEscapeStringPrefix(buf.Bytes()))
+			buf.WriteByte(c)
+			continue
+
+		case s.postgres && c == '$' && !isIdentifierByte(lastByte(buf.Bytes())):
+			buf.WriteByte(c)
+			tag, err := s.readDollarTag()
+			if err != nil {
+				return nil, err
+			}
+			if tag == "" {
+				continue
+			}
+			buf.WriteString(tag)
+			body, err := s.readDollarQuoted("$" + tag)
+			if err != nil {
+				return nil, fmt.Errorf("%w in statement starting at line %d", err, stmt.Line)
+			}
+			buf.WriteString(body)
+			continue
+
+		case (c == '#' && !s.postgres) || (c == '-' && s.peekLineComment()):
+			comment, err := s.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if buf.Len() > 0 {
+				buf.WriteByte(c)
+				buf.WriteString(comment)
+			}
+			continue
+
+		case c == '/' && s.peekByte() == '*':
+			s.readByte()
+			if s.peekByte() == '!' && !s.postgres {
+				versionComment = true
+				buf.WriteString("/*")
+				continue
+			}
+			comment, err := s.readBlockComment()
+			if err != nil {
+				return nil, fmt.Errorf("%w in statement starting at line %d", err, stmt.Line)
+			}
+			if buf.Len() > 0 {
+				buf.WriteString("/*")
+				buf.WriteString(comment)
+			}
+			continue
+
+		case c == '*' && versionComment && s.peekByte() == '/':
+			s.readByte()
+			versionComment = false
+			buf.WriteString("*/")
+			continue
+		}
+
+		if !versionComment && c == s.delimiter[0] {
+			matched, err := s.consumeDelimiterRest()
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				sql := strings.TrimSpace(buf.String())
+				if sql == "" {
+					buf.Reset()
+					continue
+				}
+				stmt.SQL = sql
+				return &stmt, nil
+			}
+		}
+
+		buf.WriteByte(c)
+	}
+}
+
+func (s *statementScanner) readByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	s.offset++
+	if c == '\n' {
+		s.line++
+	}
+	return c, nil
+}
+
+// peekByte returns the next byte without consuming it, or 0 at end of input.
+func (s *statementScanner) peekByte() byte {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (s *statementScanner) skipSpace() error {
+	for {
+		b, err := s.r.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !isSpace(b[0]) {
+			return nil
+		}
+		s.readByte()
+	}
+}
+
+// peekLineComment reports whether a "-" just read starts a "-- " comment.
+func (s *statementScanner) peekLineComment() bool {
+	b, err := s.r.Peek(2)
+	if err != nil && len(b) < 1 {
+		return false
+	}
+	if b[0] != '-' {
+		return false
+	}
+	// MySQL requires whitespace (or the end of input) after the second dash
+	return s.postgres || len(b) < 2 || isSpace(b[1]) || b[1] < ' '
+}
+
+// readLine consumes the rest of the current line, including the line break.
+func (s *statementScanner) readLine() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := s.readByte()
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(c)
+		if c == '\n' {
+			return sb.String(), nil
+		}
+	}
+}
+
+// readBlockComment consumes a comment after its opening "/*" and returns the
+// rest of it including the closing "*/". PostgreSQL comments nest.
+func (s *statementScanner) readBlockComment() (string, error) {
+	var sb strings.Builder
+	depth := 1
+	for {
+		c, err := s.readByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("unterminated comment")
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(c)
+		switch {
+		case c == '*' && s.peekByte() == '/':
+			s.readByte()
+			sb.WriteByte('/')
+			if depth--; depth == 0 {
+				return sb.String(), nil
+			}
+		case c == '/' && s.peekByte() == '*' && s.postgres:
+			s.readByte()
+			sb.WriteByte('*')
+			depth++
+		}
+	}
+}
+
+// readDollarTag checks whether a "$" just read opens a dollar quoted string
+// and if so consumes and returns the rest of its tag, e.g. "$" or "body$".
+// Otherwise, as for the parameter $1, it returns "".
+func (s *statementScanner) readDollarTag() (string, error) {
+	b, err := s.r.Peek(64)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	for i, c := range b {
+		switch {
+		case c == '$':
+			for range b[:i+1] {
+				s.readByte()
+			}
+			return string(b[:i+1]), nil
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80:
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return "", nil
+		}
+	}
+	return "", nil
+}
+
+// readDollarQuoted consumes the content of a dollar quoted string up to and
+// including its closing tag and returns it.
+func (s *statementScanner) readDollarQuoted(tag string) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := s.readByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("unterminated dollar quoted string")
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(c)
+		if c == '$' && strings.HasSuffix(sb.String(), tag) {
+			return sb.String(), nil
+		}
+	}
+}
+
+// peekKeyword reports whether the input continues with keyword (case
+// insensitive) followed by whitespace.
+func (s *statementScanner) peekKeyword(keyword string) (bool, error) {
+	b, err := s.r.Peek(len(keyword) + 1)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if len(b) < len(keyword)+1 {
+		return false, nil
+	}
+	return strings.EqualFold(string(b[:len(keyword)]), keyword) && isSpace(b[len(keyword)]), nil
+}
+
+// readDelimiterCommand consumes a "DELIMITER xx" line and switches to xx.
+func (s *statementScanner) readDelimiterCommand() error {
+	lineNumber := s.line
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("DELIMITER command without delimiter at line %d", lineNumber)
+	}
+	s.delimiter = fields[1]
+	return nil
+}
+
+// consumeDelimiterRest checks whether the delimiter's first byte, which was
+// just read, starts the full delimiter and consumes the remaining bytes if so.
+func (s *statementScanner) consumeDelimiterRest() (bool, error) {
+	rest := s.delimiter[1:]
+	if rest == "" {
+		return true, nil
+	}
+	b, err := s.r.Peek(len(rest))
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if string(b) != rest {
+		return false, nil
+	}
+	for range rest {
+		s.readByte()
+	}
+	return true, nil
+}
+
+// isEscapeStringPrefix reports whether a quote following sql opens an
+// E'...' string.
+func isEscapeStringPrefix(sql []byte) bool {
+	n := len(sql)
+	return n > 0 && (sql[n-1] == 'E' || sql[n-1] == 'e') &&
+		(n == 1 || !isIdentifierByte(sql[n-2]))
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' ||
+		c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80
+}
+
+func lastByte(b []byte) byte {
+	if len(b) == 0 {
+		return 0
+	}
+	return b[len(b)-1]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
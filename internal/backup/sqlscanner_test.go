@@ -0,0 +1,278 @@
+package backup
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func scanAll(t *testing.T, input string) []*sqlStatement {
+	t.Helper()
+	return readStatements(t, newStatementScanner(strings.NewReader(input)))
+}
+
+func readStatements(t *testing.T, scanner *statementScanner) []*sqlStatement {
+	t.Helper()
+
+	var statements []*sqlStatement
+	for {
+		stmt, err := scanner.Next()
+		if err == io.EOF {
+			return statements
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		statements = append(statements, stmt)
+	}
+}
+
+func TestStatementScanner(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "simple statements",
+			input:    "SELECT 1;\nSELECT 2;\n",
+			expected: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:     "multi-line statement",
+			input:    "CREATE TABLE `t` (\n  `id` int\n);\n",
+			expected: []string{"CREATE TABLE `t` (\n  `id` int\n)"},
+		},
+		{
+			name:     "semicolon and newline inside string",
+			input:    "INSERT INTO `t` VALUES ('a;\nb');\nSELECT 1;",
+			expected: []string{"INSERT INTO `t` VALUES ('a;\nb')", "SELECT 1"},
+		},
+		{
+			name:     "escaped quotes",
+			input:    `INSERT INTO t VALUES ('it\'s;', 'say ''hi'';', "x\";");`,
+			expected: []string{`INSERT INTO t VALUES ('it\'s;', 'say ''hi'';', "x\";")`},
+		},
+		{
+			name:     "escaped backslash before closing quote",
+			input:    `INSERT INTO t VALUES ('C:\\');SELECT 1;`,
+			expected: []string{`INSERT INTO t VALUES ('C:\\')`, "SELECT 1"},
+		},
+		{
+			name:     "semicolon inside backtick identifier",
+			input:    "SELECT `a;b`, `c``;` FROM t;",
+			expected: []string{"SELECT `a;b`, `c``;` FROM t"},
+		},
+		{
+			name:     "leading comments are dropped",
+			input:    "-- header; comment\n# hash; comment\n/* block;\ncomment */\nSELECT 1;",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name:     "comments inside statement are kept",
+			input:    "SELECT 1 -- one; really\n, 2 /* two; */;",
+			expected: []string{"SELECT 1 -- one; really\n, 2 /* two; */"},
+		},
+		{
+			name:     "double dash without space is an operator",
+			input:    "SELECT 1--1;",
+			expected: []string{"SELECT 1--1"},
+		},
+		{
+			name:     "version comments are statements",
+			input:    "/*!40101 SET NAMES utf8mb4 */;\n/*!40014 SET FOREIGN_KEY_CHECKS=0 */;",
+			expected: []string{"/*!40101 SET NAMES utf8mb4 */", "/*!40014 SET FOREIGN_KEY_CHECKS=0 */"},
+		},
+		{
+			name: "custom delimiter",
+			input: "DELIMITER ;;\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT ';;';\nEND ;;\n" +
+				"DELIMITER ;\n" +
+				"SELECT 2;",
+			expected: []string{
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT ';;';\nEND",
+				"SELECT 2",
+			},
+		},
+		{
+			name:     "lowercase delimiter command",
+			input:    "delimiter $$\nSELECT 1$$\ndelimiter ;\n",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name:     "empty statements are skipped",
+			input:    ";;\nSELECT 1;;",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name:     "final statement without delimiter",
+			input:    "SELECT 1;\nSELECT 2",
+			expected: []string{"SELECT 1", "SELECT 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements := scanAll(t, tt.input)
+			if len(statements) != len(tt.expected) {
+				t.Fatalf("Expected %d statements, got %d: %+v", len(tt.expected), len(statements), statements)
+			}
+			for i, stmt := range statements {
+				if stmt.SQL != tt.expected[i] {
+					t.Errorf("Statement %d mismatch:\nGot:\n%q\nExpected:\n%q", i, stmt.SQL, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPostgresStatementScanner(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "backslash is not an escape",
+			input:    `INSERT INTO t VALUES ('C:\', 'it''s;');SELECT 1;`,
+			expected: []string{`INSERT INTO t VALUES ('C:\', 'it''s;')`, "SELECT 1"},
+		},
+		{
+			name:     "backslash escapes in E strings",
+			input:    `INSERT INTO t VALUES (E'it\'s;', e'\\');SELECT 1;`,
+			expected: []string{`INSERT INTO t VALUES (E'it\'s;', e'\\')`, "SELECT 1"},
+		},
+		{
+			name:     "E at the end of a name is no prefix",
+			input:    `SELECT some'\';SELECT 1;`,
+			expected: []string{`SELECT some'\'`, "SELECT 1"},
+		},
+		{
+			name:     "backticks and hashes are plain characters",
+			input:    "SELECT '`' # 1;\nSELECT 2;",
+			expected: []string{"SELECT '`' # 1", "SELECT 2"},
+		},
+		{
+			name:     "double dash always starts a comment",
+			input:    "SELECT 1--1;\n;SELECT 2;",
+			expected: []string{"SELECT 1--1;", "SELECT 2"},
+		},
+		{
+			name: "dollar quoted function body",
+			input: "CREATE FUNCTION f() RETURNS int LANGUAGE plpgsql AS $function$\nBEGIN\n  RETURN 1;\nEND;\n$function$;\n" +
+				"DO $$ BEGIN PERFORM 1; END $$;",
+			expected: []string{
+				"CREATE FUNCTION f() RETURNS int LANGUAGE plpgsql AS $function$\nBEGIN\n  RETURN 1;\nEND;\n$function$",
+				"DO $$ BEGIN PERFORM 1; END $$",
+			},
+		},
+		{
+			name:     "other tags inside a dollar quote",
+			input:    "SELECT $a$ $b$; $$ $a$;",
+			expected: []string{"SELECT $a$ $b$; $$ $a$"},
+		},
+		{
+			name:     "parameters are not dollar quotes",
+			input:    "PREPARE p AS SELECT $1, a$b FROM t;SELECT 2;",
+			expected: []string{"PREPARE p AS SELECT $1, a$b FROM t", "SELECT 2"},
+		},
+		{
+			name:     "nested comments",
+			input:    "/* outer /* inner; */ still; */ SELECT 1;",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name:     "no delimiter commands",
+			input:    "DELIMITER x;\nSELECT 1;",
+			expected: []string{"DELIMITER x", "SELECT 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements := readStatements(t, newPostgresStatementScanner(strings.NewReader(tt.input)))
+			if len(statements) != len(tt.expected) {
+				t.Fatalf("Expected %d statements, got %d: %+v", len(tt.expected), len(statements), statements)
+			}
+			for i, stmt := range statements {
+				if stmt.SQL != tt.expected[i] {
+					t.Errorf("Statement %d mismatch:\nGot:\n%q\nExpected:\n%q", i, stmt.SQL, tt.expected[i])
+				}
+			}
+		})
+	}
+
+	// An unterminated dollar quote is an error, not one long statement
+	scanner := newPostgresStatementScanner(strings.NewReader("SELECT $$ never closed;"))
+	if _, err := scanner.Next(); err == nil || err == io.EOF {
+		t.Errorf("Expected error for unterminated dollar quote, got %v", err)
+	}
+}
+
+func TestStatementScannerPositions(t *testing.T) {
+	input := "-- comment\nSELECT 1;\n\n  INSERT INTO t\nVALUES ('a\nb');\nSELECT 3;"
+	statements := scanAll(t, input)
+
+	expected := []struct {
+		offset int64
+		line   int
+	}{
+		{offset: 11, line: 2},
+		{offset: 24, line: 4},
+		{offset: 54, line: 7},
+	}
+
+	if len(statements) != len(expected) {
+		t.Fatalf("Expected %d statements, got %d", len(expected), len(statements))
+	}
+
+	for i, stmt := range statements {
+		if stmt.Offset != expected[i].offset || stmt.Line != expected[i].line {
+			t.Errorf("Statement %d at offset %d line %d, expected offset %d line %d",
+				i, stmt.Offset, stmt.Line, expected[i].offset, expected[i].line)
+		}
+		if !strings.HasPrefix(input[stmt.Offset:], stmt.SQL) {
+			t.Errorf("Statement %d does not start at its offset: %q", i, stmt.SQL)
+		}
+	}
+}
+
+func TestStatementScannerLargeStatement(t *testing.T) {
+	// Larger than the 1 MiB limit of the old line scanner
+	value := strings.Repeat("x", 3*1024*1024)
+	input := "INSERT INTO t VALUES ('" + value + "');\nSELECT 1;"
+
+	statements := scanAll(t, input)
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(statements))
+	}
+	if len(statements[0].SQL) != len(value)+len("INSERT INTO t VALUES ('')") {
+		t.Errorf("Large statement truncated to %d bytes", len(statements[0].SQL))
+	}
+}
+
+func TestStatementScannerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "unterminated string", input: "SELECT 1;\nINSERT INTO t VALUES ('abc);"},
+		{name: "unterminated comment", input: "SELECT 1 /* never closed"},
+		{name: "delimiter without value", input: "DELIMITER \nSELECT 1;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newStatementScanner(strings.NewReader(tt.input))
+			for {
+				_, err := scanner.Next()
+				if err == io.EOF {
+					t.Fatal("Expected error, got EOF")
+				}
+				if err != nil {
+					return
+				}
+			}
+		})
+	}
+}
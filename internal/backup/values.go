@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// columnKind decides how the values of a result column are written to the
+// dump. It is derived from the column type the server reports, so values are
+// not guessed from their Go type.
+type columnKind int
+
+const (
+	kindString   columnKind = iota // quoted and escaped text, including JSON
+	kindNumber                     // integers and DECIMAL, written as returned
+	kindFloat                      // FLOAT and DOUBLE
+	kindBinary                     // BINARY, VARBINARY, BLOB and GEOMETRY as hex literals
+	kindBit                        // BIT as a b'...' literal
+	kindTemporal                   // DATE, TIME, DATETIME, TIMESTAMP as returned, quoted
+)
+
+// columnKindOf maps a driver type name (sql.ColumnType.DatabaseTypeName) to
+// its columnKind. The driver reports TEXT and CHAR columns with a binary
+// collation as BLOB and BINARY, which is what they are.
+func columnKindOf(typeName string) columnKind {
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR", "DECIMAL":
+		return kindNumber
+	case "FLOAT", "DOUBLE":
+		return kindFloat
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return kindBinary
+	case "BIT":
+		return kindBit
+	case "DATE", "TIME", "DATETIME", "TIMESTAMP":
+		return kindTemporal
+	default:
+		return kindString
+	}
+}
+
+// columnKinds returns the columnKind of every column of rows.
+func columnKinds(rows *sql.Rows) ([]columnKind, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	kinds := make([]columnKind, len(types))
+	for i, typ := range types {
+		kinds[i] = columnKindOf(typ.DatabaseTypeName())
+	}
+	return kinds, nil
+}
+
+// formatColumnValue renders val as a SQL literal for a column of kind. The
+// dump connection does not parse times, so temporal values arrive as the
+// server formatted them, with all fractional digits of the column.
+func (d *Dumper) formatColumnValue(kind columnKind, val interface{}) string {
+	if val == nil {
+		return "NULL"
+	}
+
+	switch kind {
+	case kindNumber:
+		if b, ok := val.([]byte); ok {
+			return string(b)
+		}
+	case kindFloat:
+		switch v := val.(type) {
+		case []byte:
+			return string(v)
+		case float32:
+			return strconv.FormatFloat(float64(v), 'g', -1, 32)
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	case kindBinary:
+		if b, ok := val.([]byte); ok {
+			if len(b) == 0 {
+				return "''"
+			}
+			return "0x" + strings.ToUpper(hex.EncodeToString(b))
+		}
+	case kindBit:
+		if b, ok := val.([]byte); ok {
+			return formatBit(b)
+		}
+	case kindTemporal:
+		if b, ok := val.([]byte); ok {
+			return "'" + string(b) + "'"
+		}
+	}
+
+	return d.formatValue(val)
+}
+
+// formatBit renders the big-endian bytes of a BIT value as b'...'.
+func formatBit(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		sb.WriteString(fmt.Sprintf("%08b", c))
+	}
+	bits := strings.TrimLeft(sb.String(), "0")
+	if bits == "" {
+		bits = "0"
+	}
+	return "b'" + bits + "'"
+}
+
+// keyValue converts a primary key value read from the text protocol into an
+// argument that compares like the column: integers as numbers, so keys above
+// 2^53 are not compared as doubles, binary strings as bytes and everything
+// else as text, which the server compares by the collation of the column.
+// Bytes would be sent as _binary literals and compared byte by byte, which
+// skips or repeats rows of case- or accent-insensitive keys between chunks.
+func keyValue(kind columnKind, val interface{}) interface{} {
+	b, ok := val.([]byte)
+	if !ok {
+		return val
+	}
+	switch kind {
+	case kindNumber:
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+			return n
+		}
+	case kindBinary, kindBit:
+		// Scan reuses byte slices between rows, so keep a copy
+		return append([]byte(nil), b...)
+	}
+	return string(b)
+}
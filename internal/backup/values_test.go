@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"testing"
+)
+
+func TestColumnKindOf(t *testing.T) {
+	tests := []struct {
+		typeName string
+		expected columnKind
+	}{
+		{"INT", kindNumber},
+		{"UNSIGNED BIGINT", kindNumber},
+		{"DECIMAL", kindNumber},
+		{"YEAR", kindNumber},
+		{"DOUBLE", kindFloat},
+		{"VARBINARY", kindBinary},
+		{"LONGBLOB", kindBinary},
+		{"GEOMETRY", kindBinary},
+		{"BIT", kindBit},
+		{"DATETIME", kindTemporal},
+		{"TIMESTAMP", kindTemporal},
+		{"VARCHAR", kindString},
+		{"TEXT", kindString},
+		{"JSON", kindString},
+		{"ENUM", kindString},
+	}
+
+	for _, tt := range tests {
+		if got := columnKindOf(tt.typeName); got != tt.expected {
+			t.Errorf("columnKindOf(%q) = %d, expected %d", tt.typeName, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatColumnValue(t *testing.T) {
+	d := &Dumper{}
+
+	tests := []struct {
+		name     string
+		kind     columnKind
+		input    interface{}
+		expected string
+	}{
+		{"null", kindBinary, nil, "NULL"},
+		{"integer text", kindNumber, []byte("18446744073709551615"), "18446744073709551615"},
+		{"integer binary protocol", kindNumber, int64(-42), "-42"},
+		{"exact decimal", kindNumber, []byte("12345678901234567890.123456789"), "12345678901234567890.123456789"},
+		{"float text", kindFloat, []byte("0.1"), "0.1"},
+		{"float32", kindFloat, float32(0.1), "0.1"},
+		{"float64 full precision", kindFloat, 1.0 / 3.0, "0.3333333333333333"},
+		{"binary as hex", kindBinary, []byte{0x00, 0x27, 0x5c, 0xff}, "0x00275CFF"},
+		{"empty binary", kindBinary, []byte{}, "''"},
+		{"bit", kindBit, []byte{0x00, 0x05}, "b'101'"},
+		{"bit zero", kindBit, []byte{0x00}, "b'0'"},
+		{"datetime with microseconds", kindTemporal, []byte("2024-02-29 23:59:59.123456"), "'2024-02-29 23:59:59.123456'"},
+		{"zero date", kindTemporal, []byte("0000-00-00 00:00:00"), "'0000-00-00 00:00:00'"},
+		{"json", kindString, []byte(`{"a": "it's"}`), `'{\"a\": \"it\'s\"}'`},
+		{"string with nul byte", kindString, []byte("a\x00b"), `'a\0b'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := d.formatColumnValue(tt.kind, tt.input)
+			if result != tt.expected {
+				t.Errorf("formatColumnValue(%v) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	if v := keyValue(kindNumber, []byte("9007199254740993")); v != int64(9007199254740993) {
+		t.Errorf("Expected int64 key, got %#v", v)
+	}
+	if v := keyValue(kindNumber, []byte("18446744073709551615")); v != uint64(18446744073709551615) {
+		t.Errorf("Expected uint64 key, got %#v", v)
+	}
+
+	if v := keyValue(kindString, []byte("Straße")); v != "Straße" {
+		t.Errorf("Expected string key for text columns, got %#v", v)
+	}
+	if v := keyValue(kindTemporal, []byte("2024-02-29 23:59:59")); v != "2024-02-29 23:59:59" {
+		t.Errorf("Expected string key for temporal columns, got %#v", v)
+	}
+
+	raw := []byte("abc")
+	v, ok := keyValue(kindBinary, raw).([]byte)
+	if !ok || string(v) != "abc" {
+		t.Fatalf("Expected byte key, got %#v", v)
+	}
+	raw[0] = 'x'
+	if string(v) != "abc" {
+		t.Error("Key value shares memory with the scanned row")
+	}
+}
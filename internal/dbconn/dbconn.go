@@ -0,0 +1,208 @@
+// Package dbconn opens connections to the MySQL and PostgreSQL servers and
+// the SQLite files of targets. Every connection goes through Open, which
+// applies the target's TLS settings and tunnels through an SSH bastion host
+// if one is configured.
+package dbconn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Engines, the kinds of databases Open connects to
+const (
+	EngineMySQL    = "mysql" // MySQL and MariaDB, the default
+	EnginePostgres = "postgres"
+	EngineSQLite   = "sqlite" // a database file, see Options.Path
+)
+
+// Network types
+const (
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+)
+
+// Ports used for TCP connections without a port
+const (
+	DefaultPort         = 3306
+	DefaultPostgresPort = 5432
+)
+
+// Options describe a connection to a database server.
+type Options struct {
+	Engine string
+
+	// Network is NetworkTCP, the default, to connect to Host and Port or
+	// NetworkUnix to connect to the socket at Socket. Port 0 is the default
+	// port of the engine.
+	Network string
+	Host    string
+	Port    int
+	Socket  string
+
+	// Path is the database file of EngineSQLite, which has neither a
+	// server nor a login
+	Path string
+
+	User     string
+	Password string
+
+	// Database is selected after connecting; empty for none
+	Database string
+
+	// Params are session variables and driver parameters, e.g. charset. For
+	// PostgreSQL they are run-time parameters sent when connecting, for
+	// SQLite URI parameters such as mode.
+	Params    map[string]string
+	ParseTime bool
+
+	// ExtraParams are the DSN parameters of the target, see ValidateParams
+	// and ValidatePostgresParams. Params take precedence.
+	ExtraParams map[string]string
+
+	TLS TLS
+	SSH SSH
+}
+
+// Validate checks the settings of o without connecting.
+func (o Options) Validate() error {
+	switch o.Engine {
+	case "", EngineMySQL:
+		if err := ValidateParams(o.ExtraParams); err != nil {
+			return err
+		}
+	case EnginePostgres:
+		if err := ValidatePostgresParams(o.ExtraParams); err != nil {
+			return err
+		}
+		if o.Network == NetworkUnix && o.TLS.Mode != "" && o.TLS.Mode != TLSDisabled {
+			return fmt.Errorf("postgresql connections over unix sockets don't use tls")
+		}
+	case EngineSQLite:
+		return o.validateSQLite()
+	default:
+		return fmt.Errorf("unknown engine %q", o.Engine)
+	}
+
+	switch o.Network {
+	case "", NetworkTCP:
+		if o.Host == "" {
+			return fmt.Errorf("host is required")
+		}
+		if o.Port < 0 || o.Port > 65535 {
+			return fmt.Errorf("invalid port %d", o.Port)
+		}
+	case NetworkUnix:
+		if !filepath.IsAbs(o.Socket) {
+			return fmt.Errorf("socket must be an absolute path")
+		}
+		if o.SSH.Enabled() {
+			return fmt.Errorf("unix sockets can't be reached through an ssh tunnel")
+		}
+	default:
+		return fmt.Errorf("unknown connection type %q", o.Network)
+	}
+	if _, err := o.TLS.config(o.Host); err != nil {
+		return err
+	}
+	if o.SSH.Enabled() {
+		if _, err := o.SSH.clientConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DB is a connection pool opened by Open. Close also closes its SSH tunnel.
+type DB struct {
+	*sql.DB
+	tunnel *tunnel
+}
+
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	if db.tunnel != nil {
+		db.tunnel.close()
+	}
+	return err
+}
+
+// addr returns the host and port of a TCP connection.
+func (o Options) addr() string {
+	port := o.Port
+	if port == 0 {
+		port = DefaultPort
+		if o.Engine == EnginePostgres {
+			port = DefaultPostgresPort
+		}
+	}
+	return net.JoinHostPort(o.Host, strconv.Itoa(port))
+}
+
+// Open returns a connection pool for o. Like sql.Open it doesn't connect;
+// the first query or Ping does.
+func Open(ctx context.Context, o Options) (*DB, error) {
+	switch o.Engine {
+	case EnginePostgres:
+		return openPostgres(o)
+	case EngineSQLite:
+		return openSQLite(o)
+	}
+
+	cfg, err := parseParams(o.ExtraParams)
+	if err != nil {
+		return nil, err
+	}
+	cfg.User = o.User
+	cfg.Passwd = o.Password
+	cfg.Net = NetworkTCP
+	cfg.Addr = o.addr()
+	if o.Network == NetworkUnix {
+		cfg.Net, cfg.Addr = NetworkUnix, o.Socket
+	}
+	cfg.DBName = o.Database
+	for key, value := range o.Params {
+		if cfg.Params == nil {
+			cfg.Params = make(map[string]string)
+		}
+		cfg.Params[key] = value
+	}
+	cfg.ParseTime = o.ParseTime
+
+	tlsConfig, err := o.TLS.config(o.Host)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		// Parameters saved before allowFallbackToPlaintext was reserved
+		// must not let the driver drop required TLS
+		cfg.TLS, cfg.AllowFallbackToPlaintext = tlsConfig, false
+	} else if o.TLS.Mode == TLSPreferred {
+		cfg.TLSConfig = "preferred"
+	}
+
+	db := &DB{}
+	if o.SSH.Enabled() {
+		db.tunnel, err = openTunnel(o.SSH, cfg.Addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net, cfg.Addr = tunnelNetwork, db.tunnel.id
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		if db.tunnel != nil {
+			db.tunnel.close()
+		}
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	db.DB = sql.OpenDB(connector)
+	return db, nil
+}
@@ -0,0 +1,374 @@
+package dbconn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testCert is a certificate with its key, both PEM encoded.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	PEM  string
+	Key  string
+}
+
+// newTestCert issues a certificate for dnsName, signed by parent or self
+// signed as a CA if parent is nil.
+func newTestCert(t *testing.T, dnsName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.DNSNames = []string{dnsName}
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert: cert,
+		key:  key,
+		PEM:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+// handshake connects to a TLS server presenting server with the client
+// config of t for host.
+func handshake(t *testing.T, server *testCert, settings TLS, host string) error {
+	serverCert, err := tls.X509KeyPair([]byte(server.PEM), []byte(server.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A listener rather than net.Pipe: a failing side writes its alert while
+	// the other one may still be writing, which blocks on an unbuffered pipe
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{serverCert}}).Handshake()
+	}()
+
+	cfg, err := settings.config(host)
+	if err != nil {
+		return err
+	}
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	return tls.Client(clientConn, cfg).Handshake()
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	otherCA := newTestCert(t, "Other CA", nil)
+	server := newTestCert(t, "db.internal", ca)
+	client := newTestCert(t, "dumper", ca)
+
+	tests := []struct {
+		name     string
+		settings TLS
+		host     string
+		wantErr  bool
+	}{
+		{name: "required skips verification", settings: TLS{Mode: TLSRequired}, host: "db.internal"},
+		{name: "verify-ca", settings: TLS{Mode: TLSVerifyCA, CA: ca.PEM}, host: "db.internal"},
+		{name: "verify-ca ignores host name", settings: TLS{Mode: TLSVerifyCA, CA: ca.PEM}, host: "10.0.0.5"},
+		{name: "verify-ca with other CA", settings: TLS{Mode: TLSVerifyCA, CA: otherCA.PEM}, host: "db.internal", wantErr: true},
+		{name: "verify-full", settings: TLS{Mode: TLSVerifyFull, CA: ca.PEM}, host: "db.internal"},
+		{name: "verify-full with wrong host name", settings: TLS{Mode: TLSVerifyFull, CA: ca.PEM}, host: "10.0.0.5", wantErr: true},
+		{name: "client certificate", settings: TLS{Mode: TLSVerifyFull, CA: ca.PEM, Cert: client.PEM, Key: client.Key}, host: "db.internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handshake(t, server, tt.settings, tt.host)
+			if tt.wantErr && err == nil {
+				t.Error("Expected handshake to fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Handshake failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	client := newTestCert(t, "dumper", ca)
+	_, hostKey := startSSHServer(t, "127.0.0.1:1")
+
+	tests := []struct {
+		name    string
+		options Options
+		wantErr bool
+	}{
+		{name: "plain", options: Options{Host: "db"}},
+		{name: "preferred", options: Options{Host: "db", TLS: TLS{Mode: TLSPreferred}}},
+		{name: "unknown tls mode", options: Options{Host: "db", TLS: TLS{Mode: "strict"}}, wantErr: true},
+		{name: "ca without tls", options: Options{Host: "db", TLS: TLS{CA: ca.PEM}}, wantErr: true},
+		{name: "invalid ca", options: Options{Host: "db", TLS: TLS{Mode: TLSVerifyCA, CA: "not a certificate"}}, wantErr: true},
+		{name: "cert without key", options: Options{Host: "db", TLS: TLS{Mode: TLSRequired, Cert: client.PEM}}, wantErr: true},
+		{name: "mismatched key", options: Options{Host: "db", TLS: TLS{Mode: TLSRequired, Cert: client.PEM, Key: ca.Key}}, wantErr: true},
+		{name: "ssh", options: Options{Host: "db", SSH: SSH{Host: "bastion", User: "dumper", Password: "secret", HostKey: hostKey}}},
+		{name: "ssh without host key", options: Options{Host: "db", SSH: SSH{Host: "bastion", User: "dumper", Password: "secret"}}, wantErr: true},
+		{name: "ssh without credentials", options: Options{Host: "db", SSH: SSH{Host: "bastion", User: "dumper", HostKey: hostKey}}, wantErr: true},
+		{name: "ssh without user", options: Options{Host: "db", SSH: SSH{Host: "bastion", Password: "secret", HostKey: hostKey}}, wantErr: true},
+		{name: "without host", options: Options{Port: 3306}, wantErr: true},
+		{name: "invalid port", options: Options{Host: "db", Port: 70000}, wantErr: true},
+		{name: "unix", options: Options{Network: NetworkUnix, Socket: "/run/mysqld/mysqld.sock"}},
+		{name: "unix relative socket", options: Options{Network: NetworkUnix, Socket: "mysqld.sock"}, wantErr: true},
+		{name: "unix with ssh", options: Options{Network: NetworkUnix, Socket: "/run/mysqld/mysqld.sock", SSH: SSH{Host: "bastion", User: "dumper", Password: "secret", HostKey: hostKey}}, wantErr: true},
+		{name: "unknown network", options: Options{Network: "udp", Host: "db"}, wantErr: true},
+		{name: "invalid dsn params", options: Options{Host: "db", ExtraParams: map[string]string{"tls": "skip-verify"}}, wantErr: true},
+		{name: "plaintext fallback with verify-full", options: Options{Host: "db", TLS: TLS{Mode: TLSVerifyFull, CA: ca.PEM}, ExtraParams: map[string]string{"allowFallbackToPlaintext": "true"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "driver parameters", params: map[string]string{"timeout": "5s", "readTimeout": "1m", "allowCleartextPasswords": "true"}},
+		{name: "session variables", params: map[string]string{"sql_mode": "'ANSI_QUOTES'", "wait_timeout": "600", "autocommit": "ON"}},
+		{name: "reserved", params: map[string]string{"multiStatements": "false"}, wantErr: true},
+		{name: "tls", params: map[string]string{"tls": "false"}, wantErr: true},
+		{name: "plaintext fallback", params: map[string]string{"allowFallbackToPlaintext": "true"}, wantErr: true},
+		{name: "invalid driver value", params: map[string]string{"timeout": "soon"}, wantErr: true},
+		{name: "invalid name", params: map[string]string{"sql mode": "1"}, wantErr: true},
+		{name: "statement in value", params: map[string]string{"wait_timeout": "1; DROP DATABASE x"}, wantErr: true},
+		{name: "quote in value", params: map[string]string{"sql_mode": "'a''b'"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateParams(tt.params)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	cfg, err := parseParams(map[string]string{"timeout": "5s", "wait_timeout": "600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("Expected timeout 5s, got %v", cfg.Timeout)
+	}
+	if cfg.Params["wait_timeout"] != "600" {
+		t.Errorf("Expected session variable wait_timeout, got %v", cfg.Params)
+	}
+}
+
+// startSSHServer serves SSH for user "dumper" with password "secret" on a
+// local port and forwards every direct-tcpip channel to forwardTo. It
+// returns the address and the host key in authorized_keys format.
+func startSSHServer(t *testing.T, forwardTo string) (string, string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "dumper" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config, forwardTo)
+		}
+	}()
+
+	hostKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	return listener.Addr().String(), hostKey
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig, forwardTo string) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		// The requested host is ignored
+		target, err := net.Dial("tcp", forwardTo)
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer target.Close()
+			go io.Copy(target, channel)
+			io.Copy(channel, target)
+		}()
+	}
+}
+
+func TestSSHTunnel(t *testing.T) {
+	// An echo server stands in for MySQL
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	addr, hostKey := startSSHServer(t, echo.Addr().String())
+	host, port, _ := net.SplitHostPort(addr)
+	portNumber, _ := net.LookupPort("tcp", port)
+	settings := SSH{Host: host, Port: portNumber, User: "dumper", Password: "secret", HostKey: hostKey}
+
+	tun, err := openTunnel(settings, "db.internal:3306")
+	if err != nil {
+		t.Fatalf("openTunnel failed: %v", err)
+	}
+
+	// Every dial is a new channel on the same SSH connection
+	for i := 0; i < 2; i++ {
+		conn, err := dialTunnel(context.Background(), tun.id)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, 4)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatal(err)
+		}
+		if string(reply) != "ping" {
+			t.Errorf("Expected echo, got %q", reply)
+		}
+		conn.Close()
+	}
+
+	tun.close()
+	if _, err := dialTunnel(context.Background(), tun.id); err == nil {
+		t.Error("Expected dial through a closed tunnel to fail")
+	}
+
+	// A wrong host key is rejected
+	_, otherKey := startSSHServer(t, echo.Addr().String())
+	settings.HostKey = otherKey
+	tun, err = openTunnel(settings, "db.internal:3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.close()
+	if _, err := dialTunnel(context.Background(), tun.id); err == nil {
+		t.Error("Expected handshake with an unknown host key to fail")
+	}
+}
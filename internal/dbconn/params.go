@@ -0,0 +1,91 @@
+package dbconn
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// driverParams are the DSN parameters of the driver targets may set. Other
+// parameters are session variables, which the driver sets with SET.
+var driverParams = map[string]bool{
+	"allowCleartextPasswords": true,
+	"allowNativePasswords":    true,
+	"allowOldPasswords":       true,
+	"checkConnLiveness":       true,
+	"clientFoundRows":         true,
+	"collation":               true,
+	"columnsWithAlias":        true,
+	"connectionAttributes":    true,
+	"interpolateParams":       true,
+	"loc":                     true,
+	"maxAllowedPacket":        true,
+	"readTimeout":             true,
+	"rejectReadOnly":          true,
+	"serverPubKey":            true,
+	"timeout":                 true,
+	"writeTimeout":            true,
+}
+
+// reservedParams are set by the connection paths themselves; a target
+// setting them would break dumps or restores, or bypass its TLS settings.
+var reservedParams = map[string]bool{
+	"allowFallbackToPlaintext": true,
+	"charset":                  true,
+	"multiStatements":          true,
+	"parseTime":                true,
+	"time_zone":                true,
+	"tls":                      true,
+}
+
+var (
+	sessionVariable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// Values of session variables end up in SET statements unquoted, so
+	// they are restricted to quoted strings, numbers and identifiers
+	sessionValue = regexp.MustCompile(`^('[^'\\]*'|[A-Za-z0-9_.+-]+)$`)
+)
+
+// ValidateParams checks the extra DSN parameters of a target.
+func ValidateParams(params map[string]string) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := params[key]
+		switch {
+		case reservedParams[key]:
+			return fmt.Errorf("dsn parameter %s can't be set", key)
+		case driverParams[key]:
+		case !sessionVariable.MatchString(key):
+			return fmt.Errorf("invalid dsn parameter %q", key)
+		case !sessionValue.MatchString(value):
+			return fmt.Errorf("invalid value for session variable %s: use a number, a name or a quoted string", key)
+		}
+	}
+
+	// The driver checks the values of its own parameters
+	if _, err := parseParams(params); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseParams returns a driver config with params applied.
+func parseParams(params map[string]string) (*mysql.Config, error) {
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	cfg, err := mysql.ParseDSN("/?" + values.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsn parameters: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,119 @@
+package dbconn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresReservedParams are set by the dump and restore connections, which
+// rely on how they make the server format values and names.
+var postgresReservedParams = map[string]bool{
+	"client_encoding":             true,
+	"datestyle":                   true,
+	"extra_float_digits":          true,
+	"intervalstyle":               true,
+	"search_path":                 true,
+	"standard_conforming_strings": true,
+	"timezone":                    true,
+}
+
+// Custom options of extensions have a prefix, e.g. "pg_trgm.similarity_threshold"
+var postgresParam = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ValidatePostgresParams checks the extra parameters of a PostgreSQL target.
+// They are run-time parameters, sent to the server when connecting.
+func ValidatePostgresParams(params map[string]string) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch {
+		case postgresReservedParams[strings.ToLower(key)]:
+			return fmt.Errorf("dsn parameter %s can't be set", key)
+		case !postgresParam.MatchString(key):
+			return fmt.Errorf("invalid dsn parameter %q", key)
+		case strings.ContainsRune(params[key], 0):
+			return fmt.Errorf("invalid value for dsn parameter %s", key)
+		}
+	}
+	return nil
+}
+
+// openPostgres is Open for EnginePostgres.
+func openPostgres(o Options) (*DB, error) {
+	// Only o configures the connection: everything ParseConfig takes from
+	// PG* environment variables is replaced below
+	cfg, err := pgx.ParseConfig("")
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	cfg.User = o.User
+	cfg.Password = o.Password
+	cfg.Database = o.Database
+	cfg.Fallbacks = nil
+	cfg.ValidateConnect = nil
+
+	cfg.RuntimeParams = make(map[string]string, len(o.ExtraParams)+len(o.Params))
+	for key, value := range o.ExtraParams {
+		cfg.RuntimeParams[key] = value
+	}
+	for key, value := range o.Params {
+		cfg.RuntimeParams[key] = value
+	}
+
+	if o.Network == NetworkUnix {
+		// pgconn expects the socket's directory; dial the socket itself
+		cfg.Host, cfg.Port = o.Socket, DefaultPostgresPort
+		cfg.TLSConfig = nil
+		cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, NetworkUnix, o.Socket)
+		}
+		return &DB{DB: stdlib.OpenDB(*cfg)}, nil
+	}
+
+	host, portString, _ := net.SplitHostPort(o.addr())
+	port, _ := strconv.ParseUint(portString, 10, 16)
+	cfg.Host, cfg.Port = host, uint16(port)
+
+	cfg.TLSConfig, err = o.TLS.config(o.Host)
+	if err != nil {
+		return nil, err
+	}
+	if o.TLS.Mode == TLSPreferred {
+		// Like sslmode=prefer: unverified TLS, plain if the server has none
+		cfg.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		cfg.Fallbacks = []*pgconn.FallbackConfig{{Host: cfg.Host, Port: cfg.Port}}
+	}
+
+	db := &DB{}
+	if o.SSH.Enabled() {
+		db.tunnel, err = openTunnel(o.SSH, o.addr())
+		if err != nil {
+			return nil, err
+		}
+		// The host may only resolve on the bastion, which the tunnel dials
+		cfg.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+			return []string{host}, nil
+		}
+		cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return db.tunnel.dial(ctx)
+		}
+	}
+
+	db.DB = stdlib.OpenDB(*cfg)
+	return db, nil
+}
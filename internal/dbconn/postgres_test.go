@@ -0,0 +1,204 @@
+package dbconn
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+func TestValidatePostgresParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "run-time parameters", params: map[string]string{"statement_timeout": "5min", "application_name": "dumper"}},
+		{name: "extension parameter", params: map[string]string{"pg_trgm.similarity_threshold": "0.5"}},
+		{name: "reserved", params: map[string]string{"search_path": "app"}, wantErr: true},
+		{name: "reserved in other case", params: map[string]string{"TimeZone": "Europe/Berlin"}, wantErr: true},
+		{name: "invalid name", params: map[string]string{"statement timeout": "1"}, wantErr: true},
+		{name: "nul in value", params: map[string]string{"application_name": "a\x00b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePostgresParams(tt.params)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePostgres(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		wantErr bool
+	}{
+		{name: "tcp", options: Options{Engine: EnginePostgres, Host: "db"}},
+		{name: "unix", options: Options{Engine: EnginePostgres, Network: NetworkUnix, Socket: "/run/postgresql/.s.PGSQL.5432"}},
+		{name: "unix with tls", options: Options{Engine: EnginePostgres, Network: NetworkUnix, Socket: "/run/postgresql/.s.PGSQL.5432", TLS: TLS{Mode: TLSRequired}}, wantErr: true},
+		{name: "reserved dsn params", options: Options{Engine: EnginePostgres, Host: "db", ExtraParams: map[string]string{"client_encoding": "LATIN1"}}, wantErr: true},
+		{name: "unknown engine", options: Options{Engine: "oracle", Host: "db"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// servePostgres accepts connections on listener like a PostgreSQL server
+// that trusts everyone and answers every query with nothing. The startup
+// parameters of each connection are sent to the returned channel.
+func servePostgres(t *testing.T, listener net.Listener) <-chan map[string]string {
+	t.Cleanup(func() { listener.Close() })
+
+	startups := make(chan map[string]string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				backend := pgproto3.NewBackend(conn, conn)
+				msg, err := backend.ReceiveStartupMessage()
+				if err != nil {
+					return
+				}
+				startup, ok := msg.(*pgproto3.StartupMessage)
+				if !ok {
+					return
+				}
+				startups <- startup.Parameters
+
+				backend.Send(&pgproto3.AuthenticationOk{})
+				backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+				backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+				for {
+					if err := backend.Flush(); err != nil {
+						return
+					}
+					msg, err := backend.Receive()
+					if err != nil {
+						return
+					}
+					switch msg.(type) {
+					case *pgproto3.Query:
+						backend.Send(&pgproto3.EmptyQueryResponse{})
+						backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+					case *pgproto3.Terminate:
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return startups
+}
+
+func TestOpenPostgres(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpStartups := servePostgres(t, tcp)
+	tcpHost, tcpPort, _ := net.SplitHostPort(tcp.Addr().String())
+	tcpPortNumber, _ := net.LookupPort("tcp", tcpPort)
+
+	socket := filepath.Join(t.TempDir(), ".s.PGSQL.5432")
+	unix, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unixStartups := servePostgres(t, unix)
+
+	sshAddr, hostKey := startSSHServer(t, tcp.Addr().String())
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+	sshPortNumber, _ := net.LookupPort("tcp", sshPort)
+
+	tests := []struct {
+		name     string
+		options  Options
+		startups <-chan map[string]string
+	}{
+		{
+			name:     "tcp",
+			options:  Options{Host: tcpHost, Port: tcpPortNumber},
+			startups: tcpStartups,
+		},
+		{
+			name:     "unix",
+			options:  Options{Network: NetworkUnix, Socket: socket},
+			startups: unixStartups,
+		},
+		{
+			// The host only resolves on the bastion
+			name: "ssh",
+			options: Options{
+				Host: "db.internal",
+				SSH:  SSH{Host: sshHost, Port: sshPortNumber, User: "dumper", Password: "secret", HostKey: hostKey},
+			},
+			startups: tcpStartups,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			o := tt.options
+			o.Engine = EnginePostgres
+			o.User = "dumper"
+			o.Database = "shop"
+			o.Params = map[string]string{"TimeZone": "UTC"}
+			o.ExtraParams = map[string]string{"statement_timeout": "5min", "TimeZone": "Europe/Berlin"}
+
+			db, err := Open(ctx, o)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer db.Close()
+			if err := db.PingContext(ctx); err != nil {
+				t.Fatalf("Ping failed: %v", err)
+			}
+
+			var params map[string]string
+			select {
+			case params = <-tt.startups:
+			case <-ctx.Done():
+				t.Fatal("Server saw no connection")
+			}
+			expected := map[string]string{
+				"user":              "dumper",
+				"database":          "shop",
+				"statement_timeout": "5min",
+				"TimeZone":          "UTC",
+			}
+			for key, value := range expected {
+				if params[key] != value {
+					t.Errorf("Expected startup parameter %s=%q, got %q", key, value, params[key])
+				}
+			}
+		})
+	}
+}
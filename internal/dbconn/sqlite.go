@@ -0,0 +1,98 @@
+package dbconn
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/config"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteBusyTimeout is how long, in milliseconds, statements wait for the
+// locks of other writers to the file before they fail.
+const sqliteBusyTimeout = 30000
+
+// DefaultSQLiteDirs are the directories the files of SQLite targets may be
+// in unless SQLITE_TARGET_DIRS is set.
+const DefaultSQLiteDirs = "/data/targets"
+
+// validateSQLite is Validate for EngineSQLite. The file is not opened, so
+// targets can be set up before it exists.
+func (o Options) validateSQLite() error {
+	if err := CheckSQLitePath(o.Path); err != nil {
+		return err
+	}
+	if len(o.ExtraParams) > 0 {
+		return fmt.Errorf("sqlite targets don't take dsn parameters")
+	}
+	if o.TLS.Mode != "" && o.TLS.Mode != TLSDisabled {
+		return fmt.Errorf("sqlite targets don't use tls")
+	}
+	if o.SSH.Enabled() {
+		return fmt.Errorf("sqlite files can't be reached through an ssh tunnel")
+	}
+	return nil
+}
+
+// CheckSQLitePath makes sure the file of a SQLite target is below one of the
+// directories in SQLITE_TARGET_DIRS and is not the app's own database, as
+// anyone who can edit targets could otherwise read, and replace by a
+// restore, any file the server can write.
+func CheckSQLitePath(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("path must be an absolute path")
+	}
+	resolved := resolvePath(path)
+	if resolved == resolvePath(config.GetEnv("SQLITE_PATH", "/data/app/app.db")) {
+		return fmt.Errorf("path %s is the database of go-dumper itself", path)
+	}
+	for _, dir := range strings.Split(config.GetEnv("SQLITE_TARGET_DIRS", DefaultSQLiteDirs), ",") {
+		dir = strings.TrimSpace(dir)
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		if rel, err := filepath.Rel(resolvePath(dir), resolved); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return nil
+		}
+	}
+	return fmt.Errorf("path %s is not in SQLITE_TARGET_DIRS", path)
+}
+
+// resolvePath returns the clean path with its symbolic links followed, those
+// of its directory only if the file does not exist yet.
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path))
+	}
+	return path
+}
+
+// openSQLite is Open for EngineSQLite.
+func openSQLite(o Options) (*DB, error) {
+	db, err := sql.Open("sqlite", SQLiteURI(o.Path, o.Params))
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	return &DB{DB: db}, nil
+}
+
+// SQLiteURI returns the URI of the SQLite file at path with the URI
+// parameters params, e.g. mode=ro, and a busy timeout.
+func SQLiteURI(path string, params map[string]string) string {
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	query.Set("_pragma", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout))
+
+	// The path is escaped as SQLite expects it: ? and # would end it
+	u := url.URL{Path: filepath.ToSlash(path)}
+	return "file:" + u.EscapedPath() + "?" + query.Encode()
+}
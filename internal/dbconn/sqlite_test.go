@@ -0,0 +1,132 @@
+package dbconn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateSQLite(t *testing.T) {
+	t.Setenv("SQLITE_TARGET_DIRS", "/var/lib/app, /")
+	t.Setenv("SQLITE_PATH", "/var/lib/app/dumper.db")
+
+	tests := []struct {
+		name    string
+		options Options
+		wantErr bool
+	}{
+		{name: "path", options: Options{Engine: EngineSQLite, Path: "/var/lib/app/app.db"}},
+		{name: "relative path", options: Options{Engine: EngineSQLite, Path: "app.db"}, wantErr: true},
+		{name: "app database", options: Options{Engine: EngineSQLite, Path: "/var/lib/app/../app/dumper.db"}, wantErr: true},
+		{name: "no path", options: Options{Engine: EngineSQLite}, wantErr: true},
+		{name: "dsn params", options: Options{Engine: EngineSQLite, Path: "/app.db", ExtraParams: map[string]string{"mode": "rw"}}, wantErr: true},
+		{name: "tls", options: Options{Engine: EngineSQLite, Path: "/app.db", TLS: TLS{Mode: TLSRequired}}, wantErr: true},
+		{name: "ssh", options: Options{Engine: EngineSQLite, Path: "/app.db", SSH: SSH{Host: "bastion", User: "dumper", Password: "secret"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckSQLitePath(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "targets")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{allowed, other} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(other, filepath.Join(allowed, "link")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SQLITE_TARGET_DIRS", allowed)
+	t.Setenv("SQLITE_PATH", filepath.Join(allowed, "app.db"))
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "in allowed dir", path: filepath.Join(allowed, "shop.db")},
+		{name: "in subdirectory", path: filepath.Join(allowed, "shop", "shop.db")},
+		{name: "outside allowed dirs", path: filepath.Join(other, "shop.db"), wantErr: true},
+		{name: "escaping allowed dir", path: allowed + "/../other/shop.db", wantErr: true},
+		{name: "through a symlink", path: filepath.Join(allowed, "link", "shop.db"), wantErr: true},
+		{name: "allowed dir itself", path: allowed, wantErr: true},
+		{name: "app database", path: filepath.Join(allowed, "app.db"), wantErr: true},
+		{name: "relative", path: "shop.db", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSQLitePath(tt.path)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteURI(t *testing.T) {
+	tests := []struct {
+		path     string
+		params   map[string]string
+		expected string
+	}{
+		{
+			path:     "/var/lib/app/app.db",
+			expected: "file:/var/lib/app/app.db?_pragma=busy_timeout%2830000%29",
+		},
+		{
+			path:     "/data/what?#%.db",
+			params:   map[string]string{"mode": "ro"},
+			expected: "file:/data/what%3F%23%25.db?_pragma=busy_timeout%2830000%29&mode=ro",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := SQLiteURI(tt.path, tt.params); got != tt.expected {
+			t.Errorf("SQLiteURI(%q) = %s, expected %s", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestOpenSQLite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "odd name?.db")
+
+	db, err := Open(ctx, Options{Engine: EngineSQLite, Path: path})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(ctx, Options{Engine: EngineSQLite, Path: path, Params: map[string]string{"mode": "ro"}})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM t").Scan(new(int)); err != nil {
+		t.Errorf("Expected the table in the file at the escaped path: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err == nil {
+		t.Error("Expected a read-only connection")
+	}
+}
@@ -0,0 +1,178 @@
+package dbconn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH configures a tunnel through a bastion host. Host is empty for direct
+// connections.
+type SSH struct {
+	Host string
+	Port int // defaults to 22
+	User string
+
+	// Password and PrivateKey (PEM) authenticate the user; either or both
+	Password   string
+	PrivateKey string
+
+	// HostKey is the bastion's public key in authorized_keys format
+	HostKey string
+}
+
+// Enabled reports whether connections are tunneled.
+func (s SSH) Enabled() bool {
+	return s.Host != ""
+}
+
+func (s SSH) addr() string {
+	port := s.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(port))
+}
+
+func (s SSH) clientConfig() (*ssh.ClientConfig, error) {
+	if s.User == "" {
+		return nil, fmt.Errorf("ssh user is required")
+	}
+
+	var auth []ssh.AuthMethod
+	if s.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(s.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ssh private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.Password != "" {
+		auth = append(auth, ssh.Password(s.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("ssh password or private key is required")
+	}
+
+	if s.HostKey == "" {
+		return nil, fmt.Errorf("ssh host key is required")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh host key: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            auth,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// The driver dials registered networks by name only, so tunnels are found
+// by the ID they put in the address.
+const tunnelNetwork = "dumper-ssh"
+
+var (
+	registerOnce sync.Once
+	tunnels      sync.Map // id -> *tunnel
+	tunnelCount  atomic.Int64
+)
+
+// tunnel forwards the connections of one DB through an SSH connection,
+// which is made on the first dial and again after it breaks.
+type tunnel struct {
+	id     string
+	ssh    SSH
+	config *ssh.ClientConfig
+	remote string // the database server as seen from the bastion
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func openTunnel(s SSH, remote string) (*tunnel, error) {
+	config, err := s.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	registerOnce.Do(func() {
+		mysql.RegisterDialContext(tunnelNetwork, dialTunnel)
+	})
+
+	t := &tunnel{
+		id:     strconv.FormatInt(tunnelCount.Add(1), 10),
+		ssh:    s,
+		config: config,
+		remote: remote,
+	}
+	tunnels.Store(t.id, t)
+	return t, nil
+}
+
+func dialTunnel(ctx context.Context, id string) (net.Conn, error) {
+	t, ok := tunnels.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("ssh tunnel is closed")
+	}
+	return t.(*tunnel).dial(ctx)
+}
+
+func (t *tunnel) dial(ctx context.Context) (net.Conn, error) {
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", t.remote)
+	if err != nil {
+		// The SSH connection may have broken; the next dial makes a new one
+		t.mu.Lock()
+		if t.client == client {
+			t.client = nil
+			client.Close()
+		}
+		t.mu.Unlock()
+		return nil, fmt.Errorf("failed to connect to %s through ssh: %w", t.remote, err)
+	}
+	return conn, nil
+}
+
+func (t *tunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	addr := t.ssh.addr()
+	dialer := net.Dialer{Timeout: t.config.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh host %s: %w", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, t.config)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", addr, err)
+	}
+	t.client = ssh.NewClient(sshConn, chans, reqs)
+	return t.client, nil
+}
+
+func (t *tunnel) close() {
+	tunnels.Delete(t.id)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+}
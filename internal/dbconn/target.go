@@ -0,0 +1,98 @@
+package dbconn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/casparjones/go-dumper/internal/secrets"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// ForTarget returns the options to connect to the server of target, with
+// its password resolved and its TLS and SSH secrets decrypted. SQLite
+// targets have no password.
+func ForTarget(ctx context.Context, target *store.Target) (Options, error) {
+	o, err := TargetOptions(target)
+	if err != nil {
+		return Options{}, err
+	}
+	if o.Engine == EngineSQLite {
+		return o, nil
+	}
+	o.Password, err = TargetPassword(ctx, target)
+	if err != nil {
+		return Options{}, err
+	}
+	return o, nil
+}
+
+// TargetOptions returns the options of target with its TLS and SSH secrets
+// decrypted but without its password, e.g. to validate them.
+func TargetOptions(target *store.Target) (Options, error) {
+	o := Options{
+		Engine:  target.Engine,
+		Network: target.ConnectionType,
+		Host:    target.Host,
+		Port:    target.Port,
+		Socket:  target.Socket,
+		Path:    target.Path,
+		User:    target.User,
+		TLS: TLS{
+			Mode: target.TLSMode,
+			CA:   target.TLSCA,
+			Cert: target.TLSCert,
+		},
+		SSH: SSH{
+			Host:    target.SSHHost,
+			Port:    target.SSHPort,
+			User:    target.SSHUser,
+			HostKey: target.SSHHostKey,
+		},
+	}
+
+	if target.DSNParams != "" {
+		if err := json.Unmarshal([]byte(target.DSNParams), &o.ExtraParams); err != nil {
+			return Options{}, fmt.Errorf("failed to parse dsn params: %w", err)
+		}
+	}
+
+	encrypted := []struct {
+		name      string
+		encrypted string
+		dest      *string
+	}{
+		{"tls key", target.TLSKeyEnc, &o.TLS.Key},
+		{"ssh password", target.SSHPasswordEnc, &o.SSH.Password},
+		{"ssh private key", target.SSHKeyEnc, &o.SSH.PrivateKey},
+	}
+	for _, secret := range encrypted {
+		if secret.encrypted == "" {
+			continue
+		}
+		value, err := store.DecryptPassword(secret.encrypted)
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to decrypt %s: %w", secret.name, err)
+		}
+		*secret.dest = value
+	}
+	return o, nil
+}
+
+// TargetPassword returns the password of target: resolved from its secret
+// reference if it has one, else decrypted from the database.
+func TargetPassword(ctx context.Context, target *store.Target) (string, error) {
+	if target.PasswordRef != "" {
+		password, err := secrets.Resolve(ctx, target.PasswordRef)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve password: %w", err)
+		}
+		return password, nil
+	}
+
+	password, err := store.DecryptPassword(target.PasswordEnc)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	return password, nil
+}
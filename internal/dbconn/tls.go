@@ -0,0 +1,102 @@
+package dbconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// TLS modes, from least to most strict
+const (
+	TLSDisabled   = "disabled"    // plain TCP, the default
+	TLSPreferred  = "preferred"   // TLS if the server supports it, unverified
+	TLSRequired   = "required"    // TLS, the server certificate is not verified
+	TLSVerifyCA   = "verify-ca"   // TLS with a certificate signed by the CA
+	TLSVerifyFull = "verify-full" // verify-ca, and the certificate matches the host
+)
+
+// TLS configures the TLS connection to a server. Certificates and the key
+// are PEM encoded.
+type TLS struct {
+	Mode string
+
+	// CA verifies the server; the system roots are used without it
+	CA string
+
+	// Cert and Key authenticate the client; both or neither
+	Cert string
+	Key  string
+}
+
+// config returns the tls.Config for a connection to host, nil without TLS
+// or with TLSPreferred, which the driver handles itself.
+func (t TLS) config(host string) (*tls.Config, error) {
+	if (t.Cert == "") != (t.Key == "") {
+		return nil, fmt.Errorf("tls client certificate and key must be given together")
+	}
+
+	switch t.Mode {
+	case "", TLSDisabled:
+		if t.CA != "" || t.Cert != "" {
+			return nil, fmt.Errorf("tls certificates require a tls mode")
+		}
+		return nil, nil
+	case TLSPreferred:
+		if t.CA != "" || t.Cert != "" {
+			return nil, fmt.Errorf("tls mode preferred takes no certificates")
+		}
+		return nil, nil
+	case TLSRequired, TLSVerifyCA, TLSVerifyFull:
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q", t.Mode)
+	}
+
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if t.Cert != "" {
+		cert, err := tls.X509KeyPair([]byte(t.Cert), []byte(t.Key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if t.CA != "" {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM([]byte(t.CA)) {
+			return nil, fmt.Errorf("invalid tls ca: no certificates found")
+		}
+	}
+
+	switch t.Mode {
+	case TLSRequired:
+		cfg.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// The chain is verified, the host name is not
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyChain(cfg.RootCAs)
+	}
+	return cfg, nil
+}
+
+// verifyChain verifies the certificates of a server against roots, the
+// system roots if nil, ignoring the host name.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("invalid server certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
@@ -0,0 +1,314 @@
+// Package filecrypt encrypts backup files as a stream of AES-256-GCM chunks
+// under a random data key per file. The data key is wrapped for every party
+// that may read the file, by a master key or for an X25519 recipient, and
+// kept in the header of the file.
+//
+// A file starts with Magic, the length of the header as a big endian uint32
+// and the header as JSON. Chunks of up to ChunkSize bytes follow, each sealed
+// with the nonce prefix from the header, a counter and a flag marking the
+// last chunk, so truncated and reordered files are detected. The header is
+// authenticated as additional data of every chunk.
+package filecrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic starts every encrypted file.
+const Magic = "GDMPENC1"
+
+// Suffix is appended to the names of encrypted files.
+const Suffix = ".enc"
+
+// ChunkSize is the plaintext size of all chunks but the last.
+const ChunkSize = 64 * 1024
+
+const (
+	keySize         = 32
+	noncePrefixSize = 7
+	maxHeaderSize   = 1 << 20
+)
+
+// ErrNoKey is returned when none of the keys given can unwrap the data key.
+var ErrNoKey = errors.New("no key to decrypt the file")
+
+// ErrNotEncrypted is returned by NewReader for input without Magic.
+var ErrNotEncrypted = errors.New("file is not encrypted")
+
+// Stanza is the data key of a file wrapped for one reader.
+type Stanza struct {
+	Type      string `json:"type"`
+	Recipient string `json:"recipient,omitempty"`
+	Ephemeral string `json:"ephemeral,omitempty"`
+	Key       string `json:"key"`
+}
+
+// KeyWrapper wraps data keys for one reader of the files.
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) (Stanza, error)
+}
+
+// KeyUnwrapper recovers data keys. UnwrapKey returns ErrNoKey for stanzas
+// wrapped for someone else.
+type KeyUnwrapper interface {
+	UnwrapKey(s Stanza) ([]byte, error)
+}
+
+type header struct {
+	ChunkSize int      `json:"chunk_size"`
+	Nonce     []byte   `json:"nonce"`
+	Keys      []Stanza `json:"keys"`
+}
+
+// IsEncrypted reports whether r starts with Magic, without consuming it.
+func IsEncrypted(r *bufio.Reader) bool {
+	prefix, _ := r.Peek(len(Magic))
+	return string(prefix) == Magic
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	aad    []byte
+	nonce  []byte
+	buf    []byte
+	count  uint32
+	closed bool
+}
+
+// NewWriter returns a writer that encrypts to w under a new data key wrapped
+// by every one of wrappers. Close writes the last chunk; it does not close w.
+func NewWriter(w io.Writer, wrappers ...KeyWrapper) (io.WriteCloser, error) {
+	if len(wrappers) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	h := header{ChunkSize: ChunkSize, Nonce: make([]byte, noncePrefixSize)}
+	if _, err := rand.Read(h.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	for _, wrapper := range wrappers {
+		stanza, err := wrapper.WrapKey(dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		h.Keys = append(h.Keys, stanza)
+	}
+
+	encoded, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode header: %w", err)
+	}
+	var aad bytes.Buffer
+	aad.WriteString(Magic)
+	binary.Write(&aad, binary.BigEndian, uint32(len(encoded)))
+	aad.Write(encoded)
+	if _, err := w.Write(aad.Bytes()); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{
+		w:     w,
+		aead:  aead,
+		aad:   aad.Bytes(),
+		nonce: h.Nonce,
+		buf:   make([]byte, 0, ChunkSize),
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed filecrypt writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, as the last
+		// chunk is sealed differently
+		if len(w.buf) == ChunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):ChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *writer) flush(last bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.nonce, w.count, last), w.buf, w.aad)
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+	w.count++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type reader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	aad   []byte
+	nonce []byte
+	chunk []byte
+	plain []byte
+	count uint32
+	done  bool
+}
+
+// NewReader returns a reader of the plaintext of the encrypted stream r. The
+// data key is unwrapped by the first of unwrappers that can; ErrNoKey is
+// returned if none can.
+func NewReader(r io.Reader, unwrappers ...KeyUnwrapper) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if !IsEncrypted(br) {
+		return nil, ErrNotEncrypted
+	}
+
+	prefix := make([]byte, len(Magic)+4)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	size := binary.BigEndian.Uint32(prefix[len(Magic):])
+	if size > maxHeaderSize {
+		return nil, fmt.Errorf("invalid header size %d", size)
+	}
+	encoded := make([]byte, size)
+	if _, err := io.ReadFull(br, encoded); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	var h header
+	if err := json.Unmarshal(encoded, &h); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if h.ChunkSize <= 0 || h.ChunkSize > maxHeaderSize || len(h.Nonce) != noncePrefixSize {
+		return nil, fmt.Errorf("invalid header")
+	}
+
+	dataKey, err := unwrap(h.Keys, unwrappers)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{
+		r:     br,
+		aead:  aead,
+		aad:   append(prefix, encoded...),
+		nonce: h.Nonce,
+		chunk: make([]byte, h.ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func unwrap(stanzas []Stanza, unwrappers []KeyUnwrapper) ([]byte, error) {
+	for _, unwrapper := range unwrappers {
+		for _, stanza := range stanzas {
+			dataKey, err := unwrapper.UnwrapKey(stanza)
+			if errors.Is(err, ErrNoKey) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+			}
+			if len(dataKey) != keySize {
+				return nil, fmt.Errorf("invalid data key")
+			}
+			return dataKey, nil
+		}
+	}
+	return nil, ErrNoKey
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk into r.plain.
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one if nothing follows
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+
+	plain, err := r.aead.Open(r.chunk[:0], chunkNonce(r.nonce, r.count, last), r.chunk[:n], r.aad)
+	if err != nil {
+		return fmt.Errorf("file is corrupt or truncated")
+	}
+	r.count++
+	r.plain = plain
+	r.done = last
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// chunkNonce is prefix, the chunk counter and 1 for the last chunk.
+func chunkNonce(prefix []byte, count uint32, last bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, count)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
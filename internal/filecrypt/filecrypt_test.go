@@ -0,0 +1,144 @@
+package filecrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testMasterKey "seals" data keys by prefixing them, enough to tell stanzas
+// apart.
+var testMasterKey = MasterKey{
+	Seal: func(s string) (string, error) { return "sealed:" + s, nil },
+	Open: func(s string) (string, error) {
+		if !strings.HasPrefix(s, "sealed:") {
+			return "", errors.New("bad ciphertext")
+		}
+		return strings.TrimPrefix(s, "sealed:"), nil
+	},
+}
+
+func encrypt(t *testing.T, plain []byte, wrappers ...KeyWrapper) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, wrappers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd write sizes cross chunk boundaries
+	for len(plain) > 0 {
+		n := min(len(plain), 1000)
+		if _, err := w.Write(plain[:n]); err != nil {
+			t.Fatal(err)
+		}
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(data []byte, unwrappers ...KeyUnwrapper) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data), unwrappers...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3 * ChunkSize} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		data := encrypt(t, plain, testMasterKey, identity.Recipient())
+
+		if !IsEncrypted(bufio.NewReader(bytes.NewReader(data))) {
+			t.Errorf("size %d: expected file to be recognized as encrypted", size)
+		}
+		for name, key := range map[string]KeyUnwrapper{"master": testMasterKey, "identity": identity} {
+			got, err := decrypt(data, key)
+			if err != nil {
+				t.Errorf("size %d, %s: decrypt failed: %v", size, name, err)
+				continue
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("size %d, %s: plaintext mismatch", size, name)
+			}
+		}
+	}
+}
+
+func TestTamperedFiles(t *testing.T) {
+	plain := bytes.Repeat([]byte("INSERT INTO t VALUES (1);\n"), ChunkSize/10)
+	data := encrypt(t, plain, testMasterKey)
+	headerEnd := len(data) - (len(plain) + (len(plain)/ChunkSize+1)*16)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated at chunk boundary", data[:headerEnd+ChunkSize+16]},
+		{"truncated inside chunk", data[:len(data)-5]},
+		{"flipped bit", func() []byte {
+			d := bytes.Clone(data)
+			d[headerEnd+100] ^= 1
+			return d
+		}()},
+		{"appended data", append(bytes.Clone(data), 0)},
+	}
+	for _, tt := range tests {
+		if _, err := decrypt(tt.data, testMasterKey); err == nil {
+			t.Errorf("%s: expected decryption to fail", tt.name)
+		}
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	identity, _ := GenerateIdentity()
+	other, _ := GenerateIdentity()
+	data := encrypt(t, []byte("secret"), identity.Recipient())
+
+	if _, err := decrypt(data, other); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey for another identity, got %v", err)
+	}
+	if _, err := decrypt(data, testMasterKey); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey for the master key, got %v", err)
+	}
+	if _, err := decrypt([]byte("-- MySQL dump"), identity); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	identity, _ := GenerateIdentity()
+
+	parsed, err := ParseIdentity(identity.String() + "\n")
+	if err != nil {
+		t.Fatalf("ParseIdentity failed: %v", err)
+	}
+	recipient, err := ParseRecipient(parsed.Recipient().String())
+	if err != nil {
+		t.Fatalf("ParseRecipient failed: %v", err)
+	}
+	if recipient.String() != identity.Recipient().String() {
+		t.Error("Expected parsed keys to match")
+	}
+
+	if _, err := ParseRecipient("not base64!"); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+	if _, err := ParseRecipient(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("Expected error for a short key")
+	}
+}
@@ -0,0 +1,174 @@
+package filecrypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Stanza types
+const (
+	StanzaMaster = "master"
+	StanzaX25519 = "x25519"
+)
+
+// MasterKey wraps data keys with a symmetric key held by the application,
+// through Seal and Open such as store.EncryptPassword and
+// store.DecryptPassword.
+type MasterKey struct {
+	Seal func(string) (string, error)
+	Open func(string) (string, error)
+}
+
+func (m MasterKey) WrapKey(dataKey []byte) (Stanza, error) {
+	sealed, err := m.Seal(base64.StdEncoding.EncodeToString(dataKey))
+	if err != nil {
+		return Stanza{}, err
+	}
+	return Stanza{Type: StanzaMaster, Key: sealed}, nil
+}
+
+func (m MasterKey) UnwrapKey(s Stanza) ([]byte, error) {
+	if s.Type != StanzaMaster {
+		return nil, ErrNoKey
+	}
+	encoded, err := m.Open(s.Key)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// Recipient is the X25519 public key of a party the data keys are wrapped
+// for. Only the holder of the matching Identity can read the files.
+type Recipient struct {
+	key *ecdh.PublicKey
+}
+
+// ParseRecipient reads a base64 encoded X25519 public key.
+func ParseRecipient(s string) (*Recipient, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return &Recipient{key: key}, nil
+}
+
+func (r *Recipient) String() string {
+	return base64.StdEncoding.EncodeToString(r.key.Bytes())
+}
+
+func (r *Recipient) WrapKey(dataKey []byte) (Stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return Stanza{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(r.key)
+	if err != nil {
+		return Stanza{}, err
+	}
+	aead, err := x25519KEK(shared, ephemeral.PublicKey().Bytes(), r.key.Bytes())
+	if err != nil {
+		return Stanza{}, err
+	}
+
+	// The key encryption key is used once, so a zero nonce is fine
+	sealed := aead.Seal(nil, make([]byte, aead.NonceSize()), dataKey, nil)
+	return Stanza{
+		Type:      StanzaX25519,
+		Recipient: r.String(),
+		Ephemeral: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Key:       base64.StdEncoding.EncodeToString(sealed),
+	}, nil
+}
+
+// Identity is the X25519 private key of a Recipient.
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// GenerateIdentity returns a new random identity.
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseIdentity reads a base64 encoded X25519 private key.
+func ParseIdentity(s string) (*Identity, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+func (i *Identity) String() string {
+	return base64.StdEncoding.EncodeToString(i.key.Bytes())
+}
+
+// Recipient returns the public key of i.
+func (i *Identity) Recipient() *Recipient {
+	return &Recipient{key: i.key.PublicKey()}
+}
+
+func (i *Identity) UnwrapKey(s Stanza) ([]byte, error) {
+	if s.Type != StanzaX25519 || s.Recipient != i.Recipient().String() {
+		return nil, ErrNoKey
+	}
+	ephemeralBytes, err := base64.StdEncoding.DecodeString(s.Ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(s.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+
+	shared, err := i.key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := x25519KEK(shared, ephemeralBytes, i.key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key")
+	}
+	return dataKey, nil
+}
+
+// x25519KEK derives the key encryption key from an X25519 shared secret and
+// both public keys.
+func x25519KEK(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := bytes.Join([][]byte{ephemeral, recipient}, nil)
+	kek := make([]byte, keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte("go-dumper filecrypt x25519")), kek); err != nil {
+		return nil, err
+	}
+	return newAEAD(kek)
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"io/fs"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/filecrypt"
+	"github.com/casparjones/go-dumper/internal/storage"
 	"github.com/casparjones/go-dumper/internal/store"
 	"github.com/gin-gonic/gin"
 )
@@ -14,12 +17,14 @@ import (
 type BackupsHandler struct {
 	repo     *store.Repository
 	restorer *backup.Restorer
+	files    *storage.Resolver
 }
 
-func NewBackupsHandler(repo *store.Repository, restorer *backup.Restorer) *BackupsHandler {
+func NewBackupsHandler(repo *store.Repository, restorer *backup.Restorer, files *storage.Resolver) *BackupsHandler {
 	return &BackupsHandler{
 		repo:     repo,
 		restorer: restorer,
+		files:    files,
 	}
 }
 
@@ -76,17 +81,34 @@ func (h *BackupsHandler) DownloadBackup(c *gin.Context) {
 		return
 	}
 
-	if _, err := os.Stat(backup.FilePath); os.IsNotExist(err) {
+	// Encrypted files are decrypted unless the file is asked for as stored
+	raw := c.Query("raw") == "true"
+	open := h.restorer.OpenBackupFile
+	if raw {
+		open = h.restorer.OpenStoredBackupFile
+	}
+
+	file, err := open(c.Request.Context(), backup)
+	if errors.Is(err, fs.ErrNotExist) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Backup file not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
 
-	filename := filepath.Base(backup.FilePath)
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", "application/gzip")
-
-	c.File(backup.FilePath)
+	filename := storage.Base(backup.FilePath)
+	size := backup.SizeBytes
+	if !raw && strings.HasSuffix(filename, filecrypt.Suffix) {
+		filename = strings.TrimSuffix(filename, filecrypt.Suffix)
+		size = -1 // the stored size includes the encryption overhead
+	}
+	c.DataFromReader(http.StatusOK, size, "application/gzip", file, map[string]string{
+		"Content-Description": "File Transfer",
+		"Content-Disposition": "attachment; filename=" + filename,
+	})
 }
 
 type RestoreBackupRequest struct {
@@ -149,14 +171,22 @@ func (h *BackupsHandler) DeleteBackup(c *gin.Context) {
 		return
 	}
 
-	backup, err := h.repo.GetBackup(id)
+	record, err := h.repo.GetBackup(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
 		return
 	}
 
-	if backup.FilePath != "" {
-		os.Remove(backup.FilePath)
+	// Every copy goes, whatever its own retention
+	for _, backupCopy := range record.Copies {
+		if err := backup.DeleteBackupCopy(c.Request.Context(), h.files, backupCopy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := h.repo.DeleteBackupCopy(backupCopy.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	if err := h.repo.DeleteBackup(id); err != nil {
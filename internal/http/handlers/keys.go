@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+type KeysHandler struct {
+	repo *store.Repository
+}
+
+func NewKeysHandler(repo *store.Repository) *KeysHandler {
+	return &KeysHandler{repo: repo}
+}
+
+// GetKeys returns the IDs of the current and previous encryption keys.
+func (h *KeysHandler) GetKeys(c *gin.Context) {
+	current, err := store.CurrentKeyID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	previous, err := store.PreviousKeyIDs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key_id": current, "previous_key_ids": previous})
+}
+
+// RotateKeys re-encrypts all secrets under the current key.
+func (h *KeysHandler) RotateKeys(c *gin.Context) {
+	rotation, err := backup.RotateEncryptionKey(h.repo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rotation)
+}
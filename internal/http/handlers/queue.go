@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/gin-gonic/gin"
+)
+
+type QueueHandler struct {
+	queue *backup.Queue
+}
+
+func NewQueueHandler(queue *backup.Queue) *QueueHandler {
+	return &QueueHandler{queue: queue}
+}
+
+// GetQueue returns the queued and running backups with the limits of the
+// queue.
+func (h *QueueHandler) GetQueue(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"concurrency": h.queue.Concurrency(),
+		"target_lock": h.queue.Policy(),
+		"tasks":       h.queue.Tasks(),
+	})
+}
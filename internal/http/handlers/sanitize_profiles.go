@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+type SanitizeProfilesHandler struct {
+	repo *store.Repository
+}
+
+func NewSanitizeProfilesHandler(repo *store.Repository) *SanitizeProfilesHandler {
+	return &SanitizeProfilesHandler{repo: repo}
+}
+
+type SanitizeProfileRequest struct {
+	Name        string               `json:"name" binding:"required"`
+	Description string               `json:"description"`
+	Rules       backup.SanitizeRules `json:"rules"`
+}
+
+type SanitizeProfileResponse struct {
+	*store.SanitizeProfile
+	Rules *backup.SanitizeRules `json:"rules"`
+}
+
+func (h *SanitizeProfilesHandler) GetProfiles(c *gin.Context) {
+	profiles, err := h.repo.GetSanitizeProfiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]*SanitizeProfileResponse, len(profiles))
+	for i, profile := range profiles {
+		response[i] = profileToResponse(profile)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *SanitizeProfilesHandler) GetProfile(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile ID"})
+		return
+	}
+
+	profile, err := h.repo.GetSanitizeProfile(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sanitize profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profileToResponse(profile))
+}
+
+func (h *SanitizeProfilesHandler) CreateProfile(c *gin.Context) {
+	var req SanitizeProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile := &store.SanitizeProfile{}
+	if err := req.apply(profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.CreateSanitizeProfile(profile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, profileToResponse(profile))
+}
+
+func (h *SanitizeProfilesHandler) UpdateProfile(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile ID"})
+		return
+	}
+
+	profile, err := h.repo.GetSanitizeProfile(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sanitize profile not found"})
+		return
+	}
+
+	var req SanitizeProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.apply(profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.UpdateSanitizeProfile(profile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profileToResponse(profile))
+}
+
+func (h *SanitizeProfilesHandler) DeleteProfile(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile ID"})
+		return
+	}
+
+	if err := h.repo.DeleteSanitizeProfile(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sanitize profile deleted successfully"})
+}
+
+// apply validates the request and copies it into profile.
+func (r *SanitizeProfileRequest) apply(profile *store.SanitizeProfile) error {
+	if err := r.Rules.Validate(); err != nil {
+		return err
+	}
+	rules, err := json.Marshal(r.Rules)
+	if err != nil {
+		return err
+	}
+
+	profile.Name = r.Name
+	profile.Description = r.Description
+	profile.Rules = string(rules)
+	return nil
+}
+
+func profileToResponse(profile *store.SanitizeProfile) *SanitizeProfileResponse {
+	response := &SanitizeProfileResponse{SanitizeProfile: profile}
+	// Profiles are validated when saved, a broken one is returned without rules
+	if rules, err := backup.ParseSanitizeRules(profile.Rules); err == nil {
+		response.Rules = rules
+	}
+	return response
+}
@@ -1,13 +1,15 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/dbconn"
+	"github.com/casparjones/go-dumper/internal/secrets"
 	"github.com/casparjones/go-dumper/internal/store"
 	"github.com/gin-gonic/gin"
 )
@@ -19,46 +21,125 @@ type TargetsHandler struct {
 
 type CreateTargetRequest struct {
 	Name              string   `json:"name" binding:"required"`
-	Host              string   `json:"host" binding:"required"`
-	Port              int      `json:"port" binding:"required"`
-	User              string   `json:"user" binding:"required"`
-	Password          string   `json:"password" binding:"required"`
+	Host              string   `json:"host"`
+	Port              int      `json:"port"`
+	User              string   `json:"user"` // required unless the engine is sqlite
+	Password          string   `json:"password,omitempty"`
+	PasswordRef       string   `json:"password_ref,omitempty"` // env:, file: or cmd: reference used instead of Password
 	Comment           string   `json:"comment"`
 	ScheduleTime      string   `json:"schedule_time"`
 	RetentionDays     int      `json:"retention_days"`
 	AutoCompress      bool     `json:"auto_compress"`
 	DatabaseMode      string   `json:"database_mode"`
 	SelectedDatabases []string `json:"selected_databases,omitempty"`
+	IncludeRoutines   bool     `json:"include_routines"`
+	IncludeTriggers   bool     `json:"include_triggers"`
+	IncludeEvents     bool     `json:"include_events"`
+	Parallelism       int      `json:"parallelism"`
+	ChunkSize         int      `json:"chunk_size"`
+	IncludeTables     []string `json:"include_tables,omitempty"`
+	ExcludeTables     []string `json:"exclude_tables,omitempty"`
+	SchemaOnlyTables  []string `json:"schema_only_tables,omitempty"`
+	ConnectionSettings
 }
 
 type UpdateTargetRequest struct {
 	Name              string   `json:"name" binding:"required"`
-	Host              string   `json:"host" binding:"required"`
-	Port              int      `json:"port" binding:"required"`
-	User              string   `json:"user" binding:"required"`
+	Host              string   `json:"host"`
+	Port              int      `json:"port"`
+	User              string   `json:"user"` // required unless the engine is sqlite
 	Password          string   `json:"password,omitempty"`
+	PasswordRef       string   `json:"password_ref,omitempty"`
 	Comment           string   `json:"comment"`
 	ScheduleTime      string   `json:"schedule_time"`
 	RetentionDays     int      `json:"retention_days"`
 	AutoCompress      bool     `json:"auto_compress"`
 	DatabaseMode      string   `json:"database_mode"`
 	SelectedDatabases []string `json:"selected_databases,omitempty"`
+	IncludeRoutines   bool     `json:"include_routines"`
+	IncludeTriggers   bool     `json:"include_triggers"`
+	IncludeEvents     bool     `json:"include_events"`
+	Parallelism       int      `json:"parallelism"`
+	ChunkSize         int      `json:"chunk_size"`
+	IncludeTables     []string `json:"include_tables,omitempty"`
+	ExcludeTables     []string `json:"exclude_tables,omitempty"`
+	SchemaOnlyTables  []string `json:"schema_only_tables,omitempty"`
+	ConnectionSettings
+}
+
+// ConnectionSettings are the engine, TLS and SSH tunnel settings of a
+// target, shared by the target and discovery requests. Secrets are
+// write-only: when a target is updated, empty ones keep their stored values.
+type ConnectionSettings struct {
+	Engine         string            `json:"engine"`          // "mysql" (default), "postgres" or "sqlite"
+	ConnectionType string            `json:"connection_type"` // "tcp" (default) or "unix"
+	Socket         string            `json:"socket"`
+	Path           string            `json:"path"` // database file of sqlite targets
+	DSNParams      map[string]string `json:"dsn_params,omitempty"`
+
+	TLSMode       string `json:"tls_mode"`
+	TLSCA         string `json:"tls_ca"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key,omitempty"`
+	SSHHost       string `json:"ssh_host"`
+	SSHPort       int    `json:"ssh_port"`
+	SSHUser       string `json:"ssh_user"`
+	SSHPassword   string `json:"ssh_password,omitempty"`
+	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	SSHHostKey    string `json:"ssh_host_key"`
+}
+
+// options returns the TLS and SSH options of s as given.
+func (s ConnectionSettings) options() (dbconn.TLS, dbconn.SSH) {
+	return dbconn.TLS{Mode: s.TLSMode, CA: s.TLSCA, Cert: s.TLSCert, Key: s.TLSKey},
+		dbconn.SSH{
+			Host:       s.SSHHost,
+			Port:       s.SSHPort,
+			User:       s.SSHUser,
+			Password:   s.SSHPassword,
+			PrivateKey: s.SSHPrivateKey,
+			HostKey:    s.SSHHostKey,
+		}
 }
 
 type TargetResponse struct {
-	ID                int64    `json:"id"`
-	Name              string   `json:"name"`
-	Host              string   `json:"host"`
-	Port              int      `json:"port"`
-	User              string   `json:"user"`
-	Comment           string   `json:"comment"`
-	ScheduleTime      string   `json:"schedule_time"`
-	RetentionDays     int      `json:"retention_days"`
-	AutoCompress      bool     `json:"auto_compress"`
-	DatabaseMode      string   `json:"database_mode"`
-	SelectedDatabases []string `json:"selected_databases,omitempty"`
-	CreatedAt         string   `json:"created_at"`
-	UpdatedAt         string   `json:"updated_at"`
+	ID                int64             `json:"id"`
+	Name              string            `json:"name"`
+	Host              string            `json:"host"`
+	Port              int               `json:"port"`
+	User              string            `json:"user"`
+	Engine            string            `json:"engine"`
+	Path              string            `json:"path,omitempty"`
+	PasswordRef       string            `json:"password_ref,omitempty"`
+	Comment           string            `json:"comment"`
+	ScheduleTime      string            `json:"schedule_time"`
+	RetentionDays     int               `json:"retention_days"`
+	AutoCompress      bool              `json:"auto_compress"`
+	DatabaseMode      string            `json:"database_mode"`
+	SelectedDatabases []string          `json:"selected_databases,omitempty"`
+	IncludeRoutines   bool              `json:"include_routines"`
+	IncludeTriggers   bool              `json:"include_triggers"`
+	IncludeEvents     bool              `json:"include_events"`
+	Parallelism       int               `json:"parallelism"`
+	ChunkSize         int               `json:"chunk_size"`
+	IncludeTables     []string          `json:"include_tables,omitempty"`
+	ExcludeTables     []string          `json:"exclude_tables,omitempty"`
+	SchemaOnlyTables  []string          `json:"schema_only_tables,omitempty"`
+	ConnectionType    string            `json:"connection_type"`
+	Socket            string            `json:"socket"`
+	DSNParams         map[string]string `json:"dsn_params,omitempty"`
+	TLSMode           string            `json:"tls_mode"`
+	TLSCA             string            `json:"tls_ca"`
+	TLSCert           string            `json:"tls_cert"`
+	HasTLSKey         bool              `json:"has_tls_key"`
+	SSHHost           string            `json:"ssh_host"`
+	SSHPort           int               `json:"ssh_port"`
+	SSHUser           string            `json:"ssh_user"`
+	HasSSHPassword    bool              `json:"has_ssh_password"`
+	HasSSHPrivateKey  bool              `json:"has_ssh_private_key"`
+	SSHHostKey        string            `json:"ssh_host_key"`
+	CreatedAt         string            `json:"created_at"`
+	UpdatedAt         string            `json:"updated_at"`
 }
 
 func NewTargetsHandler(repo *store.Repository, dumper *backup.Dumper) *TargetsHandler {
@@ -106,9 +187,14 @@ func (h *TargetsHandler) CreateTarget(c *gin.Context) {
 		return
 	}
 
-	encryptedPassword, err := store.EncryptPassword(req.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt password"})
+	// SQLite targets are a file, without a login
+	login := req.Engine != store.EngineSQLite
+	if login && req.User == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user is required"})
+		return
+	}
+	if login && req.Password == "" && req.PasswordRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password or password_ref is required"})
 		return
 	}
 
@@ -132,19 +218,48 @@ func (h *TargetsHandler) CreateTarget(c *gin.Context) {
 		Host:              req.Host,
 		Port:              req.Port,
 		User:              req.User,
-		PasswordEnc:       encryptedPassword,
 		Comment:           req.Comment,
 		ScheduleTime:      req.ScheduleTime,
 		RetentionDays:     req.RetentionDays,
 		AutoCompress:      req.AutoCompress,
 		DatabaseMode:      req.DatabaseMode,
 		SelectedDatabases: selectedDatabasesJson,
+		IncludeRoutines:   req.IncludeRoutines,
+		IncludeTriggers:   req.IncludeTriggers,
+		IncludeEvents:     req.IncludeEvents,
+		Parallelism:       req.Parallelism,
+		ChunkSize:         req.ChunkSize,
 	}
 
 	if target.RetentionDays <= 0 {
 		target.RetentionDays = 30
 	}
 
+	if target.Parallelism <= 0 {
+		target.Parallelism = 1
+	}
+
+	if target.ChunkSize < 0 {
+		target.ChunkSize = 0
+	}
+
+	if err := setTableFilter(target, req.IncludeTables, req.ExcludeTables, req.SchemaOnlyTables); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if login {
+		if status, err := setPassword(target, req.Password, req.PasswordRef); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := setConnectionSettings(target, req.ConnectionSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := h.repo.CreateTarget(target); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -172,6 +287,11 @@ func (h *TargetsHandler) UpdateTarget(c *gin.Context) {
 		return
 	}
 
+	if req.Engine != store.EngineSQLite && req.User == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user is required"})
+		return
+	}
+
 	target.Name = req.Name
 	target.Host = req.Host
 	target.Port = req.Port
@@ -180,6 +300,11 @@ func (h *TargetsHandler) UpdateTarget(c *gin.Context) {
 	target.ScheduleTime = req.ScheduleTime
 	target.RetentionDays = req.RetentionDays
 	target.AutoCompress = req.AutoCompress
+	target.IncludeRoutines = req.IncludeRoutines
+	target.IncludeTriggers = req.IncludeTriggers
+	target.IncludeEvents = req.IncludeEvents
+	target.Parallelism = req.Parallelism
+	target.ChunkSize = req.ChunkSize
 
 	// Set default database mode if not provided
 	if req.DatabaseMode == "" {
@@ -199,19 +324,36 @@ func (h *TargetsHandler) UpdateTarget(c *gin.Context) {
 	}
 	target.SelectedDatabases = selectedDatabasesJson
 
-	if req.Password != "" {
-		encryptedPassword, err := store.EncryptPassword(req.Password)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt password"})
+	// Without either the password is kept as it is
+	if req.Password != "" || req.PasswordRef != "" {
+		if status, err := setPassword(target, req.Password, req.PasswordRef); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
 			return
 		}
-		target.PasswordEnc = encryptedPassword
 	}
 
 	if target.RetentionDays <= 0 {
 		target.RetentionDays = 30
 	}
 
+	if target.Parallelism <= 0 {
+		target.Parallelism = 1
+	}
+
+	if target.ChunkSize < 0 {
+		target.ChunkSize = 0
+	}
+
+	if err := setTableFilter(target, req.IncludeTables, req.ExcludeTables, req.SchemaOnlyTables); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := setConnectionSettings(target, req.ConnectionSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := h.repo.UpdateTarget(target); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -242,7 +384,11 @@ func (h *TargetsHandler) CreateBackup(c *gin.Context) {
 		return
 	}
 
-	backup, err := h.dumper.CreateBackup(c.Request.Context(), id)
+	created, err := h.dumper.CreateBackup(c.Request.Context(), id)
+	if errors.Is(err, backup.ErrTargetBusy) || errors.Is(err, backup.ErrBackupSkipped) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -250,8 +396,8 @@ func (h *TargetsHandler) CreateBackup(c *gin.Context) {
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"message":   "Backup started",
-		"backup_id": backup.ID,
-		"status":    backup.Status,
+		"backup_id": created.ID,
+		"status":    created.Status,
 	})
 }
 
@@ -272,10 +418,12 @@ func (h *TargetsHandler) GetTargetBackups(c *gin.Context) {
 }
 
 type DiscoverDatabasesRequest struct {
-	Host     string `json:"host" binding:"required"`
-	Port     int    `json:"port" binding:"required"`
-	User     string `json:"user" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	PasswordRef string `json:"password_ref"`
+	ConnectionSettings
 }
 
 func (h *TargetsHandler) DiscoverDatabases(c *gin.Context) {
@@ -285,59 +433,53 @@ func (h *TargetsHandler) DiscoverDatabases(c *gin.Context) {
 		return
 	}
 
-	databases, err := h.getDatabases(req.Host, req.Port, req.User, req.Password)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to discover databases: %v", err)})
-		return
+	password := req.Password
+	if req.PasswordRef != "" {
+		resolved, err := secrets.Resolve(c.Request.Context(), req.PasswordRef)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to resolve password: %v", err)})
+			return
+		}
+		password = resolved
 	}
 
-	c.JSON(http.StatusOK, gin.H{"databases": databases})
-}
-
-func (h *TargetsHandler) getDatabases(host string, port int, user, password string) ([]store.DatabaseInfo, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", user, password, host, port)
-
-	db, err := sql.Open("mysql", dsn)
+	engine, err := backup.EngineFor(req.Engine, h.dumper)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %v", err)
+	tlsOptions, sshOptions := req.ConnectionSettings.options()
+	conn := dbconn.Options{
+		Engine:      req.Engine,
+		Network:     req.ConnectionType,
+		Host:        req.Host,
+		Port:        req.Port,
+		Socket:      req.Socket,
+		Path:        req.Path,
+		User:        req.User,
+		Password:    password,
+		ExtraParams: req.DSNParams,
+		TLS:         tlsOptions,
+		SSH:         sshOptions,
+	}
+	if err := conn.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	rows, err := db.Query("SHOW DATABASES")
+	names, err := engine.ListDatabases(c.Request.Context(), conn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list databases: %v", err)
-	}
-	defer rows.Close()
-
-	var databases []store.DatabaseInfo
-	systemDatabases := map[string]bool{
-		"information_schema": true,
-		"performance_schema": true,
-		"mysql":              true,
-		"sys":                true,
-	}
-
-	for rows.Next() {
-		var dbName string
-		if err := rows.Scan(&dbName); err != nil {
-			return nil, fmt.Errorf("failed to scan database name: %v", err)
-		}
-
-		// Skip system databases
-		if !systemDatabases[dbName] {
-			databases = append(databases, store.DatabaseInfo{Name: dbName})
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to discover databases: %v", err)})
+		return
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over databases: %v", err)
+	databases := make([]store.DatabaseInfo, 0, len(names))
+	for _, name := range names {
+		databases = append(databases, store.DatabaseInfo{Name: name})
 	}
 
-	return databases, nil
+	c.JSON(http.StatusOK, gin.H{"databases": databases})
 }
 
 func (h *TargetsHandler) targetToResponse(target *store.Target) *TargetResponse {
@@ -349,19 +491,171 @@ func (h *TargetsHandler) targetToResponse(target *store.Target) *TargetResponse
 		}
 	}
 
+	// Rules that fail to parse were not written by this API; show none
+	tables, _ := backup.TargetTableFilter(target)
+	var dsnParams map[string]string
+	if target.DSNParams != "" {
+		json.Unmarshal([]byte(target.DSNParams), &dsnParams)
+	}
+
 	return &TargetResponse{
 		ID:                target.ID,
 		Name:              target.Name,
 		Host:              target.Host,
 		Port:              target.Port,
 		User:              target.User,
+		Engine:            target.Engine,
+		Path:              target.Path,
+		PasswordRef:       target.PasswordRef,
 		Comment:           target.Comment,
 		ScheduleTime:      target.ScheduleTime,
 		RetentionDays:     target.RetentionDays,
 		AutoCompress:      target.AutoCompress,
 		DatabaseMode:      target.DatabaseMode,
 		SelectedDatabases: selectedDatabases,
+		IncludeRoutines:   target.IncludeRoutines,
+		IncludeTriggers:   target.IncludeTriggers,
+		IncludeEvents:     target.IncludeEvents,
+		Parallelism:       target.Parallelism,
+		ChunkSize:         target.ChunkSize,
+		IncludeTables:     tables.Include,
+		ExcludeTables:     tables.Exclude,
+		SchemaOnlyTables:  tables.SchemaOnly,
+		ConnectionType:    target.ConnectionType,
+		Socket:            target.Socket,
+		DSNParams:         dsnParams,
+		TLSMode:           target.TLSMode,
+		TLSCA:             target.TLSCA,
+		TLSCert:           target.TLSCert,
+		HasTLSKey:         target.TLSKeyEnc != "",
+		SSHHost:           target.SSHHost,
+		SSHPort:           target.SSHPort,
+		SSHUser:           target.SSHUser,
+		HasSSHPassword:    target.SSHPasswordEnc != "",
+		HasSSHPrivateKey:  target.SSHKeyEnc != "",
+		SSHHostKey:        target.SSHHostKey,
 		CreatedAt:         target.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:         target.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 }
+
+// setPassword stores either the password, encrypted, or the secret reference
+// on target and clears the other. The returned status goes with the error.
+func setPassword(target *store.Target, password, ref string) (int, error) {
+	if password != "" && ref != "" {
+		return http.StatusBadRequest, fmt.Errorf("password and password_ref are mutually exclusive")
+	}
+
+	if ref != "" {
+		parsed, err := secrets.ParseRef(ref)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		target.PasswordRef = parsed.String()
+		target.PasswordEnc = ""
+		return http.StatusOK, nil
+	}
+
+	encryptedPassword, err := store.EncryptPassword(password)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+	target.PasswordEnc = encryptedPassword
+	target.PasswordRef = ""
+	return http.StatusOK, nil
+}
+
+// setConnectionSettings stores the engine, connection type, file path, DSN
+// parameters, TLS and SSH settings on target, encrypting
+// the secrets given and keeping the stored ones otherwise, and validates the
+// result. Secrets of settings that are turned off are removed.
+func setConnectionSettings(target *store.Target, settings ConnectionSettings) error {
+	target.Engine = settings.Engine
+	if target.Engine == "" {
+		target.Engine = store.EngineMySQL
+	}
+	target.ConnectionType = settings.ConnectionType
+	if target.ConnectionType == "" {
+		target.ConnectionType = store.ConnectionTCP
+	}
+	target.Socket = settings.Socket
+	target.Path = settings.Path
+	target.DSNParams = ""
+	if len(settings.DSNParams) > 0 {
+		data, err := json.Marshal(settings.DSNParams)
+		if err != nil {
+			return fmt.Errorf("failed to serialize dsn params: %w", err)
+		}
+		target.DSNParams = string(data)
+	}
+	target.TLSMode = settings.TLSMode
+	target.TLSCA = settings.TLSCA
+	target.TLSCert = settings.TLSCert
+	target.SSHHost = settings.SSHHost
+	target.SSHPort = settings.SSHPort
+	target.SSHUser = settings.SSHUser
+	target.SSHHostKey = settings.SSHHostKey
+
+	if target.TLSCert == "" {
+		target.TLSKeyEnc = ""
+	}
+	if target.SSHHost == "" {
+		target.SSHPasswordEnc = ""
+		target.SSHKeyEnc = ""
+	}
+
+	connectionSecrets := []struct {
+		value string
+		dest  *string
+	}{
+		{settings.TLSKey, &target.TLSKeyEnc},
+		{settings.SSHPassword, &target.SSHPasswordEnc},
+		{settings.SSHPrivateKey, &target.SSHKeyEnc},
+	}
+	for _, secret := range connectionSecrets {
+		if secret.value == "" {
+			continue
+		}
+		encrypted, err := store.EncryptPassword(secret.value)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt connection secret: %w", err)
+		}
+		*secret.dest = encrypted
+	}
+
+	options, err := dbconn.TargetOptions(target)
+	if err != nil {
+		return err
+	}
+	return options.Validate()
+}
+
+// setTableFilter validates table patterns from a request and stores them on
+// target as JSON arrays.
+func setTableFilter(target *store.Target, include, exclude, schemaOnly []string) error {
+	filter := backup.TableFilter{Include: include, Exclude: exclude, SchemaOnly: schemaOnly}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	fields := []struct {
+		patterns []string
+		dest     *string
+	}{
+		{include, &target.IncludeTables},
+		{exclude, &target.ExcludeTables},
+		{schemaOnly, &target.SchemaOnlyTables},
+	}
+	for _, field := range fields {
+		*field.dest = ""
+		if len(field.patterns) == 0 {
+			continue
+		}
+		data, err := json.Marshal(field.patterns)
+		if err != nil {
+			return fmt.Errorf("failed to serialize table patterns: %w", err)
+		}
+		*field.dest = string(data)
+	}
+	return nil
+}
@@ -2,16 +2,18 @@ package router
 
 import (
 	"database/sql"
+	"log"
 
 	"github.com/casparjones/go-dumper/internal/backup"
 	"github.com/casparjones/go-dumper/internal/config"
 	"github.com/casparjones/go-dumper/internal/http/handlers"
 	"github.com/casparjones/go-dumper/internal/http/middleware"
+	"github.com/casparjones/go-dumper/internal/storage"
 	"github.com/casparjones/go-dumper/internal/store"
 	"github.com/gin-gonic/gin"
 )
 
-func New(db *sql.DB) *gin.Engine {
+func New(db *sql.DB, queue *backup.Queue) *gin.Engine {
 	if gin.Mode() != gin.DebugMode {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -24,14 +26,30 @@ func New(db *sql.DB) *gin.Engine {
 	repo := store.NewRepository(db)
 	backupDir := config.GetEnv("BACKUP_DIR", "/data/backups")
 
-	dumper := backup.NewDumper(repo, backupDir)
-	restorer := backup.NewRestorer(repo)
+	dest, err := storage.FromEnv(backupDir)
+	if err != nil {
+		log.Fatalf("Failed to configure backup storage: %v", err)
+	}
+	files := storage.NewResolver(dest)
+
+	encryption, err := backup.EncryptionFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure backup encryption: %v", err)
+	}
+
+	dumper := backup.NewDumperWithStorage(repo, backupDir, dest)
+	dumper.SetEncryption(encryption)
+	dumper.SetQueue(queue)
+	restorer := backup.NewRestorerWithStorage(repo, files, dumper)
 
 	targetsHandler := handlers.NewTargetsHandler(repo, dumper)
-	backupsHandler := handlers.NewBackupsHandler(repo, restorer)
+	backupsHandler := handlers.NewBackupsHandler(repo, restorer, files)
 	jobsHandler := handlers.NewJobsHandler(repo, dumper)
 	configHandler := handlers.NewConfigHandler(repo)
+	keysHandler := handlers.NewKeysHandler(repo)
+	sanitizeProfilesHandler := handlers.NewSanitizeProfilesHandler(repo)
 	healthHandler := handlers.NewHealthHandler(db)
+	queueHandler := handlers.NewQueueHandler(queue)
 
 	r.GET("/healthz", healthHandler.Healthz)
 	r.GET("/readyz", healthHandler.Readyz)
@@ -63,10 +81,21 @@ func New(db *sql.DB) *gin.Engine {
 		{
 			jobs.GET("", jobsHandler.GetJobs)
 			jobs.POST("", jobsHandler.CreateJob)
+			jobs.POST("/preview", jobsHandler.PreviewSchedule)
 			jobs.GET("/:id", jobsHandler.GetJob)
 			jobs.PUT("/:id", jobsHandler.UpdateJob)
 			jobs.DELETE("/:id", jobsHandler.DeleteJob)
 			jobs.POST("/:id/run", jobsHandler.RunJobNow)
+			jobs.GET("/:id/runs", jobsHandler.GetJobRuns)
+		}
+
+		sanitizeProfiles := api.Group("/sanitize-profiles")
+		{
+			sanitizeProfiles.GET("", sanitizeProfilesHandler.GetProfiles)
+			sanitizeProfiles.POST("", sanitizeProfilesHandler.CreateProfile)
+			sanitizeProfiles.GET("/:id", sanitizeProfilesHandler.GetProfile)
+			sanitizeProfiles.PUT("/:id", sanitizeProfilesHandler.UpdateProfile)
+			sanitizeProfiles.DELETE("/:id", sanitizeProfilesHandler.DeleteProfile)
 		}
 
 		config := api.Group("/config")
@@ -77,6 +106,14 @@ func New(db *sql.DB) *gin.Engine {
 			config.GET("/theme", configHandler.GetTheme)
 			config.POST("/theme", configHandler.SetTheme)
 		}
+
+		keys := api.Group("/keys")
+		{
+			keys.GET("", keysHandler.GetKeys)
+			keys.POST("/rotate", keysHandler.RotateKeys)
+		}
+
+		api.GET("/queue", queueHandler.GetQueue)
 	}
 
 	r.Static("/assets", "./web/public/assets")
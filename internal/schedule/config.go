@@ -0,0 +1,232 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Frequencies of a schedule.
+const (
+	FrequencyHourly  = "hourly"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+	FrequencyCron    = "cron"
+)
+
+// Misfire policies: what a job does about runs it missed, such as while the
+// service was down
+const (
+	MisfireRunOnce = "run_once" // run once for all of them
+	MisfireSkip    = "skip"     // skip them and wait for the next run
+	MisfireRunAll  = "run_all"  // run once for each of them, at most MisfireLimit times
+)
+
+// MisfireThreshold is how late a run may start before it counts as missed.
+const MisfireThreshold = time.Minute
+
+// DefaultMisfireLimit is the number of missed runs MisfireRunAll catches up
+// on unless the schedule sets its own limit.
+const DefaultMisfireLimit = 5
+
+// Config is the schedule of a job as it is stored with the job. Presets run
+// at every combination of the listed values, each list defaulting to the
+// first value of its field (minute 0, midnight, Monday, the 1st, January).
+// Days of the week run from Sunday as 0 (or 7) to Saturday as 6. Monthly and
+// yearly schedules run days a month is too short for on its last day, so
+// the 31st is the last day of every month and February 29 is February 28 in
+// common years. Runs missed by more than MisfireThreshold are handled by
+// Misfire, MisfireRunOnce by default.
+type Config struct {
+	Frequency   string `json:"frequency"`
+	Minutes     []int  `json:"minutes"`
+	Hours       []int  `json:"hours"`
+	Weekdays    []int  `json:"weekdays"`
+	DaysOfMonth []int  `json:"days_of_month"`
+	Months      []int  `json:"months"`
+	Cron        string `json:"cron,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+
+	Misfire      string `json:"misfire,omitempty"`
+	MisfireLimit int    `json:"misfire_limit,omitempty"` // 0 is DefaultMisfireLimit
+}
+
+// ParseConfig parses a schedule stored as JSON.
+func ParseConfig(data string) (Config, error) {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse schedule config: %w", err)
+	}
+	return config, nil
+}
+
+// Validate checks the frequency, values, time zone and misfire policy of the
+// schedule.
+func (c Config) Validate() error {
+	if _, err := LoadLocation(c.Timezone); err != nil {
+		return err
+	}
+	switch c.Misfire {
+	case "", MisfireRunOnce, MisfireSkip, MisfireRunAll:
+	default:
+		return fmt.Errorf("unknown misfire policy %q", c.Misfire)
+	}
+	if c.MisfireLimit < 0 {
+		return fmt.Errorf("misfire limit must not be negative, got %d", c.MisfireLimit)
+	}
+	_, err := c.cron()
+	return err
+}
+
+// Next returns the first run of the schedule after t, in the time zone of
+// the schedule, or the zero time if it never runs again.
+func (c Config) Next(t time.Time) (time.Time, error) {
+	runs, err := c.NextRuns(t, 1)
+	if err != nil || len(runs) == 0 {
+		return time.Time{}, err
+	}
+	return runs[0], nil
+}
+
+// NextRuns returns the next n runs of the schedule after t, in the time zone
+// of the schedule.
+func (c Config) NextRuns(t time.Time, n int) ([]time.Time, error) {
+	loc, err := LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	cron, err := c.cron()
+	if err != nil {
+		return nil, err
+	}
+	return cron.NextRuns(t.In(loc), n), nil
+}
+
+// CatchUpRuns returns how many times a job whose run was due at due runs at
+// now. A run less than MisfireThreshold late runs once; a missed one runs as
+// the misfire policy says, once, not at all, or once for each run of the
+// schedule from due to now.
+func (c Config) CatchUpRuns(due, now time.Time) (int, error) {
+	if now.Sub(due) <= MisfireThreshold {
+		return 1, nil
+	}
+
+	switch c.Misfire {
+	case "", MisfireRunOnce:
+		return 1, nil
+	case MisfireSkip:
+		return 0, nil
+	case MisfireRunAll:
+	default:
+		return 0, fmt.Errorf("unknown misfire policy %q", c.Misfire)
+	}
+
+	limit := c.MisfireLimit
+	if limit == 0 {
+		limit = DefaultMisfireLimit
+	}
+	runs := 1
+	for t := due; runs < limit; runs++ {
+		next, err := c.Next(t)
+		if err != nil {
+			return 0, err
+		}
+		if next.IsZero() || next.After(now) {
+			break
+		}
+		t = next
+	}
+	return runs, nil
+}
+
+// cron returns the schedule as a cron expression.
+func (c Config) cron() (*Cron, error) {
+	if c.Frequency == FrequencyCron {
+		cron, err := ParseCron(c.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression: %w", err)
+		}
+		return cron, nil
+	}
+
+	lists := []struct {
+		field  cronField
+		values []int
+	}{
+		{minuteField, c.Minutes},
+		{hourField, c.Hours},
+		{weekdayField, c.Weekdays},
+		{dayField, c.DaysOfMonth},
+		{monthField, c.Months},
+	}
+	for _, list := range lists {
+		for _, v := range list.values {
+			if v < list.field.min || v > list.field.max {
+				return nil, fmt.Errorf("%s %d is out of range %d-%d", list.field.name, v, list.field.min, list.field.max)
+			}
+		}
+	}
+
+	cron := &Cron{
+		expr:       c.Frequency,
+		seconds:    1,
+		minutes:    valueBits(c.Minutes, 0),
+		hours:      fieldBits(hourField),
+		days:       fieldBits(dayField),
+		months:     fieldBits(monthField),
+		weekdays:   fieldBits(weekdayField),
+		anyDay:     true,
+		anyWeekday: true,
+	}
+	switch c.Frequency {
+	case FrequencyHourly:
+	case FrequencyDaily:
+		cron.hours = valueBits(c.Hours, 0)
+	case FrequencyWeekly:
+		cron.hours = valueBits(c.Hours, 0)
+		cron.weekdays = valueBits(c.Weekdays, int(time.Monday))
+		cron.anyWeekday = false
+	case FrequencyYearly:
+		cron.months = valueBits(c.Months, int(time.January))
+		fallthrough
+	case FrequencyMonthly:
+		cron.hours = valueBits(c.Hours, 0)
+		cron.days = valueBits(c.DaysOfMonth, 1)
+		cron.anyDay = false
+		cron.clampDays = true
+	case "":
+		return nil, fmt.Errorf("schedule frequency is required")
+	default:
+		return nil, fmt.Errorf("unknown schedule frequency %q", c.Frequency)
+	}
+
+	// Sunday is 0 and 7
+	if cron.weekdays&(1<<7) != 0 {
+		cron.weekdays |= 1
+	}
+	return cron, nil
+}
+
+// valueBits returns values as a bit set, or the default value if there are
+// none.
+func valueBits(values []int, def int) uint64 {
+	if len(values) == 0 {
+		return 1 << uint(def)
+	}
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+// fieldBits returns all values of f as a bit set.
+func fieldBits(f cronField) uint64 {
+	var bits uint64
+	for v := f.min; v <= f.max; v++ {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
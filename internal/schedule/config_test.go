@@ -0,0 +1,281 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "hourly", config: Config{Frequency: FrequencyHourly, Minutes: []int{0, 30}}},
+		{name: "daily defaults", config: Config{Frequency: FrequencyDaily}},
+		{name: "weekly sunday", config: Config{Frequency: FrequencyWeekly, Weekdays: []int{0, 7}}},
+		{name: "monthly last day", config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{31}}},
+		{name: "yearly", config: Config{Frequency: FrequencyYearly, Months: []int{2}, DaysOfMonth: []int{29}}},
+		{name: "cron", config: Config{Frequency: FrequencyCron, Cron: "0 3 * * *", Timezone: "Europe/Berlin"}},
+		{name: "no frequency", config: Config{}, wantErr: true},
+		{name: "unknown frequency", config: Config{Frequency: "fortnightly"}, wantErr: true},
+		{name: "minute out of range", config: Config{Frequency: FrequencyHourly, Minutes: []int{60}}, wantErr: true},
+		{name: "negative minute", config: Config{Frequency: FrequencyHourly, Minutes: []int{-1}}, wantErr: true},
+		{name: "hour out of range", config: Config{Frequency: FrequencyDaily, Hours: []int{24}}, wantErr: true},
+		{name: "weekday out of range", config: Config{Frequency: FrequencyWeekly, Weekdays: []int{8}}, wantErr: true},
+		{name: "day zero", config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{0}}, wantErr: true},
+		{name: "day out of range", config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{32}}, wantErr: true},
+		{name: "month out of range", config: Config{Frequency: FrequencyYearly, Months: []int{13}}, wantErr: true},
+		{name: "invalid cron", config: Config{Frequency: FrequencyCron, Cron: "0 3 * *"}, wantErr: true},
+		{name: "missing cron", config: Config{Frequency: FrequencyCron}, wantErr: true},
+		{name: "unknown time zone", config: Config{Frequency: FrequencyDaily, Timezone: "Europe/Atlantis"}, wantErr: true},
+		{name: "misfire run all", config: Config{Frequency: FrequencyDaily, Misfire: MisfireRunAll, MisfireLimit: 3}},
+		{name: "unknown misfire policy", config: Config{Frequency: FrequencyDaily, Misfire: "later"}, wantErr: true},
+		{name: "negative misfire limit", config: Config{Frequency: FrequencyDaily, Misfire: MisfireRunAll, MisfireLimit: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigNextRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		from     time.Time
+		expected []time.Time
+	}{
+		{
+			name:   "hourly",
+			config: Config{Frequency: FrequencyHourly, Minutes: []int{45, 15}},
+			from:   time.Date(2024, 12, 31, 23, 20, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 12, 31, 23, 45, 0, 0, time.UTC),
+				time.Date(2025, 1, 1, 0, 15, 0, 0, time.UTC),
+				time.Date(2025, 1, 1, 0, 45, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "hourly default",
+			config: Config{Frequency: FrequencyHourly},
+			from:   time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 5, 10, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "daily every combination",
+			config: Config{Frequency: FrequencyDaily, Hours: []int{18, 6}, Minutes: []int{0, 30}},
+			from:   time.Date(2024, 5, 10, 6, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 5, 10, 6, 30, 0, 0, time.UTC),
+				time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC),
+				time.Date(2024, 5, 10, 18, 30, 0, 0, time.UTC),
+				time.Date(2024, 5, 11, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "daily across leap day",
+			config: Config{Frequency: FrequencyDaily, Hours: []int{2}},
+			from:   time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 2, 29, 2, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "weekly default monday",
+			config: Config{Frequency: FrequencyWeekly},
+			from:   time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), // Friday
+			expected: []time.Time{
+				time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "weekly sunday as 0 and 7",
+			config: Config{Frequency: FrequencyWeekly, Weekdays: []int{7, 3}, Hours: []int{4}},
+			from:   time.Date(2024, 12, 29, 4, 0, 0, 0, time.UTC), // Sunday
+			expected: []time.Time{
+				time.Date(2025, 1, 1, 4, 0, 0, 0, time.UTC),
+				time.Date(2025, 1, 5, 4, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "monthly later today",
+			config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{10}, Hours: []int{1, 23}},
+			from:   time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 5, 10, 23, 0, 0, 0, time.UTC),
+				time.Date(2024, 6, 10, 1, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "monthly on the 31st runs on month end",
+			config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{31}},
+			from:   time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "monthly month end in a common year",
+			config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{30}},
+			from:   time.Date(2023, 1, 30, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 3, 30, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "monthly days clamped to the same day run once",
+			config: Config{Frequency: FrequencyMonthly, DaysOfMonth: []int{29, 30, 31}},
+			from:   time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 3, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "yearly default",
+			config: Config{Frequency: FrequencyYearly},
+			from:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "yearly leap day",
+			config: Config{Frequency: FrequencyYearly, Months: []int{2}, DaysOfMonth: []int{29}, Hours: []int{3}},
+			from:   time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 2, 29, 3, 0, 0, 0, time.UTC),
+				time.Date(2025, 2, 28, 3, 0, 0, 0, time.UTC),
+				time.Date(2026, 2, 28, 3, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "yearly across century without leap day",
+			config: Config{Frequency: FrequencyYearly, Months: []int{2}, DaysOfMonth: []int{29}},
+			from:   time.Date(2099, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2100, 2, 28, 0, 0, 0, 0, time.UTC),
+				time.Date(2101, 2, 28, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "yearly several months",
+			config: Config{Frequency: FrequencyYearly, Months: []int{12, 6}, DaysOfMonth: []int{31}},
+			from:   time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "time zone",
+			config: Config{Frequency: FrequencyDaily, Hours: []int{2}, Timezone: "Europe/Berlin"},
+			from:   time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), // 02:00 is skipped, 03:00 CEST
+				time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "cron",
+			config: Config{Frequency: FrequencyCron, Cron: "0 0 1 * *"},
+			from:   time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := tt.config.NextRuns(tt.from, len(tt.expected))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, runs)
+			}
+			for i, expected := range tt.expected {
+				if !runs[i].Equal(expected) {
+					t.Errorf("Expected run %d at %v, got %v", i, expected, runs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConfigNextRejectsUnknownFrequency(t *testing.T) {
+	if _, err := (Config{Frequency: "often"}).Next(time.Now()); err == nil {
+		t.Error("Expected error for an unknown frequency")
+	}
+}
+
+func TestConfigCatchUpRuns(t *testing.T) {
+	due := time.Date(2024, 5, 10, 2, 0, 0, 0, time.UTC)
+	hourly := Config{Frequency: FrequencyHourly}
+
+	tests := []struct {
+		name     string
+		misfire  string
+		limit    int
+		now      time.Time
+		expected int
+	}{
+		{name: "on time", misfire: MisfireSkip, now: due.Add(10 * time.Second), expected: 1},
+		{name: "run once by default", now: due.Add(5 * time.Hour), expected: 1},
+		{name: "run once", misfire: MisfireRunOnce, now: due.Add(5 * time.Hour), expected: 1},
+		{name: "skip", misfire: MisfireSkip, now: due.Add(2 * time.Minute), expected: 0},
+		{name: "run all", misfire: MisfireRunAll, now: due.Add(2*time.Hour + 30*time.Minute), expected: 3},
+		{name: "run all on the last run", misfire: MisfireRunAll, limit: 10, now: due.Add(3 * time.Hour), expected: 4},
+		{name: "run all up to the limit", misfire: MisfireRunAll, limit: 2, now: due.Add(5 * time.Hour), expected: 2},
+		{name: "run all up to the default limit", misfire: MisfireRunAll, now: due.Add(48 * time.Hour), expected: DefaultMisfireLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := hourly
+			config.Misfire, config.MisfireLimit = tt.misfire, tt.limit
+			runs, err := config.CatchUpRuns(due, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runs != tt.expected {
+				t.Errorf("Expected %d runs, got %d", tt.expected, runs)
+			}
+		})
+	}
+
+	if _, err := (Config{Frequency: FrequencyDaily, Misfire: "later"}).CatchUpRuns(due, due.Add(time.Hour)); err == nil {
+		t.Error("Expected error for an unknown misfire policy")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(`{"frequency": "cron", "cron": "*/5 * * * *", "timezone": "UTC", "misfire": "run_all", "misfire_limit": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Frequency != FrequencyCron || config.Cron != "*/5 * * * *" || config.Timezone != "UTC" ||
+		config.Misfire != MisfireRunAll || config.MisfireLimit != 3 {
+		t.Errorf("Unexpected config %+v", config)
+	}
+	if _, err := ParseConfig("{"); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
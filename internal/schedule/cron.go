@@ -0,0 +1,304 @@
+// Package schedule computes when scheduled jobs run next.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Jobs name their time zone; the image has no zoneinfo of its own
+	_ "time/tzdata"
+)
+
+// cronSearchYears bounds the search for the next run. Leap days are at most
+// eight years apart; expressions that match no later day never run.
+const cronSearchYears = 9
+
+// cronMacros are the shorthands for common expressions.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronField describes one field of an expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names of the values from min on, if any
+}
+
+var (
+	secondField  = cronField{name: "second", min: 0, max: 59}
+	minuteField  = cronField{name: "minute", min: 0, max: 59}
+	hourField    = cronField{name: "hour", min: 0, max: 23}
+	dayField     = cronField{name: "day of month", min: 1, max: 31}
+	monthField   = cronField{name: "month", min: 1, max: 12, names: monthNames}
+	weekdayField = cronField{name: "day of week", min: 0, max: 7, names: weekdayNames}
+)
+
+// Cron is a parsed cron expression: five fields (minute, hour, day of
+// month, month, day of week) or six with a leading second field. Fields are
+// lists of values, ranges (1-5) and steps (*/15, 10-40/10); months and days
+// of the week also take names (JAN, MON), and Sunday is 0 or 7. As in other
+// crons, a day must match the day of month or the day of week if both are
+// restricted, and both if one is *. The macros @yearly, @monthly, @weekly,
+// @daily and @hourly stand for their five field expressions.
+type Cron struct {
+	expr string
+
+	seconds, minutes, hours, days, months, weekdays uint64
+
+	// anyDay and anyWeekday are set for fields that are * or ?
+	anyDay, anyWeekday bool
+
+	// withSeconds is set for six field expressions
+	withSeconds bool
+
+	// clampDays makes days past the end of a month match its last day
+	clampDays bool
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := cronMacros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron macro %q", spec)
+		}
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	c := &Cron{expr: expr}
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+		c.withSeconds = true
+	default:
+		return nil, fmt.Errorf("cron expression must have 5 or 6 fields, got %d", len(fields))
+	}
+
+	var err error
+	parts := []struct {
+		field cronField
+		value string
+		dest  *uint64
+		any   *bool
+	}{
+		{secondField, fields[0], &c.seconds, nil},
+		{minuteField, fields[1], &c.minutes, nil},
+		{hourField, fields[2], &c.hours, nil},
+		{dayField, fields[3], &c.days, &c.anyDay},
+		{monthField, fields[4], &c.months, nil},
+		{weekdayField, fields[5], &c.weekdays, &c.anyWeekday},
+	}
+	for _, part := range parts {
+		if *part.dest, err = part.field.parse(part.value, part.any != nil); err != nil {
+			return nil, err
+		}
+		if part.any != nil {
+			*part.any = part.value == "*" || part.value == "?"
+		}
+	}
+
+	// Sunday is 0 and 7
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	return c, nil
+}
+
+// String returns the expression c was parsed from.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// parse returns the values of the field s as a bit set. Question marks
+// stand for * in fields that allow them.
+func (f cronField) parse(s string, question bool) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(item, "/")
+
+		var lo, hi int
+		switch {
+		case rangeSpec == "*" || (question && rangeSpec == "?"):
+			lo, hi = f.min, f.max
+		case strings.Contains(rangeSpec, "-"):
+			from, to, _ := strings.Cut(rangeSpec, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(to); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid %s range %q: start is after end", f.name, rangeSpec)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rangeSpec); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// 5/15 is 5-max/15
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepSpec)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepSpec)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name of the field.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s %d is out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t the expression matches, in the time
+// zone of t, or the zero time if it never does. Matching is done on the
+// wall clock of that zone: a time skipped when the clocks go forward runs
+// when they do, one that occurs twice when they go back runs the first
+// time only.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	unit := time.Minute
+	if c.withSeconds {
+		unit = time.Second
+	}
+
+	// w runs through the wall clock times of loc, kept in UTC to step
+	// through them without skips or repeats
+	w := wallClock(t).Truncate(unit).Add(unit)
+	limit := w.AddDate(cronSearchYears, 0, 0)
+	for w.Before(limit) {
+		switch {
+		case c.months&(1<<uint(w.Month())) == 0:
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(w):
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hours&(1<<uint(w.Hour())) == 0:
+			w = w.Truncate(time.Hour).Add(time.Hour)
+		case c.minutes&(1<<uint(w.Minute())) == 0:
+			w = w.Truncate(time.Minute).Add(time.Minute)
+		case c.seconds&(1<<uint(w.Second())) == 0:
+			w = w.Add(time.Second)
+		default:
+			if next := resolveWallClock(w, loc); next.After(t) {
+				return next
+			}
+			w = w.Add(unit)
+		}
+	}
+	return time.Time{}
+}
+
+// NextRuns returns the next n times after t the expression matches, fewer
+// if it stops matching.
+func (c *Cron) NextRuns(t time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	for len(runs) < n {
+		t = c.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs
+}
+
+// dayMatches reports whether the day of w matches the day of month and day
+// of week fields.
+func (c *Cron) dayMatches(w time.Time) bool {
+	day := c.days&(1<<uint(w.Day())) != 0
+	if !day && c.clampDays {
+		last := time.Date(w.Year(), w.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		day = w.Day() == last && c.days>>uint(last+1) != 0
+	}
+	weekday := c.weekdays&(1<<uint(w.Weekday())) != 0
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// wallClock returns the date and time t shows in its time zone, as UTC.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// resolveWallClock returns the time the clocks of loc show the wall clock
+// time w, the earlier one if they show it twice, and the end of the gap if
+// they skip it.
+func resolveWallClock(w time.Time, loc *time.Location) time.Time {
+	// The offsets in effect well before and after w are the only ones the
+	// zone can have at w
+	var first time.Time
+	for _, probe := range []time.Time{w.Add(-48 * time.Hour), w.Add(48 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		t := w.Add(-time.Duration(offset) * time.Second).In(loc)
+		if wallClock(t).Equal(w) && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+	}
+	if !first.IsZero() {
+		return first
+	}
+
+	// With the offset from before the gap, w lands after it
+	_, offset := w.Add(-48 * time.Hour).In(loc).Zone()
+	start, _ := w.Add(-time.Duration(offset) * time.Second).In(loc).ZoneBounds()
+	return start.In(loc)
+}
+
+// LoadLocation returns the IANA time zone name, e.g. "Europe/Berlin", or
+// the local time zone of the server for an empty name.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
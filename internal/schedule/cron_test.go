@@ -0,0 +1,211 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 2 * * *"},
+		{expr: "*/15 * * * *"},
+		{expr: "30 0 2 * * MON-FRI"},
+		{expr: "0 0 1,15 * ?"},
+		{expr: "0 12 * jan,Jul sun"},
+		{expr: "0 0 * * 7"},
+		{expr: "5/20 * * * *"},
+		{expr: "@daily"},
+		{expr: "@Weekly"},
+		{expr: "", wantErr: true},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "10-5 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "? * * * *", wantErr: true},
+		{expr: "* * * FOO *", wantErr: true},
+		{expr: "@reboot", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		from     time.Time
+		expected []time.Time
+	}{
+		{
+			name: "every 15 minutes",
+			expr: "*/15 * * * *",
+			from: time.Date(2024, 5, 10, 10, 7, 30, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 5, 10, 10, 15, 0, 0, time.UTC),
+				time.Date(2024, 5, 10, 10, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "seconds",
+			expr: "*/20 * * * * *",
+			from: time.Date(2024, 5, 10, 10, 0, 50, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 5, 10, 10, 1, 0, 0, time.UTC),
+				time.Date(2024, 5, 10, 10, 1, 20, 0, time.UTC),
+			},
+		},
+		{
+			name: "weekdays by name",
+			expr: "0 9 * * MON-FRI",
+			from: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC), // Friday
+			expected: []time.Time{
+				time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, 5, 14, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 0 13 * 5",
+			from: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 9, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 9, 20, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			from: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "month end",
+			expr: "0 0 31 * *",
+			from: time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: time.Date(2097, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2104, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "local time zone",
+			expr: "0 2 * * *",
+			from: time.Date(2024, 5, 10, 0, 0, 0, 0, berlin),
+			expected: []time.Time{
+				time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "skipped by spring forward",
+			expr: "30 2 * * *",
+			from: time.Date(2024, 3, 30, 12, 0, 0, 0, berlin),
+			expected: []time.Time{
+				time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), // 03:00 CEST
+				time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "repeated by fall back",
+			expr: "30 2 * * *",
+			from: time.Date(2024, 10, 26, 12, 0, 0, 0, berlin),
+			expected: []time.Time{
+				time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC), // first 02:30
+				time.Date(2024, 10, 28, 1, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "hourly across fall back",
+			expr: "0 * * * *",
+			from: time.Date(2024, 11, 3, 0, 30, 0, 0, newYork),
+			expected: []time.Time{
+				time.Date(2024, 11, 3, 5, 0, 0, 0, time.UTC), // 01:00 EDT
+				time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC), // 02:00 EST
+			},
+		},
+		{
+			name: "hourly across spring forward",
+			expr: "0 * * * *",
+			from: time.Date(2024, 3, 10, 1, 30, 0, 0, newYork),
+			expected: []time.Time{
+				time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), // 03:00 EDT
+				time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "never",
+			expr:     "0 0 30 2 *",
+			from:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			expected: []time.Time{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := tt.from
+			for _, expected := range tt.expected {
+				next = cron.Next(next)
+				if !next.Equal(expected) {
+					t.Fatalf("Expected %v, got %v", expected, next)
+				}
+				if !next.IsZero() && next.Location() != tt.from.Location() {
+					t.Errorf("Expected time in %v, got %v", tt.from.Location(), next.Location())
+				}
+			}
+		})
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	if loc, err := LoadLocation(""); err != nil || loc != time.Local {
+		t.Errorf("Expected the local time zone, got %v, %v", loc, err)
+	}
+	if _, err := LoadLocation("Europe/Berlin"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := LoadLocation("Mars/Olympus_Mons"); err == nil {
+		t.Error("Expected error for an unknown time zone")
+	}
+}
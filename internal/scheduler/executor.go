@@ -0,0 +1,208 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/schedule"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+// Executor runs schedule jobs, for the scheduler and for manual runs alike,
+// and records each run in the job's run history.
+type Executor struct {
+	repo   *store.Repository
+	dumper *backup.Dumper
+
+	// runBackup runs the backups of a job, dumper.RunBackup unless replaced
+	// in tests
+	runBackup func(ctx context.Context, targetID int64, run backup.RunOptions) ([]*store.Backup, error)
+}
+
+func NewExecutor(repo *store.Repository, dumper *backup.Dumper) *Executor {
+	return &Executor{
+		repo:      repo,
+		dumper:    dumper,
+		runBackup: dumper.RunBackup,
+	}
+}
+
+// Start marks job as running with notes and runs it in the background.
+func (e *Executor) Start(job *store.ScheduleJob, notes string) error {
+	return e.StartRuns(job, notes, 1)
+}
+
+// StartRuns marks job as running with notes and runs it runs times in a row
+// in the background, as when catching up on missed runs. The job stays
+// running until the last of them finished.
+func (e *Executor) StartRuns(job *store.ScheduleJob, notes string, runs int) error {
+	now := time.Now()
+	if err := e.repo.UpdateScheduleJobRunStatus(job.ID, store.JobStatusRunning, notes, &now, job.NextRunAt); err != nil {
+		return err
+	}
+
+	go e.runAll(context.Background(), job, runs)
+	return nil
+}
+
+// runAll runs job runs times in a row. The job's status is only updated
+// after the last run, so it shows as running until all of them finished.
+func (e *Executor) runAll(ctx context.Context, job *store.ScheduleJob, runs int) {
+	var run *store.JobRun
+	for i := 0; i < runs; i++ {
+		run = e.runOnce(ctx, job)
+	}
+	if run != nil {
+		e.updateJobStatus(job, run)
+	}
+}
+
+// Skip records a run of job skipped for reason and moves the job on to its
+// next run.
+func (e *Executor) Skip(job *store.ScheduleJob, reason string) {
+	now := time.Now()
+	run := &store.JobRun{
+		JobID:      job.ID,
+		StartedAt:  now,
+		FinishedAt: &now,
+		Status:     store.JobStatusSkipped,
+		Error:      reason,
+	}
+	if err := e.repo.CreateJobRun(run); err != nil {
+		log.Printf("Failed to record skipped run of job %d: %v", job.ID, err)
+	}
+
+	log.Printf("Job %d skipped: %s", job.ID, reason)
+	if err := e.repo.UpdateScheduleJobRunStatus(job.ID, store.JobStatusSkipped, reason, &now, NextRun(job)); err != nil {
+		log.Printf("Failed to update job %d status: %v", job.ID, err)
+	}
+}
+
+// Run runs job once, waiting for the backups of all its databases. The run
+// fails if any of them does. It records the run and the job's last run and
+// next run time, and returns the run.
+func (e *Executor) Run(ctx context.Context, job *store.ScheduleJob) *store.JobRun {
+	run := e.runOnce(ctx, job)
+	e.updateJobStatus(job, run)
+	return run
+}
+
+// runOnce runs job once and records the run, but not the job's status.
+func (e *Executor) runOnce(ctx context.Context, job *store.ScheduleJob) *store.JobRun {
+	run := &store.JobRun{
+		JobID:     job.ID,
+		StartedAt: time.Now(),
+		Status:    store.JobStatusRunning,
+	}
+	if err := e.repo.CreateJobRun(run); err != nil {
+		log.Printf("Failed to record run of job %d: %v", job.ID, err)
+	}
+
+	backups, err := e.backup(ctx, job)
+	finishRun(run, backups, err)
+
+	if run.ID != 0 {
+		if err := e.repo.UpdateJobRun(run); err != nil {
+			log.Printf("Failed to update run %d of job %d: %v", run.ID, job.ID, err)
+		}
+	}
+
+	switch run.Status {
+	case store.JobStatusSuccess:
+		log.Printf("Job %d completed successfully", job.ID)
+	case store.JobStatusSkipped:
+		log.Printf("Job %d skipped: %s", job.ID, run.Error)
+	default:
+		log.Printf("Job %d failed: %s", job.ID, run.Error)
+	}
+	return run
+}
+
+// updateJobStatus records run as the last run of job and moves the job on
+// to its next run.
+func (e *Executor) updateJobStatus(job *store.ScheduleJob, run *store.JobRun) {
+	notes := run.Error
+	if run.Status == store.JobStatusSuccess {
+		notes = fmt.Sprintf("Backup completed successfully (%d databases)", len(run.BackupIDs))
+	}
+	if err := e.repo.UpdateScheduleJobRunStatus(job.ID, run.Status, notes, &run.StartedAt, NextRun(job)); err != nil {
+		log.Printf("Failed to update job %d status: %v", job.ID, err)
+	}
+}
+
+// backup backs up the target of job with its options.
+func (e *Executor) backup(ctx context.Context, job *store.ScheduleJob) ([]*store.Backup, error) {
+	var options BackupOptions
+	if err := json.Unmarshal([]byte(job.BackupOptions), &options); err != nil {
+		return nil, fmt.Errorf("failed to parse backup options: %w", err)
+	}
+	meta, err := backup.ParseJobMetaConfig(job.MetaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	run := options.RunOptions()
+	run.Replicas = meta.Replicas()
+	run.JobID = job.ID
+	backups, err := e.runBackup(ctx, job.TargetID, run)
+	if err != nil && !errors.Is(err, backup.ErrBackupSkipped) {
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+	return backups, err
+}
+
+// finishRun sets the outcome of run from its backups, or from err if they
+// could not be started.
+func finishRun(run *store.JobRun, backups []*store.Backup, err error) {
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if errors.Is(err, backup.ErrBackupSkipped) {
+		run.Status = store.JobStatusSkipped
+		run.Error = err.Error()
+		return
+	}
+	if err != nil {
+		run.Status = store.JobStatusFailed
+		run.Error = err.Error()
+		return
+	}
+
+	var failures []string
+	for _, b := range backups {
+		run.BackupIDs = append(run.BackupIDs, b.ID)
+		if b.Status != store.BackupStatusSuccess {
+			failures = append(failures, fmt.Sprintf("%s: %s", b.DatabaseName, b.Notes))
+		}
+	}
+	if len(failures) > 0 {
+		run.Status = store.JobStatusFailed
+		run.Error = fmt.Sprintf("%d of %d backups failed: %s", len(failures), len(backups), strings.Join(failures, "; "))
+		return
+	}
+	run.Status = store.JobStatusSuccess
+}
+
+// NextRun returns the next run of job after now, or nil if it has none.
+func NextRun(job *store.ScheduleJob) *time.Time {
+	config, err := schedule.ParseConfig(job.ScheduleConfig)
+	if err != nil {
+		log.Printf("Failed to parse schedule config for job %d: %v", job.ID, err)
+		return nil
+	}
+
+	next, err := config.Next(time.Now())
+	if err != nil {
+		log.Printf("Failed to calculate next run for job %d: %v", job.ID, err)
+		return nil
+	}
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/backup"
+	"github.com/casparjones/go-dumper/internal/store"
+)
+
+func TestExecutorRunAllKeepsJobRunning(t *testing.T) {
+	t.Setenv("APP_ENC_KEY", "utnQ1VVldc0sA94bFDn3foBgyv5U3gVJsgLcoZB3Bj4=")
+
+	db, err := store.InitDB(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := store.NewRepository(db)
+
+	target := &store.Target{Name: "app", Host: "localhost", Port: 3306, User: "root", DatabaseMode: store.DatabaseModeAll}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	job := &store.ScheduleJob{
+		TargetID:       target.ID,
+		Name:           "nightly",
+		IsActive:       true,
+		ScheduleConfig: `{"frequency": "cron", "cron": "0 3 * * *", "timezone": "UTC", "misfire": "run_all"}`,
+		BackupOptions:  `{"include_structure": true, "include_data": true}`,
+		MetaConfig:     "{}",
+	}
+	if err := repo.CreateScheduleJob(job); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := repo.UpdateScheduleJobRunStatus(job.ID, store.JobStatusRunning, "Catching up 3 missed runs", &now, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(repo, backup.NewDumper(repo, t.TempDir()))
+	calls := 0
+	executor.runBackup = func(ctx context.Context, targetID int64, run backup.RunOptions) ([]*store.Backup, error) {
+		calls++
+		current, err := repo.GetScheduleJob(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.LastRunStatus != store.JobStatusRunning {
+			t.Errorf("Run %d: job status %q before all runs finished, expected %q", calls, current.LastRunStatus, store.JobStatusRunning)
+		}
+		return []*store.Backup{{ID: int64(calls), DatabaseName: "app", Status: store.BackupStatusSuccess}}, nil
+	}
+
+	executor.runAll(context.Background(), job, 3)
+
+	if calls != 3 {
+		t.Fatalf("Expected 3 runs, got %d", calls)
+	}
+	current, err := repo.GetScheduleJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.LastRunStatus != store.JobStatusSuccess {
+		t.Errorf("Expected job status %q after the last run, got %q", store.JobStatusSuccess, current.LastRunStatus)
+	}
+	if current.NextRunAt == nil {
+		t.Error("Expected the next run time to be set after the last run")
+	}
+	runs, err := repo.GetJobRuns(job.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Errorf("Expected 3 recorded runs, got %d", len(runs))
+	}
+	for _, run := range runs {
+		if run.Status != store.JobStatusSuccess {
+			t.Errorf("Run %d: expected status %q, got %q", run.ID, store.JobStatusSuccess, run.Status)
+		}
+	}
+}
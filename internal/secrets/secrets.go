@@ -0,0 +1,182 @@
+// Package secrets resolves references to secrets kept outside the database,
+// such as the passwords of targets. A reference is "<kind>:<value>":
+//
+//	env:DUMPER_SECRET_MYSQL          an environment variable
+//	file:/run/secrets/mysql_password a file, e.g. a Docker or Kubernetes secret
+//	cmd:vault kv get -field=pw db    the output of a command run with sh -c
+//
+// Environment variables must be named by SECRET_ENV_VARS, files must be below
+// one of the directories in SECRET_FILE_DIRS and commands are only run if
+// SECRET_COMMANDS is true, as anyone who can edit targets could otherwise
+// read any variable or file or run any command on the server.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/casparjones/go-dumper/internal/config"
+)
+
+// Kinds of references
+const (
+	KindEnv     = "env"
+	KindFile    = "file"
+	KindCommand = "cmd"
+)
+
+// DefaultFileDirs are the directories files may be read from unless
+// SECRET_FILE_DIRS is set.
+const DefaultFileDirs = "/run/secrets,/var/run/secrets"
+
+// DefaultEnvVars are the environment variables that may be read unless
+// SECRET_ENV_VARS is set. A trailing * matches any suffix.
+const DefaultEnvVars = "DUMPER_SECRET_*"
+
+// CommandTimeout bounds how long a command may take to print its secret.
+var CommandTimeout = 30 * time.Second
+
+// protectedEnv are the app's own secrets, which references can't read even
+// if SECRET_ENV_VARS names them.
+var protectedEnv = map[string]bool{
+	"APP_ENC_KEY":          true,
+	"APP_ENC_KEY_PREVIOUS": true,
+	"ADMIN_PASS":           true,
+	"S3_ACCESS_KEY":        true,
+	"S3_SECRET_KEY":        true,
+}
+
+// Ref is a parsed reference.
+type Ref struct {
+	Kind  string
+	Value string
+}
+
+func (r Ref) String() string {
+	return r.Kind + ":" + r.Value
+}
+
+// ParseRef parses and checks a reference, without resolving it.
+func ParseRef(s string) (Ref, error) {
+	kind, value, ok := strings.Cut(strings.TrimSpace(s), ":")
+	ref := Ref{Kind: kind, Value: strings.TrimSpace(value)}
+	if !ok || ref.Value == "" {
+		return ref, fmt.Errorf("invalid secret reference %q: expected env:, file: or cmd:", s)
+	}
+
+	switch ref.Kind {
+	case KindEnv:
+		if err := checkEnv(ref.Value); err != nil {
+			return ref, err
+		}
+	case KindFile:
+		if err := checkFile(ref.Value); err != nil {
+			return ref, err
+		}
+	case KindCommand:
+		if config.GetEnv("SECRET_COMMANDS", "false") != "true" {
+			return ref, fmt.Errorf("command secret references are disabled; set SECRET_COMMANDS=true to allow them")
+		}
+	default:
+		return ref, fmt.Errorf("unknown secret reference kind %q", ref.Kind)
+	}
+	return ref, nil
+}
+
+// Resolve returns the secret s refers to.
+func Resolve(ctx context.Context, s string) (string, error) {
+	ref, err := ParseRef(s)
+	if err != nil {
+		return "", err
+	}
+	return ref.Resolve(ctx)
+}
+
+// Resolve returns the secret r refers to. Trailing line breaks are removed
+// from files and command output.
+func (r Ref) Resolve(ctx context.Context) (string, error) {
+	switch r.Kind {
+	case KindEnv:
+		value, ok := os.LookupEnv(r.Value)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", r.Value)
+		}
+		return value, nil
+	case KindFile:
+		data, err := os.ReadFile(r.Value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case KindCommand:
+		return runCommand(ctx, r.Value)
+	}
+	return "", fmt.Errorf("unknown secret reference kind %q", r.Kind)
+}
+
+// checkEnv makes sure the environment variable name is allowed.
+func checkEnv(name string) error {
+	if protectedEnv[name] {
+		return fmt.Errorf("secret reference can't read %s", name)
+	}
+	for _, pattern := range strings.Split(config.GetEnv("SECRET_ENV_VARS", DefaultEnvVars), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return nil
+			}
+		} else if name == pattern {
+			return nil
+		}
+	}
+	return fmt.Errorf("environment variable %s is not in SECRET_ENV_VARS", name)
+}
+
+// checkFile makes sure path is below one of the allowed directories.
+func checkFile(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("secret file %s must be an absolute path", path)
+	}
+	path = filepath.Clean(path)
+	for _, dir := range strings.Split(config.GetEnv("SECRET_FILE_DIRS", DefaultFileDirs), ",") {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(filepath.Clean(dir), path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return nil
+		}
+	}
+	return fmt.Errorf("secret file %s is not in SECRET_FILE_DIRS", path)
+}
+
+func runCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// The output may hold part of the secret; only stderr is reported
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > 200 {
+			message = message[:200]
+		}
+		if message != "" {
+			return "", fmt.Errorf("secret command failed: %w: %s", err, message)
+		}
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SECRET_FILE_DIRS", dir)
+
+	tests := []struct {
+		name     string
+		ref      string
+		envVars  string
+		commands bool
+		wantErr  bool
+	}{
+		{name: "env with default prefix", ref: "env:DUMPER_SECRET_MYSQL"},
+		{name: "env outside default prefix", ref: "env:MYSQL_PASSWORD", wantErr: true},
+		{name: "env named", ref: "env:MYSQL_PASSWORD", envVars: "PG_PASSWORD, MYSQL_PASSWORD"},
+		{name: "env with prefix", ref: "env:DB_PASSWORD_SHOP", envVars: "DB_PASSWORD_*"},
+		{name: "env outside allowlist", ref: "env:HOME", envVars: "MYSQL_PASSWORD,DB_*", wantErr: true},
+		{name: "env prefix of a name", ref: "env:MYSQL_PASSWORD_OLD", envVars: "MYSQL_PASSWORD", wantErr: true},
+		{name: "protected env allowlisted", ref: "env:APP_ENC_KEY", envVars: "*", wantErr: true},
+		{name: "file in allowed dir", ref: "file:" + filepath.Join(dir, "mysql_password")},
+		{name: "command enabled", ref: "cmd:echo secret", commands: true},
+		{name: "command disabled", ref: "cmd:echo secret", wantErr: true},
+		{name: "protected env", ref: "env:APP_ENC_KEY", wantErr: true},
+		{name: "file outside allowed dirs", ref: "file:/etc/passwd", wantErr: true},
+		{name: "file escaping allowed dir", ref: "file:" + dir + "/../passwd", wantErr: true},
+		{name: "allowed dir itself", ref: "file:" + dir, wantErr: true},
+		{name: "relative file", ref: "file:secrets/mysql", wantErr: true},
+		{name: "unknown kind", ref: "vault:db/mysql", wantErr: true},
+		{name: "missing value", ref: "env:", wantErr: true},
+		{name: "no kind", ref: "MYSQL_PASSWORD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envVars != "" {
+				t.Setenv("SECRET_ENV_VARS", tt.envVars)
+			}
+			if tt.commands {
+				t.Setenv("SECRET_COMMANDS", "true")
+			}
+			_, err := ParseRef(tt.ref)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SECRET_FILE_DIRS", dir)
+	t.Setenv("SECRET_COMMANDS", "true")
+	t.Setenv("SECRET_ENV_VARS", "TEST_SECRET*")
+	t.Setenv("TEST_SECRET", "from env")
+	if err := os.WriteFile(filepath.Join(dir, "mysql"), []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{name: "env", ref: "env:TEST_SECRET", want: "from env"},
+		{name: "file", ref: "file:" + filepath.Join(dir, "mysql"), want: "from file"},
+		{name: "command", ref: "cmd:printf 'from command\\n'", want: "from command"},
+		{name: "unset env", ref: "env:TEST_SECRET_UNSET", wantErr: true},
+		{name: "missing file", ref: "file:" + filepath.Join(dir, "missing"), wantErr: true},
+		{name: "failing command", ref: "cmd:echo oops >&2; exit 3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(context.Background(), tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Destination types
+const (
+	DestinationSFTP   = "sftp"
+	DestinationWebDAV = "webdav"
+	DestinationS3     = "s3"
+)
+
+// DestinationConfig describes a storage that backups are copied to after
+// the dump, as saved with a job. Only the fields of Type are used.
+type DestinationConfig struct {
+	Type string `json:"type"`
+
+	// Name tells the copies in different destinations apart, defaults to Type
+	Name string `json:"name,omitempty"`
+
+	// RetentionDays is how long copies are kept in the destination, 0 uses
+	// the retention of the target
+	RetentionDays int `json:"retention_days,omitempty"`
+
+	// SFTP: Host, Port, User, Password and/or PrivateKey, HostKey, Path
+	Host                  string `json:"host,omitempty"`
+	Port                  int    `json:"port,omitempty"`
+	PrivateKey            string `json:"private_key,omitempty"`
+	HostKey               string `json:"host_key,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key,omitempty"`
+	Path                  string `json:"path,omitempty"`
+
+	// WebDAV: URL, User, Password
+	URL string `json:"url,omitempty"`
+
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// S3: Endpoint, Region, Bucket, Prefix, AccessKey, SecretKey, Insecure,
+	// PathStyle
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	Insecure  bool   `json:"insecure,omitempty"`
+	PathStyle bool   `json:"path_style,omitempty"`
+
+	// Retries is the number of further upload attempts after a failure,
+	// 0 means DefaultRetries
+	Retries int `json:"retries,omitempty"`
+
+	// SecretsEncrypted is set once Password, PrivateKey and SecretKey hold
+	// ciphertext, see MapSecrets
+	SecretsEncrypted bool `json:"secrets_encrypted,omitempty"`
+}
+
+// DefaultRetries is the number of retries of a failed upload.
+const DefaultRetries = 3
+
+// MapSecrets replaces every secret of c that is set by fn(secret), to
+// encrypt or decrypt them.
+func (c *DestinationConfig) MapSecrets(fn func(string) (string, error)) error {
+	for _, secret := range []*string{&c.Password, &c.PrivateKey, &c.SecretKey} {
+		if *secret == "" {
+			continue
+		}
+		value, err := fn(*secret)
+		if err != nil {
+			return err
+		}
+		*secret = value
+	}
+	return nil
+}
+
+// NewDestination returns the storage described by c.
+func NewDestination(c DestinationConfig) (Storage, error) {
+	switch c.Type {
+	case DestinationSFTP:
+		s, err := NewSFTP(SFTPConfig{
+			Host:                  c.Host,
+			Port:                  c.Port,
+			User:                  c.User,
+			Password:              c.Password,
+			PrivateKey:            c.PrivateKey,
+			HostKey:               c.HostKey,
+			InsecureIgnoreHostKey: c.InsecureIgnoreHostKey,
+			Path:                  c.Path,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case DestinationWebDAV:
+		s, err := NewWebDAV(WebDAVConfig{URL: c.URL, User: c.User, Password: c.Password})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case DestinationS3:
+		s, err := NewS3(S3Config{
+			Endpoint:  c.Endpoint,
+			Region:    c.Region,
+			Bucket:    c.Bucket,
+			Prefix:    c.Prefix,
+			AccessKey: c.AccessKey,
+			SecretKey: c.SecretKey,
+			Insecure:  c.Insecure,
+			PathStyle: c.PathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown destination type %q", c.Type)
+	}
+}
+
+// retryDelay is the wait before the first retry of an upload; it doubles
+// with every further attempt.
+var retryDelay = 5 * time.Second
+
+// Upload copies the local file at path to key of s and verifies the copy by
+// reading it back and comparing its SHA-256 with checksum. Failed attempts
+// are retried up to retries times.
+func Upload(ctx context.Context, s Storage, key, path, checksum string, retries int) error {
+	delay := retryDelay
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			delay *= 2
+		}
+
+		if err = uploadOnce(ctx, s, key, path, checksum); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("upload failed after %d attempts: %w", retries+1, err)
+}
+
+func uploadOnce(ctx context.Context, s Storage, key, path, checksum string) error {
+	if err := s.Put(ctx, key, path); err != nil {
+		return err
+	}
+
+	rc, err := s.Open(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %w", key, err)
+	}
+	defer rc.Close()
+
+	remote, err := readChecksum(rc)
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %w", key, err)
+	}
+	if remote != checksum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", key, checksum, remote)
+	}
+	return nil
+}
+
+// FileChecksum returns the hex SHA-256 of the file at path.
+func FileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	return readChecksum(file)
+}
+
+func readChecksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
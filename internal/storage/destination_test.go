@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyStorage fails the first failures calls to Put.
+type flakyStorage struct {
+	Storage
+	failures int
+	puts     int
+}
+
+func (f *flakyStorage) Put(ctx context.Context, key, path string) error {
+	f.puts++
+	if f.puts <= f.failures {
+		return errors.New("connection reset")
+	}
+	return f.Storage.Put(ctx, key, path)
+}
+
+func TestUpload(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	_, server := newFakeS3(t)
+	path := writeTempFile(t, "SELECT 1;")
+	checksum, err := FileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		checksum string
+		puts     int
+		errMsg   string
+	}{
+		{"first attempt", 0, 3, checksum, 1, ""},
+		{"after retries", 2, 3, checksum, 3, ""},
+		{"retries exhausted", 5, 2, checksum, 3, "upload failed after 3 attempts: connection reset"},
+		{"checksum mismatch", 0, 1, strings.Repeat("0", 64), 2, "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyStorage{Storage: newTestS3(t, server, 0), failures: tt.failures}
+			err := Upload(context.Background(), flaky, "dump.sql.gz", path, tt.checksum, tt.retries)
+			if tt.errMsg == "" && err != nil {
+				t.Errorf("Upload failed: %v", err)
+			}
+			if tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+			if flaky.puts != tt.puts {
+				t.Errorf("Expected %d uploads, got %d", tt.puts, flaky.puts)
+			}
+		})
+	}
+}
+
+func TestNewDestination(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DestinationConfig
+		uri     string
+		wantErr bool
+	}{
+		{
+			name:   "sftp",
+			config: DestinationConfig{Type: DestinationSFTP, Host: "backup.example.com", User: "dumper", Password: "secret", InsecureIgnoreHostKey: true, Path: "/srv/backups"},
+			uri:    "sftp://dumper@backup.example.com:22/srv/backups/a.sql.gz",
+		},
+		{
+			name:    "sftp without host key",
+			config:  DestinationConfig{Type: DestinationSFTP, Host: "backup.example.com", User: "dumper", Password: "secret"},
+			wantErr: true,
+		},
+		{
+			name:    "sftp without credentials",
+			config:  DestinationConfig{Type: DestinationSFTP, Host: "backup.example.com", User: "dumper", InsecureIgnoreHostKey: true},
+			wantErr: true,
+		},
+		{
+			name:   "webdav",
+			config: DestinationConfig{Type: DestinationWebDAV, URL: "https://cloud.example.com/dav/backups"},
+			uri:    "https://cloud.example.com/dav/backups/a.sql.gz",
+		},
+		{
+			name:    "webdav without scheme",
+			config:  DestinationConfig{Type: DestinationWebDAV, URL: "cloud.example.com/dav"},
+			wantErr: true,
+		},
+		{
+			name:   "s3",
+			config: DestinationConfig{Type: DestinationS3, Endpoint: "s3.example.com", Bucket: "dumps", AccessKey: "key", SecretKey: "secret"},
+			uri:    "s3://dumps/a.sql.gz",
+		},
+		{
+			name:    "unknown type",
+			config:  DestinationConfig{Type: "ftp"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := NewDestination(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewDestination failed: %v", err)
+			}
+			if uri := dest.URI("a.sql.gz"); uri != tt.uri {
+				t.Errorf("Expected URI %q, got %q", tt.uri, uri)
+			}
+		})
+	}
+}
+
+func TestDestinationMapSecrets(t *testing.T) {
+	cfg := DestinationConfig{Type: DestinationSFTP, User: "dumper", Password: "pw", PrivateKey: "key"}
+	err := cfg.MapSecrets(func(s string) (string, error) { return "enc:" + s, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Password != "enc:pw" || cfg.PrivateKey != "enc:key" {
+		t.Errorf("Expected secrets to be mapped, got %+v", cfg)
+	}
+	if cfg.SecretKey != "" || cfg.User != "dumper" {
+		t.Errorf("Expected empty secrets and other fields to stay, got %+v", cfg)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps backup files below a directory of the local file system.
+type Local struct {
+	dir  string
+	base string // URI of dir, with a trailing slash
+}
+
+// NewLocal returns a storage for the directory dir.
+func NewLocal(dir string) *Local {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	return &Local{dir: dir, base: "file://" + filepath.ToSlash(abs) + "/"}
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+func (l *Local) Put(ctx context.Context, key, path string) error {
+	dest := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Dumps are staged below the backup directory, so this is usually a
+	// rename in place
+	if err := os.Rename(path, dest); err == nil {
+		return nil
+	}
+	return copyFile(path, dest)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	return file, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete backup file: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) URI(key string) string {
+	return l.base + key
+}
+
+// copyFile copies src to dest through a temporary file, so dest is never
+// left half written.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPConfig configures a directory on an SFTP server.
+type SFTPConfig struct {
+	Host string
+	Port int // defaults to 22
+	User string
+
+	// Password and PrivateKey (PEM) authenticate the user; either or both
+	Password   string
+	PrivateKey string
+
+	// HostKey is the server's public key in authorized_keys format. Without
+	// it any host key is accepted, which only InsecureIgnoreHostKey allows.
+	HostKey               string
+	InsecureIgnoreHostKey bool
+
+	// Path is the directory backups are kept in
+	Path string
+}
+
+// SFTP keeps backup files on an SFTP server. Every operation opens its own
+// connection, uploads are written under a temporary name and renamed.
+type SFTP struct {
+	cfg          SFTPConfig
+	clientConfig *ssh.ClientConfig
+	base         string // URI of cfg.Path, with a trailing slash
+}
+
+// NewSFTP returns a storage for the directory described by cfg.
+func NewSFTP(cfg SFTPConfig) (*SFTP, error) {
+	if cfg.Host == "" || cfg.User == "" {
+		return nil, fmt.Errorf("sftp host and user are required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 22
+	}
+	if cfg.Path == "" {
+		cfg.Path = "."
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("sftp password or private key is required")
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	switch {
+	case cfg.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp host key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(key)
+	case !cfg.InsecureIgnoreHostKey:
+		return nil, fmt.Errorf("sftp host key is required")
+	}
+
+	base := fmt.Sprintf("sftp://%s@%s/", cfg.User, net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if dir := strings.Trim(path.Clean(cfg.Path), "/"); dir != "." && dir != "" {
+		base += dir + "/"
+	}
+
+	return &SFTP{
+		cfg:  cfg,
+		base: base,
+		clientConfig: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         30 * time.Second,
+		},
+	}, nil
+}
+
+func (s *SFTP) URI(key string) string {
+	return s.base + key
+}
+
+func (s *SFTP) remotePath(key string) string {
+	return path.Join(s.cfg.Path, key)
+}
+
+// sftpSession is an SFTP client together with the SSH connection it runs on.
+type sftpSession struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (s *sftpSession) Close() error {
+	s.Client.Close()
+	return s.conn.Close()
+}
+
+func (s *SFTP) connect(ctx context.Context) (*sftpSession, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := net.Dialer{Timeout: s.clientConfig.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, s.clientConfig)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	return &sftpSession{Client: client, conn: conn}, nil
+}
+
+func (s *SFTP) Put(ctx context.Context, key, localPath string) error {
+	in, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer in.Close()
+
+	session, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	dest := s.remotePath(key)
+	if err := session.MkdirAll(path.Dir(dest)); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", path.Dir(dest), err)
+	}
+
+	tmp := dest + ".partial"
+	out, err := session.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		session.Remove(tmp)
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	if err := out.Close(); err != nil {
+		session.Remove(tmp)
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+
+	// PosixRename replaces an existing file, Rename would fail
+	if err := session.PosixRename(tmp, dest); err != nil {
+		session.Remove(tmp)
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
+
+// sftpFile closes the session along with the file read from it.
+type sftpFile struct {
+	*sftp.File
+	session *sftpSession
+}
+
+func (f *sftpFile) Close() error {
+	f.File.Close()
+	return f.session.Close()
+}
+
+func (s *SFTP) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	session, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := session.Open(s.remotePath(key))
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	return &sftpFile{File: file, session: session}, nil
+}
+
+func (s *SFTP) Delete(ctx context.Context, key string) error {
+	session, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if err := session.Remove(s.remotePath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSFTPServer serves SFTP for user "dumper" with password "secret" on a
+// local port and returns the port and the host key in authorized_keys format.
+func startSFTPServer(t *testing.T) (int, string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "dumper" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config)
+		}
+	}()
+
+	hostKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	return listener.Addr().(*net.TCPAddr).Port, hostKey
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+func TestSFTPPutOpenDelete(t *testing.T) {
+	port, hostKey := startSFTPServer(t)
+	dir := t.TempDir()
+	s, err := NewSFTP(SFTPConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		User:     "dumper",
+		Password: "secret",
+		HostKey:  hostKey,
+		Path:     dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if uri := s.URI("2024/01/dump.sql"); uri != "sftp://dumper@127.0.0.1:"+strconv.Itoa(port)+filepath.ToSlash(dir)+"/2024/01/dump.sql" {
+		t.Errorf("Unexpected URI %q", uri)
+	}
+
+	if err := s.Put(ctx, "2024/01/dump.sql", writeTempFile(t, "SELECT 1;")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// Uploading again replaces the file
+	if err := s.Put(ctx, "2024/01/dump.sql", writeTempFile(t, "SELECT 2;")); err != nil {
+		t.Fatalf("Second Put failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2024", "01", "dump.sql.partial")); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file to be renamed, got %v", err)
+	}
+
+	rc, err := s.Open(ctx, "2024/01/dump.sql")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "SELECT 2;" {
+		t.Errorf("Expected uploaded content, got %q", data)
+	}
+
+	if err := s.Delete(ctx, "2024/01/dump.sql"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Delete(ctx, "2024/01/dump.sql"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+	if _, err := s.Open(ctx, "2024/01/dump.sql"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestSFTPHostKeyMismatch(t *testing.T) {
+	port, _ := startSFTPServer(t)
+	_, otherHostKey := startSFTPServer(t)
+
+	s, err := NewSFTP(SFTPConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		User:     "dumper",
+		Password: "secret",
+		HostKey:  otherHostKey,
+		Path:     t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(context.Background(), "dump.sql", writeTempFile(t, "SELECT 1;")); err == nil {
+		t.Error("Expected connection with an unknown host key to fail")
+	}
+}
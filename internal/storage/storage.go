@@ -0,0 +1,116 @@
+// Package storage keeps backup files in a local directory or an object store.
+// Backups refer to their file by a URI, see Storage.URI.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/casparjones/go-dumper/internal/config"
+)
+
+// Storage is a place backup files are kept in. Keys are slash-separated
+// paths such as "2024/01/shop_orders_2024-01-31_02-00-00.sql.gz".
+type Storage interface {
+	// Put stores the local file at path under key. The file may be moved
+	// rather than copied; callers remove it afterwards if it still exists.
+	Put(ctx context.Context, key, path string) error
+
+	// Open returns the content stored under key. A missing key is reported
+	// as an error wrapping fs.ErrNotExist.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URI returns the URI stored with a backup kept under key, e.g.
+	// "file:///data/backups/2024/01/..." or "s3://bucket/prefix/2024/01/...".
+	URI(key string) string
+}
+
+// FromEnv returns the storage selected by STORAGE_BACKEND: "local" (the
+// default) keeps backups in backupDir, "s3" in the bucket configured by the
+// S3_* variables.
+func FromEnv(backupDir string) (Storage, error) {
+	switch backend := config.GetEnv("STORAGE_BACKEND", "local"); backend {
+	case "local":
+		return NewLocal(backupDir), nil
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:  config.GetEnv("S3_ENDPOINT", ""),
+			Region:    config.GetEnv("S3_REGION", ""),
+			Bucket:    config.GetEnv("S3_BUCKET", ""),
+			Prefix:    config.GetEnv("S3_PREFIX", ""),
+			AccessKey: config.GetEnv("S3_ACCESS_KEY", ""),
+			SecretKey: config.GetEnv("S3_SECRET_KEY", ""),
+			Insecure:  config.GetEnv("S3_INSECURE", "false") == "true",
+			PathStyle: config.GetEnv("S3_PATH_STYLE", "false") == "true",
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// Resolver finds the storage of a backup file by its URI.
+type Resolver struct {
+	backends []Storage
+	files    *Local
+}
+
+// NewResolver returns a resolver for URIs of backends. File URIs and plain
+// paths, as stored by older versions, are always resolved.
+func NewResolver(backends ...Storage) *Resolver {
+	return &Resolver{backends: backends, files: &Local{}}
+}
+
+// Open returns the content of the backup file at uri.
+func (r *Resolver) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	s, key, err := r.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.Open(ctx, key)
+}
+
+// Delete removes the backup file at uri.
+func (r *Resolver) Delete(ctx context.Context, uri string) error {
+	s, key, err := r.resolve(uri)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, key)
+}
+
+func (r *Resolver) resolve(uri string) (Storage, string, error) {
+	for _, s := range r.backends {
+		if prefix := s.URI(""); strings.HasPrefix(uri, prefix) {
+			return s, strings.TrimPrefix(uri, prefix), nil
+		}
+	}
+	if path, ok := FilePath(uri); ok {
+		return r.files, path, nil
+	}
+	return nil, "", fmt.Errorf("no storage configured for %s", uri)
+}
+
+// FilePath returns the local path of a file URI or plain path.
+func FilePath(uri string) (string, bool) {
+	if path, ok := strings.CutPrefix(uri, "file://"); ok {
+		return path, true
+	}
+	if strings.Contains(uri, "://") {
+		return "", false
+	}
+	return uri, true
+}
+
+// Base returns the file name of uri.
+func Base(uri string) string {
+	return uri[strings.LastIndex(uri, "/")+1:]
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPutOpenDelete(t *testing.T) {
+	dir := t.TempDir()
+	local := NewLocal(dir)
+	ctx := context.Background()
+
+	if err := local.Put(ctx, "2024/01/dump.sql", writeTempFile(t, "SELECT 1;")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2024", "01", "dump.sql")); err != nil {
+		t.Errorf("Expected file below the storage directory: %v", err)
+	}
+	if uri := local.URI("2024/01/dump.sql"); uri != "file://"+filepath.ToSlash(dir)+"/2024/01/dump.sql" {
+		t.Errorf("Unexpected URI %q", uri)
+	}
+
+	if err := local.Delete(ctx, "2024/01/dump.sql"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := local.Delete(ctx, "2024/01/dump.sql"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+	if _, err := local.Open(ctx, "2024/01/dump.sql"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	fake, server := newFakeS3(t)
+	s3 := newTestS3(t, server, 0)
+	local := NewLocal(t.TempDir())
+	resolver := NewResolver(local, s3)
+	ctx := context.Background()
+
+	if err := s3.Put(ctx, "a.sql", writeTempFile(t, "remote")); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Put(ctx, "b.sql", writeTempFile(t, "local")); err != nil {
+		t.Fatal(err)
+	}
+	legacy := writeTempFile(t, "legacy")
+
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{s3.URI("a.sql"), "remote"},
+		{local.URI("b.sql"), "local"},
+		{legacy, "legacy"},
+		{"file://" + legacy, "legacy"},
+	}
+	for _, tt := range tests {
+		rc, err := resolver.Open(ctx, tt.uri)
+		if err != nil {
+			t.Errorf("Open(%q) failed: %v", tt.uri, err)
+			continue
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != tt.expected {
+			t.Errorf("Open(%q) = %q, expected %q", tt.uri, data, tt.expected)
+		}
+	}
+
+	if err := resolver.Delete(ctx, s3.URI("a.sql")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if keys := fake.keys(); len(keys) != 0 {
+		t.Errorf("Expected object to be deleted, got %v", keys)
+	}
+
+	if _, err := resolver.Open(ctx, "s3://other-bucket/a.sql"); err == nil {
+		t.Error("Expected error for a bucket that is not configured")
+	}
+}
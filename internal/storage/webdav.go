@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAVConfig configures a collection on a WebDAV server such as Nextcloud,
+// e.g. "https://cloud.example.com/remote.php/dav/files/alice/backups".
+type WebDAVConfig struct {
+	URL      string
+	User     string
+	Password string
+}
+
+// WebDAV keeps backup files in a collection of a WebDAV server.
+type WebDAV struct {
+	cfg    WebDAVConfig
+	client *http.Client
+}
+
+// NewWebDAV returns a storage for the collection described by cfg.
+func NewWebDAV(cfg WebDAVConfig) (*WebDAV, error) {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("webdav url must start with http:// or https://")
+	}
+	if !strings.HasSuffix(cfg.URL, "/") {
+		cfg.URL += "/"
+	}
+	// No overall timeout: uploads of large dumps take as long as they take
+	return &WebDAV{cfg: cfg, client: &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 5 * time.Minute,
+	}}}, nil
+}
+
+func (w *WebDAV) URI(key string) string {
+	return w.cfg.URL + key
+}
+
+func (w *WebDAV) Put(ctx context.Context, key, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file stats: %w", err)
+	}
+
+	if err := w.mkcolAll(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+
+	resp, err := w.do(ctx, http.MethodPut, key, file, stat.Size())
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// mkcolAll creates the collection dir and its parents below the base URL.
+func (w *WebDAV) mkcolAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	var current string
+	for _, part := range strings.Split(dir, "/") {
+		current = path.Join(current, part)
+		resp, err := w.do(ctx, "MKCOL", current+"/", nil, 0)
+		var httpErr *WebDAVError
+		// 405 Method Not Allowed: the collection exists already
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusMethodNotAllowed {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create collection %s: %w", current, err)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (w *WebDAV) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := w.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return resp.Body, nil
+}
+
+func (w *WebDAV) Delete(ctx context.Context, key string) error {
+	resp, err := w.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// WebDAVError is an unsuccessful response of the server.
+type WebDAVError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *WebDAVError) Error() string {
+	return "webdav request failed: " + e.Status
+}
+
+// Is makes missing files match fs.ErrNotExist.
+func (e *WebDAVError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+func (w *WebDAV) do(ctx context.Context, method, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.cfg.URL+uriEncode(key, false), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if w.cfg.User != "" {
+		req.SetBasicAuth(w.cfg.User, w.cfg.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, &WebDAVError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
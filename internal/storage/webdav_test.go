@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func newTestWebDAV(t *testing.T) *WebDAV {
+	dav := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	w, err := NewWebDAV(WebDAVConfig{URL: server.URL + "/", User: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWebDAVPutOpenDelete(t *testing.T) {
+	w := newTestWebDAV(t)
+	ctx := context.Background()
+
+	if err := w.Put(ctx, "2024/01/dump one.sql", writeTempFile(t, "SELECT 1;")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// The collections exist now, a second upload must not fail on MKCOL
+	if err := w.Put(ctx, "2024/01/dump two.sql", writeTempFile(t, "SELECT 2;")); err != nil {
+		t.Fatalf("Put into existing collection failed: %v", err)
+	}
+
+	rc, err := w.Open(ctx, "2024/01/dump one.sql")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "SELECT 1;" {
+		t.Errorf("Expected uploaded content, got %q", data)
+	}
+
+	if err := w.Delete(ctx, "2024/01/dump one.sql"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := w.Delete(ctx, "2024/01/dump one.sql"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+	if _, err := w.Open(ctx, "2024/01/dump one.sql"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestWebDAVUnauthorized(t *testing.T) {
+	w := newTestWebDAV(t)
+	w.cfg.Password = "wrong"
+
+	err := w.Put(context.Background(), "dump.sql", writeTempFile(t, "SELECT 1;"))
+	var davErr *WebDAVError
+	if !errors.As(err, &davErr) || davErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 WebDAVError, got %v", err)
+	}
+}
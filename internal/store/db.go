@@ -16,13 +16,37 @@ CREATE TABLE IF NOT EXISTS targets (
 	host TEXT NOT NULL,
 	port INTEGER NOT NULL DEFAULT 3306,
 	user TEXT NOT NULL,
+	engine TEXT NOT NULL DEFAULT 'mysql',
+	path TEXT DEFAULT '',
+	connection_type TEXT NOT NULL DEFAULT 'tcp',
+	socket TEXT DEFAULT '',
+	dsn_params TEXT DEFAULT '',
 	password_enc TEXT NOT NULL,
+	password_ref TEXT DEFAULT '',
 	comment TEXT DEFAULT '',
 	schedule_time TEXT DEFAULT '',
 	retention_days INTEGER DEFAULT 30,
 	auto_compress BOOLEAN DEFAULT 1,
 	database_mode TEXT NOT NULL DEFAULT 'all',
 	selected_databases TEXT DEFAULT '',
+	include_routines BOOLEAN DEFAULT 0,
+	include_triggers BOOLEAN DEFAULT 0,
+	include_events BOOLEAN DEFAULT 0,
+	parallelism INTEGER DEFAULT 1,
+	chunk_size INTEGER DEFAULT 0,
+	include_tables TEXT DEFAULT '',
+	exclude_tables TEXT DEFAULT '',
+	schema_only_tables TEXT DEFAULT '',
+	tls_mode TEXT DEFAULT '',
+	tls_ca TEXT DEFAULT '',
+	tls_cert TEXT DEFAULT '',
+	tls_key_enc TEXT DEFAULT '',
+	ssh_host TEXT DEFAULT '',
+	ssh_port INTEGER DEFAULT 0,
+	ssh_user TEXT DEFAULT '',
+	ssh_password_enc TEXT DEFAULT '',
+	ssh_key_enc TEXT DEFAULT '',
+	ssh_host_key TEXT DEFAULT '',
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -31,15 +55,34 @@ CREATE TABLE IF NOT EXISTS backups (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	target_id INTEGER NOT NULL,
 	database_name TEXT NOT NULL DEFAULT '',
+	kind TEXT NOT NULL DEFAULT 'full',
 	started_at DATETIME NOT NULL,
 	finished_at DATETIME,
 	size_bytes INTEGER DEFAULT 0,
 	status TEXT NOT NULL DEFAULT 'running',
 	file_path TEXT DEFAULT '',
 	notes TEXT DEFAULT '',
+	metadata TEXT DEFAULT '',
+	checksum TEXT DEFAULT '',
 	FOREIGN KEY (target_id) REFERENCES targets(id) ON DELETE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS backup_copies (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	backup_id INTEGER NOT NULL,
+	destination TEXT NOT NULL,
+	uri TEXT NOT NULL,
+	config TEXT DEFAULT '',
+	retention_days INTEGER DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'uploading',
+	notes TEXT DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (backup_id) REFERENCES backups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_copies_backup_id ON backup_copies(backup_id);
+
 CREATE TRIGGER IF NOT EXISTS update_targets_timestamp 
 AFTER UPDATE ON targets
 FOR EACH ROW
@@ -72,6 +115,19 @@ BEGIN
 	UPDATE schedule_jobs SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
 END;
 
+CREATE TABLE IF NOT EXISTS job_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	job_id INTEGER NOT NULL,
+	started_at DATETIME NOT NULL,
+	finished_at DATETIME,
+	status TEXT NOT NULL DEFAULT 'running',
+	backup_ids TEXT DEFAULT '',
+	error TEXT DEFAULT '',
+	FOREIGN KEY (job_id) REFERENCES schedule_jobs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_id ON job_runs(job_id);
+
 CREATE TABLE IF NOT EXISTS app_config (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	key TEXT NOT NULL UNIQUE,
@@ -86,6 +142,15 @@ FOR EACH ROW
 BEGIN
 	UPDATE app_config SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
 END;
+
+CREATE TABLE IF NOT EXISTS sanitize_profiles (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT DEFAULT '',
+	rules TEXT NOT NULL DEFAULT '{}',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
 `
 
 func InitDB(dbPath string) (*sql.DB, error) {
@@ -206,5 +271,101 @@ func runMigrations(db *sql.DB) error {
 		fmt.Println("Added database_name column to backups table.")
 	}
 
+	// Columns added after the initial release; created with their defaults
+	if err := addMissingColumns(db, "targets", []columnDef{
+		{"include_routines", "BOOLEAN DEFAULT 0"},
+		{"include_triggers", "BOOLEAN DEFAULT 0"},
+		{"include_events", "BOOLEAN DEFAULT 0"},
+		{"parallelism", "INTEGER DEFAULT 1"},
+		{"chunk_size", "INTEGER DEFAULT 0"},
+		{"include_tables", "TEXT DEFAULT ''"},
+		{"exclude_tables", "TEXT DEFAULT ''"},
+		{"schema_only_tables", "TEXT DEFAULT ''"},
+		{"password_ref", "TEXT DEFAULT ''"},
+		{"tls_mode", "TEXT DEFAULT ''"},
+		{"tls_ca", "TEXT DEFAULT ''"},
+		{"tls_cert", "TEXT DEFAULT ''"},
+		{"tls_key_enc", "TEXT DEFAULT ''"},
+		{"ssh_host", "TEXT DEFAULT ''"},
+		{"ssh_port", "INTEGER DEFAULT 0"},
+		{"ssh_user", "TEXT DEFAULT ''"},
+		{"ssh_password_enc", "TEXT DEFAULT ''"},
+		{"ssh_key_enc", "TEXT DEFAULT ''"},
+		{"ssh_host_key", "TEXT DEFAULT ''"},
+		{"connection_type", "TEXT NOT NULL DEFAULT 'tcp'"},
+		{"socket", "TEXT DEFAULT ''"},
+		{"dsn_params", "TEXT DEFAULT ''"},
+		{"engine", "TEXT NOT NULL DEFAULT 'mysql'"},
+		{"path", "TEXT DEFAULT ''"},
+	}); err != nil {
+		return err
+	}
+
+	if err := addMissingColumns(db, "backups", []columnDef{
+		{"kind", "TEXT NOT NULL DEFAULT 'full'"},
+		{"metadata", "TEXT DEFAULT ''"},
+		{"checksum", "TEXT DEFAULT ''"},
+	}); err != nil {
+		return err
+	}
+
+	// Backups from before backup_copies get their file as the primary copy
+	if _, err := db.Exec(`
+		INSERT INTO backup_copies (backup_id, destination, uri, status, created_at, updated_at)
+		SELECT id, ?, file_path, ?, started_at, started_at FROM backups
+		WHERE file_path != '' AND NOT EXISTS (SELECT 1 FROM backup_copies WHERE backup_id = backups.id)
+	`, CopyDestinationPrimary, CopyStatusSuccess); err != nil {
+		return fmt.Errorf("failed to create primary backup copies: %w", err)
+	}
+
 	return nil
 }
+
+type columnDef struct {
+	name       string
+	definition string
+}
+
+// addMissingColumns adds every column in columns that table does not have yet.
+func addMissingColumns(db *sql.DB, table string, columns []columnDef) error {
+	existing, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range columns {
+		if existing[col.name] {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.definition)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add %s column to %s: %w", col.name, table, err)
+		}
+	}
+
+	return nil
+}
+
+// tableColumns returns the set of column names of table.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s table info: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid int
+		var name, dataType string
+		var notNull, pk int
+		var defaultValue interface{}
+
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan %s column info: %w", table, err)
+		}
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
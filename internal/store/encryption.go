@@ -4,41 +4,77 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 )
 
+// Ciphertexts are "v1:<key id>:<base64 of nonce and sealed data>". Older
+// ones are the bare base64 and are tried with every key.
+const ciphertextVersion = "v1"
+
+// encryptionKey is an AES-GCM key with the ID written into its ciphertexts.
+type encryptionKey struct {
+	id  string
+	gcm cipher.AEAD
+}
+
+// keyring holds the current key, which encrypts, and previous keys, which
+// only decrypt.
+type keyring struct {
+	current  *encryptionKey
+	previous []*encryptionKey
+}
+
 var (
-	gcm           cipher.AEAD
+	keys          *keyring
 	cipherOnce    sync.Once
 	cipherInitErr error
 )
 
 func ensureCipher() error {
 	cipherOnce.Do(func() {
-		key, err := getEncryptionKey()
-		if err != nil {
-			cipherInitErr = err
-			return
-		}
+		keys, cipherInitErr = loadKeyring()
+	})
+	return cipherInitErr
+}
+
+// loadKeyring reads the current key from APP_ENC_KEY and previous keys from
+// the comma separated APP_ENC_KEY_PREVIOUS.
+func loadKeyring() (*keyring, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	current, err := newEncryptionKey(key)
+	if err != nil {
+		return nil, err
+	}
 
-		block, err := aes.NewCipher(key)
+	ring := &keyring{current: current}
+	for _, keyBase64 := range strings.Split(os.Getenv("APP_ENC_KEY_PREVIOUS"), ",") {
+		keyBase64 = strings.TrimSpace(keyBase64)
+		if keyBase64 == "" {
+			continue
+		}
+		key, err := decodeKey("APP_ENC_KEY_PREVIOUS", keyBase64)
 		if err != nil {
-			cipherInitErr = fmt.Errorf("failed to create cipher: %w", err)
-			return
+			return nil, err
 		}
-
-		g, err := cipher.NewGCM(block)
+		previous, err := newEncryptionKey(key)
 		if err != nil {
-			cipherInitErr = fmt.Errorf("failed to create GCM: %w", err)
-			return
+			return nil, err
 		}
-		gcm = g
-	})
-	return cipherInitErr
+		if previous.id != current.id {
+			ring.previous = append(ring.previous, previous)
+		}
+	}
+	return ring, nil
 }
 
 func getEncryptionKey() ([]byte, error) {
@@ -46,31 +82,95 @@ func getEncryptionKey() ([]byte, error) {
 	if keyBase64 == "" {
 		return nil, fmt.Errorf("APP_ENC_KEY environment variable is required (32-byte base64 key)")
 	}
+	return decodeKey("APP_ENC_KEY", keyBase64)
+}
 
+func decodeKey(name, keyBase64 string) ([]byte, error) {
 	key, err := base64.StdEncoding.DecodeString(keyBase64)
 	if err != nil {
-		return nil, fmt.Errorf("invalid APP_ENC_KEY format: %w", err)
+		return nil, fmt.Errorf("invalid %s format: %w", name, err)
 	}
 
 	if len(key) != 32 {
-		return nil, fmt.Errorf("APP_ENC_KEY must be 32 bytes when decoded")
+		return nil, fmt.Errorf("%s must be 32 bytes when decoded", name)
 	}
 
 	return key, nil
 }
 
+func newEncryptionKey(key []byte) (*encryptionKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	g, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	// The ID identifies the key without revealing it
+	sum := sha256.Sum256(key)
+	return &encryptionKey{id: hex.EncodeToString(sum[:4]), gcm: g}, nil
+}
+
+// find returns the key with id.
+func (k *keyring) find(id string) *encryptionKey {
+	if k.current.id == id {
+		return k.current
+	}
+	for _, key := range k.previous {
+		if key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// CurrentKeyID returns the ID of the key passwords are encrypted with.
+func CurrentKeyID() (string, error) {
+	if err := ensureCipher(); err != nil {
+		return "", err
+	}
+	return keys.current.id, nil
+}
+
+// PreviousKeyIDs returns the IDs of the keys that only decrypt.
+func PreviousKeyIDs() ([]string, error) {
+	if err := ensureCipher(); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(keys.previous))
+	for _, key := range keys.previous {
+		ids = append(ids, key.id)
+	}
+	return ids, nil
+}
+
+// KeyID returns the ID of the key encrypted was encrypted with, "" for
+// ciphertexts from before key IDs.
+func KeyID(encrypted string) string {
+	version, rest, ok := strings.Cut(encrypted, ":")
+	if !ok || version != ciphertextVersion {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, ":")
+	return id
+}
+
 func EncryptPassword(password string) (string, error) {
 	if err := ensureCipher(); err != nil {
 		return "", err
 	}
 
+	gcm := keys.current.gcm
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
 	ciphertext := gcm.Seal(nonce, nonce, []byte(password), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return ciphertextVersion + ":" + keys.current.id + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
 func DecryptPassword(encrypted string) (string, error) {
@@ -78,23 +178,54 @@ func DecryptPassword(encrypted string) (string, error) {
 		return "", err
 	}
 
+	candidates := append([]*encryptionKey{keys.current}, keys.previous...)
+	if id := KeyID(encrypted); id != "" {
+		key := keys.find(id)
+		if key == nil {
+			return "", fmt.Errorf("failed to decrypt password: unknown encryption key %s", id)
+		}
+		candidates = []*encryptionKey{key}
+		encrypted = strings.TrimPrefix(encrypted, ciphertextVersion+":"+id+":")
+	}
+
 	data, err := base64.StdEncoding.DecodeString(encrypted)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode encrypted password: %w", err)
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("encrypted data too short")
+	for _, key := range candidates {
+		nonceSize := key.gcm.NonceSize()
+		if len(data) < nonceSize {
+			return "", fmt.Errorf("encrypted data too short")
+		}
+
+		nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+		plaintext, openErr := key.gcm.Open(nil, nonce, ciphertext, nil)
+		if openErr == nil {
+			return string(plaintext), nil
+		}
+		err = openErr
 	}
 
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt password: %w", err)
+	return "", fmt.Errorf("failed to decrypt password: %w", err)
+}
+
+// ReencryptPassword decrypts encrypted with whichever key it was encrypted
+// with and encrypts it again with the current key. Ciphertexts of the
+// current key are returned as they are.
+func ReencryptPassword(encrypted string) (string, error) {
+	if err := ensureCipher(); err != nil {
+		return "", err
+	}
+	if KeyID(encrypted) == keys.current.id {
+		return encrypted, nil
 	}
 
-	return string(plaintext), nil
+	password, err := DecryptPassword(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return EncryptPassword(password)
 }
 
 func GenerateEncryptionKey() string {
@@ -1,8 +1,7 @@
 package store
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"encoding/base64"
 	"os"
 	"testing"
 )
@@ -161,20 +160,80 @@ func TestGenerateEncryptionKey(t *testing.T) {
 	}
 }
 
-// Helper function to reinitialize encryption for testing
-func initEncryption() {
-	key, err := getEncryptionKey()
+func TestKeyRotation(t *testing.T) {
+	oldKey := "utnQ1VVldc0sA94bFDn3foBgyv5U3gVJsgLcoZB3Bj4="
+	newKey := GenerateEncryptionKey()
+	defer os.Unsetenv("APP_ENC_KEY")
+	defer os.Unsetenv("APP_ENC_KEY_PREVIOUS")
+
+	os.Setenv("APP_ENC_KEY", oldKey)
+	initEncryption()
+	oldID := keys.current.id
+	encrypted, err := EncryptPassword("secret")
 	if err != nil {
-		panic(err)
+		t.Fatalf("EncryptPassword failed: %v", err)
 	}
-	// Reinitialize the global gcm variable
-	// This is a bit hacky but necessary for testing
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		panic(err)
+	if KeyID(encrypted) != oldID {
+		t.Fatalf("Expected key ID %s in %q", oldID, encrypted)
+	}
+
+	// Ciphertexts from before key IDs
+	nonce := make([]byte, keys.current.gcm.NonceSize())
+	legacy := base64.StdEncoding.EncodeToString(keys.current.gcm.Seal(nonce, nonce, []byte("legacy"), nil))
+
+	os.Setenv("APP_ENC_KEY", newKey)
+	initEncryption()
+	if _, err := DecryptPassword(encrypted); err == nil {
+		t.Error("Expected error for a ciphertext of an unknown key")
+	}
+
+	os.Setenv("APP_ENC_KEY_PREVIOUS", " , "+oldKey)
+	initEncryption()
+	previous, err := PreviousKeyIDs()
+	if err != nil || len(previous) != 1 || previous[0] != oldID {
+		t.Fatalf("Expected previous key IDs [%s], got %v (%v)", oldID, previous, err)
+	}
+
+	tests := []struct {
+		name      string
+		encrypted string
+		want      string
+	}{
+		{name: "previous key", encrypted: encrypted, want: "secret"},
+		{name: "legacy format", encrypted: legacy, want: "legacy"},
 	}
-	gcm, err = cipher.NewGCM(block)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decrypted, err := DecryptPassword(tt.encrypted)
+			if err != nil {
+				t.Fatalf("DecryptPassword failed: %v", err)
+			}
+			if decrypted != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, decrypted)
+			}
+
+			reencrypted, err := ReencryptPassword(tt.encrypted)
+			if err != nil {
+				t.Fatalf("ReencryptPassword failed: %v", err)
+			}
+			if KeyID(reencrypted) != keys.current.id {
+				t.Errorf("Expected key ID %s after re-encryption, got %q", keys.current.id, reencrypted)
+			}
+			again, err := ReencryptPassword(reencrypted)
+			if err != nil || again != reencrypted {
+				t.Errorf("Expected current ciphertext to be kept, got %q (%v)", again, err)
+			}
+		})
+	}
+}
+
+// Helper function to reinitialize encryption for testing
+func initEncryption() {
+	ring, err := loadKeyring()
 	if err != nil {
 		panic(err)
 	}
+	// Keep ensureCipher from loading the keys again
+	cipherOnce.Do(func() {})
+	keys = ring
 }
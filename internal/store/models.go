@@ -10,13 +10,37 @@ type Target struct {
 	Host              string    `json:"host" db:"host"`
 	Port              int       `json:"port" db:"port"`
 	User              string    `json:"user" db:"user"`
+	Engine            string    `json:"engine" db:"engine"`                   // EngineMySQL, EnginePostgres or EngineSQLite
+	Path              string    `json:"path" db:"path"`                       // database file of SQLite targets
+	ConnectionType    string    `json:"connection_type" db:"connection_type"` // "tcp" or "unix"
+	Socket            string    `json:"socket" db:"socket"`                   // path of the unix socket
+	DSNParams         string    `json:"dsn_params" db:"dsn_params"`           // JSON object of extra driver parameters
 	PasswordEnc       string    `json:"-" db:"password_enc"`
+	PasswordRef       string    `json:"password_ref" db:"password_ref"` // secret reference used instead of PasswordEnc, see package secrets
 	Comment           string    `json:"comment" db:"comment"`
 	ScheduleTime      string    `json:"schedule_time" db:"schedule_time"`
 	RetentionDays     int       `json:"retention_days" db:"retention_days"`
 	AutoCompress      bool      `json:"auto_compress" db:"auto_compress"`
 	DatabaseMode      string    `json:"database_mode" db:"database_mode"` // "all" or "selected"
 	SelectedDatabases string    `json:"selected_databases" db:"selected_databases"` // JSON array when mode="selected"
+	IncludeRoutines   bool      `json:"include_routines" db:"include_routines"`
+	IncludeTriggers   bool      `json:"include_triggers" db:"include_triggers"`
+	IncludeEvents     bool      `json:"include_events" db:"include_events"`
+	Parallelism       int       `json:"parallelism" db:"parallelism"` // number of tables dumped at once
+	ChunkSize         int       `json:"chunk_size" db:"chunk_size"`   // rows per primary key range, 0 reads tables whole
+	IncludeTables     string    `json:"include_tables" db:"include_tables"`         // JSON array of table glob patterns
+	ExcludeTables     string    `json:"exclude_tables" db:"exclude_tables"`         // JSON array of table glob patterns
+	SchemaOnlyTables  string    `json:"schema_only_tables" db:"schema_only_tables"` // JSON array of table glob patterns
+	TLSMode           string    `json:"tls_mode" db:"tls_mode"`                     // see dbconn.TLS
+	TLSCA             string    `json:"tls_ca" db:"tls_ca"`                         // PEM
+	TLSCert           string    `json:"tls_cert" db:"tls_cert"`                     // PEM
+	TLSKeyEnc         string    `json:"-" db:"tls_key_enc"`
+	SSHHost           string    `json:"ssh_host" db:"ssh_host"` // bastion host, empty to connect directly
+	SSHPort           int       `json:"ssh_port" db:"ssh_port"`
+	SSHUser           string    `json:"ssh_user" db:"ssh_user"`
+	SSHPasswordEnc    string    `json:"-" db:"ssh_password_enc"`
+	SSHKeyEnc         string    `json:"-" db:"ssh_key_enc"`
+	SSHHostKey        string    `json:"ssh_host_key" db:"ssh_host_key"` // authorized_keys format
 	CreatedAt         time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -25,25 +49,80 @@ type Backup struct {
 	ID           int64      `json:"id" db:"id"`
 	TargetID     int64      `json:"target_id" db:"target_id"`
 	DatabaseName string     `json:"database_name" db:"database_name"`
+	Kind         string     `json:"kind" db:"kind"` // "full", "structure" or "data"
 	StartedAt    time.Time  `json:"started_at" db:"started_at"`
 	FinishedAt   *time.Time `json:"finished_at" db:"finished_at"`
 	SizeBytes    int64      `json:"size_bytes" db:"size_bytes"`
 	Status       string     `json:"status" db:"status"`
 	FilePath     string     `json:"file_path" db:"file_path"`
 	Notes        string     `json:"notes" db:"notes"`
+	Metadata     string     `json:"metadata" db:"metadata"` // JSON describing the dump content
+	Checksum     string     `json:"checksum" db:"checksum"` // hex SHA-256 of the file
+
+	// Copies are the stored copies of the file, loaded along with the backup
+	Copies []*BackupCopy `json:"copies" db:"-"`
 }
 
 const (
+	BackupStatusQueued  = "queued" // waiting for its turn in the backup queue
 	BackupStatusRunning = "running"
 	BackupStatusSuccess = "success"
 	BackupStatusFailed  = "failed"
 )
 
+// BackupCopy is one stored copy of a backup file: the primary copy in the
+// configured storage or a replica in one of the job's destinations. Each copy
+// is removed by retention on its own; the backup goes with its last copy.
+type BackupCopy struct {
+	ID            int64     `json:"id" db:"id"`
+	BackupID      int64     `json:"backup_id" db:"backup_id"`
+	Destination   string    `json:"destination" db:"destination"` // CopyDestinationPrimary or the destination name
+	URI           string    `json:"uri" db:"uri"`
+	Config        string    `json:"-" db:"config"`                      // JSON of the destination with encrypted secrets, empty for the primary copy
+	RetentionDays int       `json:"retention_days" db:"retention_days"` // 0 uses the target's retention
+	Status        string    `json:"status" db:"status"`
+	Notes         string    `json:"notes" db:"notes"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CopyDestinationPrimary names the copy in the configured storage, the one
+// Backup.FilePath points to.
+const CopyDestinationPrimary = "primary"
+
+// Copy statuses
+const (
+	CopyStatusUploading = "uploading"
+	CopyStatusSuccess   = "success"
+	CopyStatusFailed    = "failed"
+)
+
+// Backup kinds: what a dump file contains
+const (
+	BackupKindFull      = "full"      // table structure and data
+	BackupKindStructure = "structure" // DDL only
+	BackupKindData      = "data"      // INSERT statements only
+)
+
 const (
 	DatabaseModeAll      = "all"
 	DatabaseModeSelected = "selected"
 )
 
+// Engines of targets: the kind of database server, or SQLite for targets
+// that are a database file
+const (
+	EngineMySQL    = "mysql" // MySQL and MariaDB
+	EnginePostgres = "postgres"
+	EngineSQLite   = "sqlite"
+)
+
+// Connection types of targets
+const (
+	ConnectionTCP  = "tcp"  // Host and Port
+	ConnectionUnix = "unix" // the socket at Socket
+)
+
 type DatabaseInfo struct {
 	Name string `json:"name"`
 }
@@ -56,7 +135,7 @@ type ScheduleJob struct {
 	IsActive        bool       `json:"is_active" db:"is_active"`
 	ScheduleConfig  string     `json:"schedule_config" db:"schedule_config"`   // JSON with frequency, minutes, hours, etc.
 	BackupOptions   string     `json:"backup_options" db:"backup_options"`     // JSON with compress, databases, etc.
-	MetaConfig      string     `json:"meta_config" db:"meta_config"`           // JSON for future extensions (minio, nextcloud, etc.)
+	MetaConfig      string     `json:"meta_config" db:"meta_config"`           // JSON with the replica destinations, see backup.JobMetaConfig
 	LastRunAt       *time.Time `json:"last_run_at" db:"last_run_at"`
 	LastRunStatus   string     `json:"last_run_status" db:"last_run_status"`
 	LastRunNotes    string     `json:"last_run_notes" db:"last_run_notes"`
@@ -70,8 +149,20 @@ const (
 	JobStatusRunning = "running"
 	JobStatusSuccess = "success"
 	JobStatusFailed  = "failed"
+	JobStatusSkipped = "skipped" // the target was busy (see backup.LockPolicySkip), or the run was missed and the misfire policy skips it
 )
 
+// JobRun is one execution of a schedule job.
+type JobRun struct {
+	ID         int64      `json:"id" db:"id"`
+	JobID      int64      `json:"job_id" db:"job_id"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at" db:"finished_at"`
+	Status     string     `json:"status" db:"status"`         // JobStatus* constant
+	BackupIDs  []int64    `json:"backup_ids" db:"backup_ids"` // the backups the run produced
+	Error      string     `json:"error" db:"error"`
+}
+
 type AppConfig struct {
 	ID        int64     `json:"id" db:"id"`
 	Key       string    `json:"key" db:"key"`
@@ -82,4 +173,15 @@ type AppConfig struct {
 
 const (
 	ConfigKeyTheme = "theme"
-)
\ No newline at end of file
+)
+
+// SanitizeProfile is a saved set of row filters and column masks that jobs
+// can apply to their dumps.
+type SanitizeProfile struct {
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Rules       string    `json:"rules" db:"rules"` // JSON, see backup.SanitizeRules
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
\ No newline at end of file
@@ -3,6 +3,8 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,20 +16,62 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// targetColumns lists the targets columns in the order scanTarget reads them.
+const targetColumns = `id, name, host, port, user, password_enc, password_ref, comment,
+		       schedule_time, retention_days, auto_compress, database_mode,
+		       selected_databases, include_routines, include_triggers, include_events,
+		       parallelism, chunk_size, include_tables, exclude_tables, schema_only_tables,
+		       tls_mode, tls_ca, tls_cert, tls_key_enc, ssh_host, ssh_port, ssh_user,
+		       ssh_password_enc, ssh_key_enc, ssh_host_key, connection_type, socket, dsn_params,
+		       engine, path, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTarget(row rowScanner) (*Target, error) {
+	target := &Target{}
+	err := row.Scan(&target.ID, &target.Name, &target.Host, &target.Port,
+		&target.User, &target.PasswordEnc, &target.PasswordRef, &target.Comment,
+		&target.ScheduleTime, &target.RetentionDays, &target.AutoCompress,
+		&target.DatabaseMode, &target.SelectedDatabases,
+		&target.IncludeRoutines, &target.IncludeTriggers, &target.IncludeEvents,
+		&target.Parallelism, &target.ChunkSize,
+		&target.IncludeTables, &target.ExcludeTables, &target.SchemaOnlyTables,
+		&target.TLSMode, &target.TLSCA, &target.TLSCert, &target.TLSKeyEnc,
+		&target.SSHHost, &target.SSHPort, &target.SSHUser, &target.SSHPasswordEnc, &target.SSHKeyEnc, &target.SSHHostKey,
+		&target.ConnectionType, &target.Socket, &target.DSNParams, &target.Engine,
+		&target.Path, &target.CreatedAt, &target.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
 func (r *Repository) CreateTarget(target *Target) error {
 	query := `
-		INSERT INTO targets (name, host, port, user, password_enc, comment, 
+		INSERT INTO targets (name, host, port, user, password_enc, password_ref, comment, 
 		                     schedule_time, retention_days, auto_compress, database_mode, 
-		                     selected_databases, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		                     selected_databases, include_routines, include_triggers, include_events,
+		                     parallelism, chunk_size, include_tables, exclude_tables, schema_only_tables,
+		                     tls_mode, tls_ca, tls_cert, tls_key_enc, ssh_host, ssh_port, ssh_user,
+		                     ssh_password_enc, ssh_key_enc, ssh_host_key, connection_type, socket, dsn_params,
+		                     engine, path, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	now := time.Now()
 	target.CreatedAt = now
 	target.UpdatedAt = now
 
 	result, err := r.db.Exec(query, target.Name, target.Host, target.Port, target.User, 
-		target.PasswordEnc, target.Comment, target.ScheduleTime, target.RetentionDays, 
-		target.AutoCompress, target.DatabaseMode, target.SelectedDatabases, target.CreatedAt, target.UpdatedAt)
+		target.PasswordEnc, target.PasswordRef, target.Comment, target.ScheduleTime, target.RetentionDays, 
+		target.AutoCompress, target.DatabaseMode, target.SelectedDatabases,
+		target.IncludeRoutines, target.IncludeTriggers, target.IncludeEvents, target.Parallelism,
+		target.ChunkSize, target.IncludeTables, target.ExcludeTables, target.SchemaOnlyTables,
+		target.TLSMode, target.TLSCA, target.TLSCert, target.TLSKeyEnc, target.SSHHost, target.SSHPort,
+		target.SSHUser, target.SSHPasswordEnc, target.SSHKeyEnc, target.SSHHostKey,
+		target.ConnectionType, target.Socket, target.DSNParams, target.Engine,
+		target.Path, target.CreatedAt, target.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create target: %w", err)
 	}
@@ -42,12 +86,7 @@ func (r *Repository) CreateTarget(target *Target) error {
 }
 
 func (r *Repository) GetTargets() ([]*Target, error) {
-	query := `
-		SELECT id, name, host, port, user, password_enc, comment,
-		       schedule_time, retention_days, auto_compress, database_mode, 
-		       selected_databases, created_at, updated_at
-		FROM targets ORDER BY name
-	`
+	query := `SELECT ` + targetColumns + ` FROM targets ORDER BY name`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query targets: %w", err)
@@ -56,11 +95,7 @@ func (r *Repository) GetTargets() ([]*Target, error) {
 
 	var targets []*Target
 	for rows.Next() {
-		target := &Target{}
-		err := rows.Scan(&target.ID, &target.Name, &target.Host, &target.Port,
-			&target.User, &target.PasswordEnc, &target.Comment,
-			&target.ScheduleTime, &target.RetentionDays, &target.AutoCompress,
-			&target.DatabaseMode, &target.SelectedDatabases, &target.CreatedAt, &target.UpdatedAt)
+		target, err := scanTarget(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan target: %w", err)
 		}
@@ -71,17 +106,8 @@ func (r *Repository) GetTargets() ([]*Target, error) {
 }
 
 func (r *Repository) GetTarget(id int64) (*Target, error) {
-	query := `
-		SELECT id, name, host, port, user, password_enc, comment,
-		       schedule_time, retention_days, auto_compress, database_mode, 
-		       selected_databases, created_at, updated_at
-		FROM targets WHERE id = ?
-	`
-	target := &Target{}
-	err := r.db.QueryRow(query, id).Scan(&target.ID, &target.Name, &target.Host,
-		&target.Port, &target.User, &target.PasswordEnc, &target.Comment,
-		&target.ScheduleTime, &target.RetentionDays, &target.AutoCompress,
-		&target.DatabaseMode, &target.SelectedDatabases, &target.CreatedAt, &target.UpdatedAt)
+	query := `SELECT ` + targetColumns + ` FROM targets WHERE id = ?`
+	target, err := scanTarget(r.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("target not found")
@@ -95,15 +121,26 @@ func (r *Repository) GetTarget(id int64) (*Target, error) {
 func (r *Repository) UpdateTarget(target *Target) error {
 	query := `
 		UPDATE targets SET name = ?, host = ?, port = ?, user = ?,
-		                   password_enc = ?, comment = ?, schedule_time = ?,
+		                   password_enc = ?, password_ref = ?, comment = ?, schedule_time = ?,
 		                   retention_days = ?, auto_compress = ?, database_mode = ?, 
-		                   selected_databases = ?, updated_at = ?
+		                   selected_databases = ?, include_routines = ?, include_triggers = ?,
+		                   include_events = ?, parallelism = ?, chunk_size = ?, include_tables = ?,
+		                   exclude_tables = ?, schema_only_tables = ?, tls_mode = ?, tls_ca = ?,
+		                   tls_cert = ?, tls_key_enc = ?, ssh_host = ?, ssh_port = ?, ssh_user = ?,
+		                   ssh_password_enc = ?, ssh_key_enc = ?, ssh_host_key = ?, connection_type = ?,
+		                   socket = ?, dsn_params = ?, engine = ?, path = ?, updated_at = ?
 		WHERE id = ?
 	`
 	target.UpdatedAt = time.Now()
 	_, err := r.db.Exec(query, target.Name, target.Host, target.Port, target.User,
-		target.PasswordEnc, target.Comment, target.ScheduleTime, target.RetentionDays, 
-		target.AutoCompress, target.DatabaseMode, target.SelectedDatabases, target.UpdatedAt, target.ID)
+		target.PasswordEnc, target.PasswordRef, target.Comment, target.ScheduleTime, target.RetentionDays, 
+		target.AutoCompress, target.DatabaseMode, target.SelectedDatabases,
+		target.IncludeRoutines, target.IncludeTriggers, target.IncludeEvents, target.Parallelism,
+		target.ChunkSize, target.IncludeTables, target.ExcludeTables, target.SchemaOnlyTables,
+		target.TLSMode, target.TLSCA, target.TLSCert, target.TLSKeyEnc, target.SSHHost, target.SSHPort,
+		target.SSHUser, target.SSHPasswordEnc, target.SSHKeyEnc, target.SSHHostKey,
+		target.ConnectionType, target.Socket, target.DSNParams, target.Engine,
+		target.Path, target.UpdatedAt, target.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update target: %w", err)
 	}
@@ -119,13 +156,33 @@ func (r *Repository) DeleteTarget(id int64) error {
 	return nil
 }
 
+// backupColumns lists the backups columns in the order scanBackup reads them.
+const backupColumns = `id, target_id, database_name, kind, started_at, finished_at, size_bytes,
+		       status, file_path, notes, metadata, checksum`
+
+func scanBackup(row rowScanner) (*Backup, error) {
+	backup := &Backup{}
+	err := row.Scan(&backup.ID, &backup.TargetID, &backup.DatabaseName, &backup.Kind,
+		&backup.StartedAt, &backup.FinishedAt, &backup.SizeBytes,
+		&backup.Status, &backup.FilePath, &backup.Notes, &backup.Metadata, &backup.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
 func (r *Repository) CreateBackup(backup *Backup) error {
+	if backup.Kind == "" {
+		backup.Kind = BackupKindFull
+	}
+
 	query := `
-		INSERT INTO backups (target_id, database_name, started_at, finished_at, size_bytes, status, file_path, notes)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO backups (target_id, database_name, kind, started_at, finished_at, size_bytes, status, file_path, notes,
+		                     metadata, checksum)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query, backup.TargetID, backup.DatabaseName, backup.StartedAt, backup.FinishedAt,
-		backup.SizeBytes, backup.Status, backup.FilePath, backup.Notes)
+	result, err := r.db.Exec(query, backup.TargetID, backup.DatabaseName, backup.Kind, backup.StartedAt, backup.FinishedAt,
+		backup.SizeBytes, backup.Status, backup.FilePath, backup.Notes, backup.Metadata, backup.Checksum)
 	if err != nil {
 		return fmt.Errorf("failed to create backup: %w", err)
 	}
@@ -141,11 +198,12 @@ func (r *Repository) CreateBackup(backup *Backup) error {
 
 func (r *Repository) UpdateBackup(backup *Backup) error {
 	query := `
-		UPDATE backups SET database_name = ?, finished_at = ?, size_bytes = ?, status = ?, file_path = ?, notes = ?
+		UPDATE backups SET database_name = ?, started_at = ?, finished_at = ?, size_bytes = ?, status = ?, file_path = ?,
+		                   notes = ?, metadata = ?, checksum = ?
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, backup.DatabaseName, backup.FinishedAt, backup.SizeBytes, backup.Status,
-		backup.FilePath, backup.Notes, backup.ID)
+	_, err := r.db.Exec(query, backup.DatabaseName, backup.StartedAt, backup.FinishedAt, backup.SizeBytes, backup.Status,
+		backup.FilePath, backup.Notes, backup.Metadata, backup.Checksum, backup.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update backup: %w", err)
 	}
@@ -153,10 +211,7 @@ func (r *Repository) UpdateBackup(backup *Backup) error {
 }
 
 func (r *Repository) GetBackupsByTarget(targetID int64) ([]*Backup, error) {
-	query := `
-		SELECT id, target_id, database_name, started_at, finished_at, size_bytes, status, file_path, notes
-		FROM backups WHERE target_id = ? ORDER BY started_at DESC
-	`
+	query := `SELECT ` + backupColumns + ` FROM backups WHERE target_id = ? ORDER BY started_at DESC`
 	rows, err := r.db.Query(query, targetID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query backups: %w", err)
@@ -165,26 +220,23 @@ func (r *Repository) GetBackupsByTarget(targetID int64) ([]*Backup, error) {
 
 	var backups []*Backup
 	for rows.Next() {
-		backup := &Backup{}
-		err := rows.Scan(&backup.ID, &backup.TargetID, &backup.DatabaseName, &backup.StartedAt, &backup.FinishedAt,
-			&backup.SizeBytes, &backup.Status, &backup.FilePath, &backup.Notes)
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan backup: %w", err)
 		}
 		backups = append(backups, backup)
 	}
 
+	if err := r.attachBackupCopies(backups,
+		"backup_id IN (SELECT id FROM backups WHERE target_id = ?)", targetID); err != nil {
+		return nil, err
+	}
 	return backups, nil
 }
 
 func (r *Repository) GetBackup(id int64) (*Backup, error) {
-	query := `
-		SELECT id, target_id, database_name, started_at, finished_at, size_bytes, status, file_path, notes
-		FROM backups WHERE id = ?
-	`
-	backup := &Backup{}
-	err := r.db.QueryRow(query, id).Scan(&backup.ID, &backup.TargetID, &backup.DatabaseName,
-		&backup.StartedAt, &backup.FinishedAt, &backup.SizeBytes, &backup.Status, &backup.FilePath, &backup.Notes)
+	query := `SELECT ` + backupColumns + ` FROM backups WHERE id = ?`
+	backup, err := scanBackup(r.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("backup not found")
@@ -192,14 +244,14 @@ func (r *Repository) GetBackup(id int64) (*Backup, error) {
 		return nil, fmt.Errorf("failed to get backup: %w", err)
 	}
 
+	if err := r.attachBackupCopies([]*Backup{backup}, "backup_id = ?", id); err != nil {
+		return nil, err
+	}
 	return backup, nil
 }
 
 func (r *Repository) GetAllBackups() ([]*Backup, error) {
-	query := `
-		SELECT id, target_id, database_name, started_at, finished_at, size_bytes, status, file_path, notes
-		FROM backups ORDER BY started_at DESC
-	`
+	query := `SELECT ` + backupColumns + ` FROM backups ORDER BY started_at DESC`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query backups: %w", err)
@@ -208,15 +260,16 @@ func (r *Repository) GetAllBackups() ([]*Backup, error) {
 
 	var backups []*Backup
 	for rows.Next() {
-		backup := &Backup{}
-		err := rows.Scan(&backup.ID, &backup.TargetID, &backup.DatabaseName, &backup.StartedAt, &backup.FinishedAt,
-			&backup.SizeBytes, &backup.Status, &backup.FilePath, &backup.Notes)
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan backup: %w", err)
 		}
 		backups = append(backups, backup)
 	}
 
+	if err := r.attachBackupCopies(backups, "1 = 1"); err != nil {
+		return nil, err
+	}
 	return backups, nil
 }
 
@@ -236,6 +289,96 @@ func (r *Repository) DeleteOldBackups(targetID int64, cutoff time.Time) error {
 	return nil
 }
 
+// Backup backupCopy methods
+
+const backupCopyColumns = `id, backup_id, destination, uri, config, retention_days, status, notes,
+		       created_at, updated_at`
+
+func scanBackupCopy(row rowScanner) (*BackupCopy, error) {
+	backupCopy := &BackupCopy{}
+	err := row.Scan(&backupCopy.ID, &backupCopy.BackupID, &backupCopy.Destination, &backupCopy.URI, &backupCopy.Config,
+		&backupCopy.RetentionDays, &backupCopy.Status, &backupCopy.Notes, &backupCopy.CreatedAt, &backupCopy.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return backupCopy, nil
+}
+
+// attachBackupCopies sets the Copies of backups to the copies matching where.
+// Every backup gets a non-nil slice, primary copies come first.
+func (r *Repository) attachBackupCopies(backups []*Backup, where string, args ...interface{}) error {
+	if len(backups) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*Backup, len(backups))
+	for _, backup := range backups {
+		backup.Copies = []*BackupCopy{}
+		byID[backup.ID] = backup
+	}
+
+	query := `SELECT ` + backupCopyColumns + ` FROM backup_copies WHERE ` + where +
+		` ORDER BY destination != ?, id`
+	rows, err := r.db.Query(query, append(args, CopyDestinationPrimary)...)
+	if err != nil {
+		return fmt.Errorf("failed to query backup copies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		backupCopy, err := scanBackupCopy(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan backup backupCopy: %w", err)
+		}
+		if backup, ok := byID[backupCopy.BackupID]; ok {
+			backup.Copies = append(backup.Copies, backupCopy)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *Repository) CreateBackupCopy(backupCopy *BackupCopy) error {
+	query := `
+		INSERT INTO backup_copies (backup_id, destination, uri, config, retention_days, status, notes,
+		                           created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	now := time.Now()
+	backupCopy.CreatedAt = now
+	backupCopy.UpdatedAt = now
+
+	result, err := r.db.Exec(query, backupCopy.BackupID, backupCopy.Destination, backupCopy.URI, backupCopy.Config, backupCopy.RetentionDays,
+		backupCopy.Status, backupCopy.Notes, backupCopy.CreatedAt, backupCopy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create backup backupCopy: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	backupCopy.ID = id
+
+	return nil
+}
+
+func (r *Repository) UpdateBackupCopy(backupCopy *BackupCopy) error {
+	query := `UPDATE backup_copies SET uri = ?, status = ?, notes = ?, updated_at = ? WHERE id = ?`
+	backupCopy.UpdatedAt = time.Now()
+	_, err := r.db.Exec(query, backupCopy.URI, backupCopy.Status, backupCopy.Notes, backupCopy.UpdatedAt, backupCopy.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update backup backupCopy: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) DeleteBackupCopy(id int64) error {
+	_, err := r.db.Exec("DELETE FROM backup_copies WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete backup backupCopy: %w", err)
+	}
+	return nil
+}
+
 // Schedule Jobs repository methods
 
 func (r *Repository) CreateScheduleJob(job *ScheduleJob) error {
@@ -378,6 +521,149 @@ func (r *Repository) GetActiveScheduleJobs() ([]*ScheduleJob, error) {
 	return jobs, nil
 }
 
+// Job run methods
+
+const jobRunColumns = `id, job_id, started_at, finished_at, status, backup_ids, error`
+
+func scanJobRun(row rowScanner) (*JobRun, error) {
+	run := &JobRun{}
+	var backupIDs string
+	err := row.Scan(&run.ID, &run.JobID, &run.StartedAt, &run.FinishedAt, &run.Status, &backupIDs, &run.Error)
+	if err != nil {
+		return nil, err
+	}
+	run.BackupIDs, err = parseIDs(backupIDs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup ids of job run %d: %w", run.ID, err)
+	}
+	return run, nil
+}
+
+func (r *Repository) CreateJobRun(run *JobRun) error {
+	query := `INSERT INTO job_runs (job_id, started_at, finished_at, status, backup_ids, error) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := r.db.Exec(query, run.JobID, run.StartedAt, run.FinishedAt, run.Status, formatIDs(run.BackupIDs), run.Error)
+	if err != nil {
+		return fmt.Errorf("failed to create job run: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	run.ID = id
+	return nil
+}
+
+func (r *Repository) UpdateJobRun(run *JobRun) error {
+	query := `UPDATE job_runs SET finished_at = ?, status = ?, backup_ids = ?, error = ? WHERE id = ?`
+	_, err := r.db.Exec(query, run.FinishedAt, run.Status, formatIDs(run.BackupIDs), run.Error, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update job run: %w", err)
+	}
+	return nil
+}
+
+// GetJobRuns returns the latest limit runs of a job, newest first.
+func (r *Repository) GetJobRuns(jobID int64, limit int) ([]*JobRun, error) {
+	query := `SELECT ` + jobRunColumns + ` FROM job_runs WHERE job_id = ? ORDER BY started_at DESC, id DESC LIMIT ?`
+	rows, err := r.db.Query(query, jobID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// Recovery reports the work FailInterrupted marked as failed.
+type Recovery struct {
+	Jobs    int
+	Runs    int
+	Backups int
+	Copies  int
+}
+
+// FailInterrupted marks the jobs, job runs, backups and backup copies left
+// running or queued by a process that stopped as failed with notes. It must
+// run before any new work starts, which it cannot tell from the old.
+func (r *Repository) FailInterrupted(notes string) (*Recovery, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// failRows runs update and stores the number of rows it changed in count
+	failRows := func(count *int, update string, args ...interface{}) error {
+		result, err := tx.Exec(update, args...)
+		if err != nil {
+			return fmt.Errorf("failed to fail interrupted work: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to count interrupted work: %w", err)
+		}
+		*count = int(affected)
+		return nil
+	}
+
+	now := time.Now()
+	recovery := &Recovery{}
+	if err := failRows(&recovery.Jobs, `UPDATE schedule_jobs SET last_run_status = ?, last_run_notes = ?, updated_at = ? WHERE last_run_status = ?`,
+		JobStatusFailed, notes, now, JobStatusRunning); err != nil {
+		return nil, err
+	}
+	if err := failRows(&recovery.Runs, `UPDATE job_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		JobStatusFailed, notes, now, JobStatusRunning); err != nil {
+		return nil, err
+	}
+	if err := failRows(&recovery.Backups, `UPDATE backups SET status = ?, notes = ?, finished_at = ? WHERE status IN (?, ?)`,
+		BackupStatusFailed, notes, now, BackupStatusQueued, BackupStatusRunning); err != nil {
+		return nil, err
+	}
+	if err := failRows(&recovery.Copies, `UPDATE backup_copies SET status = ?, notes = ?, updated_at = ? WHERE status = ?`,
+		CopyStatusFailed, notes, now, CopyStatusUploading); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recovery: %w", err)
+	}
+	return recovery, nil
+}
+
+// formatIDs stores ids as a comma separated list.
+func formatIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseIDs reads a list stored by formatIDs.
+func parseIDs(s string) ([]int64, error) {
+	ids := []int64{}
+	if s == "" {
+		return ids, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // Config methods
 func (r *Repository) GetConfig(key string) (*AppConfig, error) {
 	query := `SELECT id, key, value, created_at, updated_at FROM app_config WHERE key = ?`
@@ -438,4 +724,175 @@ func (r *Repository) GetAllConfigs() ([]*AppConfig, error) {
 	}
 
 	return configs, nil
-}
\ No newline at end of file
+}
+// Sanitize profile methods
+func (r *Repository) CreateSanitizeProfile(profile *SanitizeProfile) error {
+	query := `
+		INSERT INTO sanitize_profiles (name, description, rules, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	now := time.Now()
+	profile.CreatedAt = now
+	profile.UpdatedAt = now
+
+	result, err := r.db.Exec(query, profile.Name, profile.Description, profile.Rules, profile.CreatedAt, profile.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create sanitize profile: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	profile.ID = id
+
+	return nil
+}
+
+func (r *Repository) GetSanitizeProfiles() ([]*SanitizeProfile, error) {
+	query := `SELECT id, name, description, rules, created_at, updated_at FROM sanitize_profiles ORDER BY name`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sanitize profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []*SanitizeProfile
+	for rows.Next() {
+		profile := &SanitizeProfile{}
+		err := rows.Scan(&profile.ID, &profile.Name, &profile.Description, &profile.Rules,
+			&profile.CreatedAt, &profile.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sanitize profile: %w", err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+func (r *Repository) GetSanitizeProfile(id int64) (*SanitizeProfile, error) {
+	query := `SELECT id, name, description, rules, created_at, updated_at FROM sanitize_profiles WHERE id = ?`
+	profile := &SanitizeProfile{}
+	err := r.db.QueryRow(query, id).Scan(&profile.ID, &profile.Name, &profile.Description, &profile.Rules,
+		&profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("sanitize profile not found")
+		}
+		return nil, fmt.Errorf("failed to get sanitize profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+func (r *Repository) UpdateSanitizeProfile(profile *SanitizeProfile) error {
+	query := `UPDATE sanitize_profiles SET name = ?, description = ?, rules = ?, updated_at = ? WHERE id = ?`
+	profile.UpdatedAt = time.Now()
+	_, err := r.db.Exec(query, profile.Name, profile.Description, profile.Rules, profile.UpdatedAt, profile.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update sanitize profile: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) DeleteSanitizeProfile(id int64) error {
+	_, err := r.db.Exec("DELETE FROM sanitize_profiles WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete sanitize profile: %w", err)
+	}
+	return nil
+}
+
+// KeyRotation reports the secrets RotateEncryptionKey re-encrypted.
+type KeyRotation struct {
+	KeyID   string `json:"key_id"`
+	Targets int    `json:"targets"`
+	Jobs    int    `json:"jobs"`
+	Copies  int    `json:"copies"`
+}
+
+// RotateEncryptionKey re-encrypts every secret under the current key in one
+// transaction, so a failure leaves all of them as they were. Target
+// passwords are re-encrypted here; the meta configs of jobs and the configs
+// of backup copies are JSON owned by the backup package and are passed
+// through resealMeta and resealCopy.
+func (r *Repository) RotateEncryptionKey(resealMeta, resealCopy func(string) (string, error)) (*KeyRotation, error) {
+	keyID, err := CurrentKeyID()
+	if err != nil {
+		return nil, err
+	}
+	rotation := &KeyRotation{KeyID: keyID}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A target counts once however many of its secrets changed
+	rotatedTargets := make(map[int64]bool)
+	for _, column := range []string{"password_enc", "tls_key_enc", "ssh_password_enc", "ssh_key_enc"} {
+		ids, err := reencryptColumn(tx, "targets", column, ReencryptPassword)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			rotatedTargets[id] = true
+		}
+	}
+	rotation.Targets = len(rotatedTargets)
+
+	jobs, err := reencryptColumn(tx, "schedule_jobs", "meta_config", resealMeta)
+	if err != nil {
+		return nil, err
+	}
+	copies, err := reencryptColumn(tx, "backup_copies", "config", resealCopy)
+	if err != nil {
+		return nil, err
+	}
+	rotation.Jobs, rotation.Copies = len(jobs), len(copies)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit key rotation: %w", err)
+	}
+	return rotation, nil
+}
+
+// reencryptColumn replaces every non-empty value of column in table by
+// reencrypt(value) and returns the IDs of the rows changed.
+func reencryptColumn(tx *sql.Tx, table, column string, reencrypt func(string) (string, error)) ([]int64, error) {
+	rows, err := tx.Query(`SELECT id, ` + column + ` FROM ` + table + ` WHERE ` + column + ` != ''`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	values := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		values[id] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+
+	var changed []int64
+	for id, value := range values {
+		reencrypted, err := reencrypt(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s %d: %w", table, id, err)
+		}
+		if reencrypted == value {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE `+table+` SET `+column+` = ? WHERE id = ?`, reencrypted, id); err != nil {
+			return nil, fmt.Errorf("failed to update %s %d: %w", table, id, err)
+		}
+		changed = append(changed, id)
+	}
+	return changed, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -91,6 +92,20 @@ func TestTargetCRUD(t *testing.T) {
 		t.Errorf("Port mismatch: expected %d, got %d", target.Port, retrieved.Port)
 	}
 
+	// Targets can reference their password instead of storing it
+	target.PasswordRef = "env:MYSQL_PASSWORD"
+	target.PasswordEnc = ""
+	if err := repo.UpdateTarget(target); err != nil {
+		t.Fatalf("UpdateTarget failed: %v", err)
+	}
+	retrieved, err = repo.GetTarget(target.ID)
+	if err != nil {
+		t.Fatalf("GetTarget failed: %v", err)
+	}
+	if retrieved.PasswordRef != "env:MYSQL_PASSWORD" || retrieved.PasswordEnc != "" {
+		t.Errorf("Password reference not stored: ref %q, enc %q", retrieved.PasswordRef, retrieved.PasswordEnc)
+	}
+
 	// Test GetTargets
 	targets, err := repo.GetTargets()
 	if err != nil {
@@ -104,6 +119,14 @@ func TestTargetCRUD(t *testing.T) {
 	// Test Update
 	target.Name = "Updated Target"
 	target.Comment = "Updated comment"
+	target.IncludeRoutines = true
+	target.IncludeEvents = true
+	target.Parallelism = 4
+	target.ChunkSize = 50000
+	target.ExcludeTables = `["*_log"]`
+	target.ConnectionType = ConnectionUnix
+	target.Socket = "/run/mysqld/mysqld.sock"
+	target.DSNParams = `{"timeout":"5s"}`
 	err = repo.UpdateTarget(target)
 	if err != nil {
 		t.Fatalf("UpdateTarget failed: %v", err)
@@ -120,6 +143,22 @@ func TestTargetCRUD(t *testing.T) {
 	if updated.Comment != "Updated comment" {
 		t.Errorf("Comment not updated: expected %q, got %q", "Updated comment", updated.Comment)
 	}
+	if !updated.IncludeRoutines || updated.IncludeTriggers || !updated.IncludeEvents {
+		t.Errorf("Stored program options not updated: routines=%v triggers=%v events=%v",
+			updated.IncludeRoutines, updated.IncludeTriggers, updated.IncludeEvents)
+	}
+	if updated.Parallelism != 4 {
+		t.Errorf("Parallelism not updated: expected %d, got %d", 4, updated.Parallelism)
+	}
+	if updated.ChunkSize != 50000 {
+		t.Errorf("ChunkSize not updated: expected %d, got %d", 50000, updated.ChunkSize)
+	}
+	if updated.ExcludeTables != `["*_log"]` || updated.IncludeTables != "" {
+		t.Errorf("Table rules not updated: include=%q exclude=%q", updated.IncludeTables, updated.ExcludeTables)
+	}
+	if updated.ConnectionType != ConnectionUnix || updated.Socket != "/run/mysqld/mysqld.sock" || updated.DSNParams != `{"timeout":"5s"}` {
+		t.Errorf("Connection not updated: type=%q socket=%q params=%q", updated.ConnectionType, updated.Socket, updated.DSNParams)
+	}
 
 	// Test Delete
 	err = repo.DeleteTarget(target.ID)
@@ -198,6 +237,9 @@ func TestBackupCRUD(t *testing.T) {
 	if retrieved.Status != backup.Status {
 		t.Errorf("Status mismatch: expected %q, got %q", backup.Status, retrieved.Status)
 	}
+	if retrieved.Kind != BackupKindFull {
+		t.Errorf("Kind mismatch: expected default %q, got %q", BackupKindFull, retrieved.Kind)
+	}
 
 	// Test Update
 	finishTime := time.Now()
@@ -205,6 +247,8 @@ func TestBackupCRUD(t *testing.T) {
 	backup.Status = BackupStatusSuccess
 	backup.SizeBytes = 12345
 	backup.FilePath = "/tmp/backup.sql.gz"
+	backup.Metadata = `{"tables":["users"]}`
+	backup.Checksum = "abc123"
 
 	err = repo.UpdateBackup(backup)
 	if err != nil {
@@ -225,6 +269,12 @@ func TestBackupCRUD(t *testing.T) {
 	if updated.FilePath != "/tmp/backup.sql.gz" {
 		t.Errorf("FilePath not updated: expected %q, got %q", "/tmp/backup.sql.gz", updated.FilePath)
 	}
+	if updated.Metadata != `{"tables":["users"]}` {
+		t.Errorf("Metadata not updated: got %q", updated.Metadata)
+	}
+	if updated.Checksum != "abc123" {
+		t.Errorf("Checksum not updated: got %q", updated.Checksum)
+	}
 
 	// Test GetBackupsByTarget
 	backups, err := repo.GetBackupsByTarget(target.ID)
@@ -239,6 +289,7 @@ func TestBackupCRUD(t *testing.T) {
 	// Create another backup to test ordering
 	backup2 := &Backup{
 		TargetID:  target.ID,
+		Kind:      BackupKindStructure,
 		StartedAt: time.Now().Add(1 * time.Hour),
 		Status:    BackupStatusSuccess,
 	}
@@ -260,6 +311,9 @@ func TestBackupCRUD(t *testing.T) {
 	if backups[0].ID != backup2.ID {
 		t.Error("Backups not ordered correctly by started_at DESC")
 	}
+	if backups[0].Kind != BackupKindStructure {
+		t.Errorf("Kind mismatch: expected %q, got %q", BackupKindStructure, backups[0].Kind)
+	}
 
 	// Test Delete
 	err = repo.DeleteBackup(backup.ID)
@@ -290,6 +344,86 @@ func TestBackupCRUD(t *testing.T) {
 	}
 }
 
+func TestBackupCopies(t *testing.T) {
+	setupTestEncryption(t)
+	_, repo := setupTestDB(t)
+
+	target := &Target{Name: "copies", Host: "localhost", Port: 3306, User: "root", DatabaseMode: DatabaseModeAll}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	backup := &Backup{TargetID: target.ID, DatabaseName: "app", StartedAt: time.Now(), Status: BackupStatusSuccess}
+	if err := repo.CreateBackup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	replica := &BackupCopy{
+		BackupID:      backup.ID,
+		Destination:   "nas",
+		URI:           "sftp://dumper@nas:22/backups/app.sql.gz",
+		Config:        `{"type":"sftp"}`,
+		RetentionDays: 90,
+		Status:        CopyStatusUploading,
+	}
+	if err := repo.CreateBackupCopy(replica); err != nil {
+		t.Fatalf("CreateBackupCopy failed: %v", err)
+	}
+	primary := &BackupCopy{BackupID: backup.ID, Destination: CopyDestinationPrimary, URI: "file:///data/app.sql.gz", Status: CopyStatusSuccess}
+	if err := repo.CreateBackupCopy(primary); err != nil {
+		t.Fatalf("CreateBackupCopy failed: %v", err)
+	}
+
+	replica.Status = CopyStatusFailed
+	replica.Notes = "connection refused"
+	if err := repo.UpdateBackupCopy(replica); err != nil {
+		t.Fatalf("UpdateBackupCopy failed: %v", err)
+	}
+
+	all, err := repo.GetAllBackups()
+	if err != nil {
+		t.Fatalf("GetAllBackups failed: %v", err)
+	}
+	if len(all) != 1 || len(all[0].Copies) != 2 {
+		t.Fatalf("Expected 1 backup with 2 copies, got %+v", all)
+	}
+	copies := all[0].Copies
+	if copies[0].Destination != CopyDestinationPrimary {
+		t.Errorf("Expected primary copy first, got %q", copies[0].Destination)
+	}
+	if copies[1].Status != CopyStatusFailed || copies[1].Notes != "connection refused" ||
+		copies[1].Config != `{"type":"sftp"}` || copies[1].RetentionDays != 90 {
+		t.Errorf("Replica not stored as expected: %+v", copies[1])
+	}
+
+	if err := repo.DeleteBackupCopy(primary.ID); err != nil {
+		t.Fatalf("DeleteBackupCopy failed: %v", err)
+	}
+	retrieved, err := repo.GetBackup(backup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retrieved.Copies) != 1 || retrieved.Copies[0].ID != replica.ID {
+		t.Errorf("Expected only the replica to remain, got %+v", retrieved.Copies)
+	}
+
+	// Copies go with their backup
+	if err := repo.DeleteBackup(backup.ID); err != nil {
+		t.Fatal(err)
+	}
+	byTarget, err := repo.GetBackupsByTarget(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byTarget) != 0 {
+		t.Errorf("Expected no backups, got %d", len(byTarget))
+	}
+	var count int
+	repo.db.QueryRow("SELECT COUNT(*) FROM backup_copies").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected copies to be deleted with the backup, got %d", count)
+	}
+}
+
 func TestForeignKeyConstraints(t *testing.T) {
 	setupTestEncryption(t)
 	_, repo := setupTestDB(t)
@@ -339,4 +473,277 @@ func TestForeignKeyConstraints(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expected backup to be deleted when target is deleted")
 	}
-}
\ No newline at end of file
+}
+func TestSanitizeProfileCRUD(t *testing.T) {
+	_, repo := setupTestDB(t)
+
+	profile := &SanitizeProfile{
+		Name:        "staging",
+		Description: "Masked customer data",
+		Rules:       `{"tables":[{"table":"users","masks":{"email":{"type":"email"}}}]}`,
+	}
+	if err := repo.CreateSanitizeProfile(profile); err != nil {
+		t.Fatalf("CreateSanitizeProfile failed: %v", err)
+	}
+	if profile.ID == 0 {
+		t.Fatal("Expected profile ID to be set")
+	}
+
+	if err := repo.CreateSanitizeProfile(&SanitizeProfile{Name: "staging", Rules: "{}"}); err == nil {
+		t.Error("Expected error for duplicate profile name")
+	}
+
+	retrieved, err := repo.GetSanitizeProfile(profile.ID)
+	if err != nil {
+		t.Fatalf("GetSanitizeProfile failed: %v", err)
+	}
+	if retrieved.Name != profile.Name || retrieved.Rules != profile.Rules {
+		t.Errorf("Unexpected profile %+v", retrieved)
+	}
+
+	retrieved.Rules = `{"tables":[]}`
+	if err := repo.UpdateSanitizeProfile(retrieved); err != nil {
+		t.Fatalf("UpdateSanitizeProfile failed: %v", err)
+	}
+
+	profiles, err := repo.GetSanitizeProfiles()
+	if err != nil {
+		t.Fatalf("GetSanitizeProfiles failed: %v", err)
+	}
+	if len(profiles) != 1 || profiles[0].Rules != `{"tables":[]}` {
+		t.Errorf("Unexpected profiles %+v", profiles)
+	}
+
+	if err := repo.DeleteSanitizeProfile(profile.ID); err != nil {
+		t.Fatalf("DeleteSanitizeProfile failed: %v", err)
+	}
+	if _, err := repo.GetSanitizeProfile(profile.ID); err == nil {
+		t.Error("Expected error when getting deleted profile")
+	}
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	os.Setenv("APP_ENC_KEY", GenerateEncryptionKey())
+	initEncryption()
+	_, repo := setupTestDB(t)
+	t.Cleanup(func() {
+		os.Unsetenv("APP_ENC_KEY")
+		os.Unsetenv("APP_ENC_KEY_PREVIOUS")
+	})
+
+	oldID, err := CurrentKeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := EncryptPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &Target{Name: "rotate", Host: "localhost", Port: 3306, User: "root", PasswordEnc: password,
+		SSHHost: "bastion", SSHPasswordEnc: password, DatabaseMode: DatabaseModeAll}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	job := &ScheduleJob{TargetID: target.ID, Name: "nightly", ScheduleConfig: "{}", BackupOptions: "{}", MetaConfig: `{"offsite":{}}`}
+	if err := repo.CreateScheduleJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("APP_ENC_KEY_PREVIOUS", os.Getenv("APP_ENC_KEY"))
+	os.Setenv("APP_ENC_KEY", GenerateEncryptionKey())
+	initEncryption()
+	newID, err := CurrentKeyID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged := func(s string) (string, error) { return s, nil }
+
+	// A failure rolls back everything re-encrypted before it
+	failing := func(string) (string, error) { return "", fmt.Errorf("boom") }
+	if _, err := repo.RotateEncryptionKey(failing, unchanged); err == nil {
+		t.Fatal("Expected error from a failing reseal")
+	}
+	retrieved, err := repo.GetTarget(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if KeyID(retrieved.PasswordEnc) != oldID {
+		t.Errorf("Expected password to stay under key %s after rollback, got %q", oldID, retrieved.PasswordEnc)
+	}
+
+	resealed := func(string) (string, error) { return `{"offsite":{"resealed":true}}`, nil }
+	rotation, err := repo.RotateEncryptionKey(resealed, unchanged)
+	if err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if rotation.KeyID != newID || rotation.Targets != 1 || rotation.Jobs != 1 || rotation.Copies != 0 {
+		t.Errorf("Unexpected rotation: %+v", rotation)
+	}
+
+	retrieved, err = repo.GetTarget(target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if KeyID(retrieved.PasswordEnc) != newID || KeyID(retrieved.SSHPasswordEnc) != newID {
+		t.Errorf("Expected secrets under key %s, got %q and %q", newID, retrieved.PasswordEnc, retrieved.SSHPasswordEnc)
+	}
+	if decrypted, err := DecryptPassword(retrieved.PasswordEnc); err != nil || decrypted != "secret" {
+		t.Errorf("Expected password to decrypt to %q, got %q (%v)", "secret", decrypted, err)
+	}
+	retrievedJob, err := repo.GetScheduleJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retrievedJob.MetaConfig != `{"offsite":{"resealed":true}}` {
+		t.Errorf("Expected resealed meta config, got %q", retrievedJob.MetaConfig)
+	}
+
+	// Nothing is left to re-encrypt
+	rotation, err = repo.RotateEncryptionKey(unchanged, unchanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotation.Targets != 0 || rotation.Jobs != 0 {
+		t.Errorf("Expected nothing to rotate, got %+v", rotation)
+	}
+}
+
+func TestJobRuns(t *testing.T) {
+	setupTestEncryption(t)
+	_, repo := setupTestDB(t)
+
+	target := &Target{Name: "runs", Host: "localhost", Port: 3306, User: "root", DatabaseMode: DatabaseModeAll}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	job := &ScheduleJob{TargetID: target.ID, Name: "nightly", IsActive: true, ScheduleConfig: "{}", BackupOptions: "{}"}
+	if err := repo.CreateScheduleJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	first := &JobRun{JobID: job.ID, StartedAt: time.Now().Add(-time.Hour), Status: JobStatusRunning}
+	if err := repo.CreateJobRun(first); err != nil {
+		t.Fatalf("CreateJobRun failed: %v", err)
+	}
+	finishedAt := time.Now().Add(-30 * time.Minute)
+	first.FinishedAt = &finishedAt
+	first.Status = JobStatusFailed
+	first.BackupIDs = []int64{7, 8}
+	first.Error = "backup of app failed: connection refused"
+	if err := repo.UpdateJobRun(first); err != nil {
+		t.Fatalf("UpdateJobRun failed: %v", err)
+	}
+
+	second := &JobRun{JobID: job.ID, StartedAt: time.Now(), Status: JobStatusRunning}
+	if err := repo.CreateJobRun(second); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := repo.GetJobRuns(job.ID, 10)
+	if err != nil {
+		t.Fatalf("GetJobRuns failed: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != second.ID {
+		t.Fatalf("Expected 2 runs newest first, got %+v", runs)
+	}
+	if len(runs[0].BackupIDs) != 0 || runs[0].FinishedAt != nil {
+		t.Errorf("Unexpected running run %+v", runs[0])
+	}
+	stored := runs[1]
+	if stored.Status != JobStatusFailed || stored.Error != first.Error || stored.FinishedAt == nil ||
+		len(stored.BackupIDs) != 2 || stored.BackupIDs[0] != 7 || stored.BackupIDs[1] != 8 {
+		t.Errorf("Run not stored as expected: %+v", stored)
+	}
+
+	if runs, _ := repo.GetJobRuns(job.ID, 1); len(runs) != 1 {
+		t.Errorf("Expected the limit to apply, got %d runs", len(runs))
+	}
+
+	// Runs go with their job
+	if err := repo.DeleteScheduleJob(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := repo.GetJobRuns(job.ID, 10); len(runs) != 0 {
+		t.Errorf("Expected runs to be deleted with the job, got %d", len(runs))
+	}
+}
+
+func TestFailInterrupted(t *testing.T) {
+	setupTestEncryption(t)
+	_, repo := setupTestDB(t)
+
+	target := &Target{Name: "interrupted", Host: "localhost", Port: 3306, User: "root", DatabaseMode: DatabaseModeAll}
+	if err := repo.CreateTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	running := &ScheduleJob{TargetID: target.ID, Name: "running", IsActive: true, ScheduleConfig: "{}", BackupOptions: "{}"}
+	done := &ScheduleJob{TargetID: target.ID, Name: "done", IsActive: true, ScheduleConfig: "{}", BackupOptions: "{}"}
+	for _, job := range []*ScheduleJob{running, done} {
+		if err := repo.CreateScheduleJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	startedAt := time.Now().Add(-time.Hour)
+	if err := repo.UpdateScheduleJobRunStatus(running.ID, JobStatusRunning, "Job execution started", &startedAt, &startedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateScheduleJobRunStatus(done.ID, JobStatusSuccess, "Backup completed", &startedAt, nil); err != nil {
+		t.Fatal(err)
+	}
+	run := &JobRun{JobID: running.ID, StartedAt: startedAt, Status: JobStatusRunning}
+	if err := repo.CreateJobRun(run); err != nil {
+		t.Fatal(err)
+	}
+
+	var backups []*Backup
+	for _, status := range []string{BackupStatusQueued, BackupStatusRunning, BackupStatusSuccess} {
+		backup := &Backup{TargetID: target.ID, DatabaseName: "app", StartedAt: startedAt, Status: status}
+		if err := repo.CreateBackup(backup); err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, backup)
+	}
+	upload := &BackupCopy{BackupID: backups[2].ID, Destination: "nas", URI: "sftp://nas/app.sql.gz", Status: CopyStatusUploading}
+	if err := repo.CreateBackupCopy(upload); err != nil {
+		t.Fatal(err)
+	}
+
+	recovery, err := repo.FailInterrupted("Interrupted")
+	if err != nil {
+		t.Fatalf("FailInterrupted failed: %v", err)
+	}
+	if *recovery != (Recovery{Jobs: 1, Runs: 1, Backups: 2, Copies: 1}) {
+		t.Errorf("Unexpected recovery %+v", recovery)
+	}
+
+	job, _ := repo.GetScheduleJob(running.ID)
+	if job.LastRunStatus != JobStatusFailed || job.LastRunNotes != "Interrupted" || job.NextRunAt == nil {
+		t.Errorf("Expected the running job to fail and stay due, got %+v", job)
+	}
+	if job, _ := repo.GetScheduleJob(done.ID); job.LastRunStatus != JobStatusSuccess {
+		t.Errorf("Expected the finished job to be left alone, got %s", job.LastRunStatus)
+	}
+	if runs, _ := repo.GetJobRuns(running.ID, 10); len(runs) != 1 || runs[0].Status != JobStatusFailed || runs[0].FinishedAt == nil {
+		t.Errorf("Expected the run to fail, got %+v", runs)
+	}
+	for i, expected := range []string{BackupStatusFailed, BackupStatusFailed, BackupStatusSuccess} {
+		backup, err := repo.GetBackup(backups[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backup.Status != expected {
+			t.Errorf("Expected backup %d to be %s, got %s", i, expected, backup.Status)
+		}
+		if expected == BackupStatusFailed && (backup.Notes != "Interrupted" || backup.FinishedAt == nil) {
+			t.Errorf("Unexpected failed backup %+v", backup)
+		}
+		if i == 2 && (len(backup.Copies) != 1 || backup.Copies[0].Status != CopyStatusFailed) {
+			t.Errorf("Expected the upload to fail, got %+v", backup.Copies)
+		}
+	}
+
+	// Nothing is left to recover
+	if recovery, _ := repo.FailInterrupted("Interrupted"); *recovery != (Recovery{}) {
+		t.Errorf("Expected nothing to recover, got %+v", recovery)
+	}
+}
@@ -134,6 +134,49 @@ export interface ScheduleJob {
   target?: Target
 }
 
+export interface JobRun {
+  id: number
+  job_id: number
+  started_at: string
+  finished_at?: string
+  status: 'running' | 'success' | 'failed' | 'skipped'
+  backup_ids: number[]
+  error: string
+}
+
+export interface OffsiteDestination {
+  type: 'sftp' | 'webdav' | 's3'
+  name?: string
+  retention_days?: number
+  // sftp
+  host?: string
+  port?: number
+  private_key?: string
+  host_key?: string
+  insecure_ignore_host_key?: boolean
+  path?: string
+  // webdav
+  url?: string
+  user?: string
+  password?: string
+  // s3
+  endpoint?: string
+  region?: string
+  bucket?: string
+  prefix?: string
+  access_key?: string
+  secret_key?: string
+  insecure?: boolean
+  path_style?: boolean
+  retries?: number
+}
+
+export interface JobMetaConfig {
+  offsite?: OffsiteDestination
+  destinations?: OffsiteDestination[]
+  [key: string]: any
+}
+
 export interface CreateJobRequest {
   target_id: number
   name: string
@@ -145,14 +188,22 @@ export interface CreateJobRequest {
     weekdays?: number[]
     days_of_month?: number[]
     months?: number[]
+    cron?: string
+    timezone?: string
+    misfire?: 'run_once' | 'skip' | 'run_all'
+    misfire_limit?: number
   }
   backup_options: {
     compress: boolean
     include_structure: boolean
     include_data: boolean
     databases?: string[]
+    include_tables?: string[]
+    exclude_tables?: string[]
+    schema_only_tables?: string[]
+    sanitize_profile_id?: number
   }
-  meta_config?: Record<string, any>
+  meta_config?: JobMetaConfig
 }
 
 export interface UpdateJobRequest {
@@ -166,14 +217,39 @@ export interface UpdateJobRequest {
     weekdays?: number[]
     days_of_month?: number[]
     months?: number[]
+    cron?: string
+    timezone?: string
+    misfire?: 'run_once' | 'skip' | 'run_all'
+    misfire_limit?: number
   }
   backup_options: {
     compress: boolean
     include_structure: boolean
     include_data: boolean
     databases?: string[]
+    include_tables?: string[]
+    exclude_tables?: string[]
+    schema_only_tables?: string[]
+    sanitize_profile_id?: number
   }
-  meta_config?: Record<string, any>
+  meta_config?: JobMetaConfig
+}
+
+export interface SchedulePreviewRequest {
+  frequency?: string
+  minutes?: number[]
+  hours?: number[]
+  weekdays?: number[]
+  days_of_month?: number[]
+  months?: number[]
+  cron?: string
+  timezone?: string
+  count?: number
+}
+
+export interface SchedulePreview {
+  timezone: string
+  runs: string[]
 }
 
 export const jobsApi = {
@@ -204,6 +280,92 @@ export const jobsApi = {
   async runNow(id: number): Promise<{ message: string; job_id: number }> {
     const response = await api.post(`/jobs/${id}/run`)
     return response.data
+  },
+
+  async getRuns(id: number, limit?: number): Promise<JobRun[]> {
+    const response = await api.get<JobRun[]>(`/jobs/${id}/runs`, { params: { limit } })
+    return response.data
+  },
+
+  async preview(request: SchedulePreviewRequest): Promise<SchedulePreview> {
+    const response = await api.post<SchedulePreview>('/jobs/preview', request)
+    return response.data
+  }
+}
+
+export interface MaskRule {
+  type: 'hash' | 'null' | 'email' | 'fixed'
+  value?: string
+}
+
+export interface SanitizeRules {
+  tables: {
+    table: string
+    where?: string
+    masks?: Record<string, MaskRule>
+  }[]
+}
+
+export interface SanitizeProfile {
+  id: number
+  name: string
+  description: string
+  rules: SanitizeRules
+  created_at: string
+  updated_at: string
+}
+
+export interface SanitizeProfileRequest {
+  name: string
+  description?: string
+  rules: SanitizeRules
+}
+
+export const sanitizeProfilesApi = {
+  async getAll(): Promise<SanitizeProfile[]> {
+    const response = await api.get<SanitizeProfile[]>('/sanitize-profiles')
+    return response.data
+  },
+
+  async getById(id: number): Promise<SanitizeProfile> {
+    const response = await api.get<SanitizeProfile>(`/sanitize-profiles/${id}`)
+    return response.data
+  },
+
+  async create(profile: SanitizeProfileRequest): Promise<SanitizeProfile> {
+    const response = await api.post<SanitizeProfile>('/sanitize-profiles', profile)
+    return response.data
+  },
+
+  async update(id: number, profile: SanitizeProfileRequest): Promise<SanitizeProfile> {
+    const response = await api.put<SanitizeProfile>(`/sanitize-profiles/${id}`, profile)
+    return response.data
+  },
+
+  async delete(id: number): Promise<void> {
+    await api.delete(`/sanitize-profiles/${id}`)
+  }
+}
+
+export interface QueueTask {
+  id: number
+  target_id: number
+  job_id?: number
+  status: 'queued' | 'running'
+  queued_at: string
+  started_at?: string
+}
+
+export interface BackupQueue {
+  concurrency: number
+  target_lock: 'queue' | 'skip' | 'fail'
+  tasks: QueueTask[]
+}
+
+export const queueApi = {
+  async get(): Promise<BackupQueue> {
+    const response = await api.get<BackupQueue>('/queue')
+    return response.data
   }
 }
 
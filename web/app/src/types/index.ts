@@ -4,54 +4,137 @@ export interface Target {
   host: string
   port: number
   user: string
+  engine?: Engine
+  path?: string
+  password_ref?: string
   comment: string
   schedule_time: string
   retention_days: number
   auto_compress: boolean
   database_mode: 'all' | 'selected'
   selected_databases?: string[]
+  include_routines: boolean
+  include_triggers: boolean
+  include_events: boolean
+  parallelism: number
+  chunk_size: number
+  include_tables?: string[]
+  exclude_tables?: string[]
+  schema_only_tables?: string[]
+  connection_type?: ConnectionType
+  socket?: string
+  dsn_params?: Record<string, string>
+  tls_mode?: TLSMode
+  tls_ca?: string
+  tls_cert?: string
+  has_tls_key?: boolean
+  ssh_host?: string
+  ssh_port?: number
+  ssh_user?: string
+  has_ssh_password?: boolean
+  has_ssh_private_key?: boolean
+  ssh_host_key?: string
   created_at: string
   updated_at: string
 }
 
-export interface CreateTargetRequest {
+export type Engine = 'mysql' | 'postgres' | 'sqlite'
+
+export type ConnectionType = 'tcp' | 'unix'
+
+export type TLSMode = 'disabled' | 'preferred' | 'required' | 'verify-ca' | 'verify-full'
+
+// Engine, connection, TLS and SSH tunnel settings; the key, password and private key are write-only
+export interface ConnectionSettings {
+  engine?: Engine
+  connection_type?: ConnectionType
+  socket?: string
+  path?: string
+  dsn_params?: Record<string, string>
+  tls_mode?: TLSMode
+  tls_ca?: string
+  tls_cert?: string
+  tls_key?: string
+  ssh_host?: string
+  ssh_port?: number
+  ssh_user?: string
+  ssh_password?: string
+  ssh_private_key?: string
+  ssh_host_key?: string
+}
+
+export interface CreateTargetRequest extends ConnectionSettings {
   name: string
   host: string
   port: number
   user: string
-  password: string
+  password?: string
+  password_ref?: string
   comment?: string
   schedule_time?: string
   retention_days?: number
   auto_compress?: boolean
   database_mode: 'all' | 'selected'
   selected_databases?: string[]
+  include_routines?: boolean
+  include_triggers?: boolean
+  include_events?: boolean
+  parallelism?: number
+  chunk_size?: number
+  include_tables?: string[]
+  exclude_tables?: string[]
+  schema_only_tables?: string[]
 }
 
-export interface UpdateTargetRequest {
+export interface UpdateTargetRequest extends ConnectionSettings {
   name: string
   host: string
   port: number
   user: string
   password?: string
+  password_ref?: string
   comment?: string
   schedule_time?: string
   retention_days?: number
   auto_compress?: boolean
   database_mode: 'all' | 'selected'
   selected_databases?: string[]
+  include_routines?: boolean
+  include_triggers?: boolean
+  include_events?: boolean
+  parallelism?: number
+  chunk_size?: number
+  include_tables?: string[]
+  exclude_tables?: string[]
+  schema_only_tables?: string[]
 }
 
 export interface Backup {
   id: number
   target_id: number
   database_name: string
+  kind: 'full' | 'structure' | 'data'
+  metadata: string
   started_at: string
   finished_at?: string
   size_bytes: number
-  status: 'running' | 'success' | 'failed'
+  status: 'queued' | 'running' | 'success' | 'failed'
   file_path: string
   notes: string
+  checksum: string
+  copies: BackupCopy[]
+}
+
+export interface BackupCopy {
+  id: number
+  backup_id: number
+  destination: string
+  uri: string
+  retention_days: number
+  status: 'uploading' | 'success' | 'failed'
+  notes: string
+  created_at: string
+  updated_at: string
 }
 
 export interface ToastMessage {